@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes, stable across releases
+const (
+	codeInvalidRequest   = "invalid_request"        // Malformed body or parameter
+	codeInvalidPage      = "invalid_page"           // Page below 1
+	codeInvalidPageSize  = "invalid_page_size"      // page_size outside the configured bounds
+	codeResultWindow     = "result_window_exceeded" // Page reaches past max_result_window
+	codeInvalidSort      = "invalid_sort"           // Unknown sort order
+	codeInvalidFilters   = "invalid_filters"        // Filters that cannot match anything
+	codeNotFound         = "not_found"              // Unknown route, item or rule
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"       // Request conflicts with the server state
+	codeReloadFailed     = "reload_failed"  // New pipeline version rejected
+	codeInternal         = "internal_error" // Unexpected failure; details are logged
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes a failed request
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"` // As in the X-Request-ID header
+	Details   interface{} `json:"details,omitempty"`    // Code-specific context
+}
+
+// abortError ends the request with an error response
+func abortError(c *gin.Context, status int, code, format string, args ...interface{}) {
+	abortErrorDetails(c, status, code, nil, format, args...)
+}
+
+// abortErrorDetails is abortError with code-specific details
+func abortErrorDetails(c *gin.Context, status int, code string, details interface{}, format string, args ...interface{}) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: APIError{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		RequestID: requestID(c),
+		Details:   details,
+	}})
+}
+
+// internalError logs err and ends the request with a 500 that does not
+// leak it
+func internalError(c *gin.Context, what string, err error) {
+	log.Printf("%s error (request %s): %v", what, requestID(c), err)
+	abortError(c, http.StatusInternalServerError, codeInternal, "%s failed", what)
+}
+
+// recoverPanic turns a handler panic into an internal error response
+func recoverPanic(c *gin.Context, recovered interface{}) {
+	internalError(c, "Request", fmt.Errorf("panic: %v", recovered))
+}
@@ -1,97 +1,730 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"flag"
+	"hash/fnv"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Boomshakalak/VibeRS/internal/analytics"
+	"github.com/Boomshakalak/VibeRS/internal/config"
 	"github.com/Boomshakalak/VibeRS/internal/dedup"
+	"github.com/Boomshakalak/VibeRS/internal/merch"
+	"github.com/Boomshakalak/VibeRS/internal/promo"
+	"github.com/Boomshakalak/VibeRS/internal/rank"
 	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
 	"github.com/Boomshakalak/VibeRS/internal/rank/final"
-	"github.com/Boomshakalak/VibeRS/internal/rank/ltr"
 	"github.com/Boomshakalak/VibeRS/internal/recall"
 	"github.com/Boomshakalak/VibeRS/internal/store"
+	"github.com/Boomshakalak/VibeRS/internal/trace"
 	"github.com/gin-gonic/gin"
 )
 
 type SearchRequest struct {
 	Query string `json:"q"`
-	Page  int    `json:"page"`
+	// Page is 1-based; omitted means the first page
+	Page *int `json:"page"`
+	// PageSize overrides server.page_size within [min_page_size, max_page_size]
+	PageSize int    `json:"page_size"`
+	UserID   string `json:"user_id"`
+	// SessionID groups the searches of one visit in the search log
+	SessionID string `json:"session_id"`
+	// ExcludeSeen drops items already served to the user. Each call then
+	// returns the next unseen page, so page is ignored ("load more" feeds).
+	ExcludeSeen bool `json:"exclude_seen"`
+	// Sort is a rank.SortOrder; empty means relevance
+	Sort string `json:"sort"`
+	// Filters are hard constraints on the results. Each one set here
+	// replaces the same filter parsed from q, e.g. "under $100".
+	Filters recall.Filters `json:"filters"`
 }
 
 type SearchResponse struct {
-	Items   []store.Item `json:"items"`
-	Total   int          `json:"total"`
-	Page    int          `json:"page"`
-	HasNext bool         `json:"has_next"`
+	Items []store.Item `json:"items"`
+	// Total counts the ranked results. It is exact unless TotalEstimated is
+	// set, when recall or a ranking stage stopped at its candidate budget
+	// and more items may match; it is then a lower bound.
+	Total          int                         `json:"total"`
+	TotalEstimated bool                        `json:"total_estimated"`
+	Page           int                         `json:"page"`
+	PageSize       int                         `json:"page_size"`
+	Sort           rank.SortOrder              `json:"sort"`
+	HasNext        bool                        `json:"has_next"`
+	Exploration    []store.ExplorationDecision `json:"exploration,omitempty"`
+	Sponsored      []final.SponsoredSlot       `json:"sponsored,omitempty"`
+	QueryRules     []string                    `json:"query_rules,omitempty"` // Merchandising rules applied
+	Redirect       string                      `json:"redirect,omitempty"`    // Set instead of results by a redirect rule
+	// Filters are the filters applied, explicit and parsed from the query
+	Filters *recall.Filters `json:"filters,omitempty"`
+	// Relaxation says how the query was relaxed when nothing matched it as typed
+	Relaxation *recall.Relaxation `json:"relaxation,omitempty"`
+}
+
+type ItemsResponse struct {
+	ItemID int          `json:"item_id"`
+	Items  []store.Item `json:"items"`
+}
+
+type FeedbackRequest struct {
+	UserID     string `json:"user_id"`
+	ItemID     int    `json:"item_id" binding:"required"`
+	ActionType string `json:"action_type" binding:"required"`
+	Query      string `json:"query"`
+}
+
+// services bundles the pipeline stages shared by all handlers. Every stage
+// must be safe for concurrent use: gin serves each request on its own goroutine.
+type services struct {
+	store   *store.Service
+	recall  *recall.Service
+	dedup   *dedup.Service
+	seen    *dedup.SeenFilter
+	promo   *promo.Service
+	merch   *merch.Service
+	metrics *serverMetrics
+	tracer  *trace.Tracer
+
+	// The ranking stages are versioned and swapped atomically on reload
+	current    atomic.Pointer[pipeline]
+	previous   atomic.Pointer[pipeline] // For rollback
+	reloadMu   sync.Mutex
+	loadConfig func() (*config.Config, error) // Reads the configuration again on reload
+}
+
+// newServices wires the pipeline over an open database. cfg must be valid;
+// reloads reuse it until loadConfig is replaced.
+func newServices(db *sql.DB, cfg *config.Config) (*services, error) {
+	storeService := store.NewService(db)
+	recallService := recall.NewService(storeService)
+	recallService.SetHybrid(cfg.Recall.Hybrid)
+	recallService.GetANNRecaller().SetHybridConfig(cfg.Recall.HybridAlpha.Recall())
+	recallService.SetLimits(cfg.Recall.Limits)
+	dedupService := dedup.NewService()
+	dedupService.SetNearDupConfig(cfg.Dedup.NearDup)
+	dedupService.SetEmbeddingLookup(recallService.GetANNRecaller().Embedding)
+
+	p, err := buildPipeline(cfg, recallService.GetANNRecaller().Embedding)
+	if err != nil {
+		return nil, err
+	}
+	p.Version, p.Source = 1, "startup"
+	tracer, err := newTracer(cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	svc := &services{
+		store:      storeService,
+		recall:     recallService,
+		dedup:      dedupService,
+		seen:       dedup.NewSeenFilter(cfg.Dedup.Seen.Filter(), storeService),
+		promo:      promo.NewService(storeService),
+		merch:      merch.NewService(storeService),
+		tracer:     tracer,
+		loadConfig: func() (*config.Config, error) { return cfg, nil },
+	}
+	svc.current.Store(p)
+	svc.metrics = newServerMetrics(svc)
+	return svc, nil
+}
+
+// pipeline returns the active version of the ranking stages
+func (s *services) pipeline() *pipeline {
+	return s.current.Load()
 }
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize database
-	db, err := store.InitDB("./data/vibers.db")
+	db, err := store.InitDB(cfg.Server.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
 	// Initialize services
-	storeService := store.NewService(db)
-	recallService := recall.NewService(storeService)
-	dedupService := dedup.NewService()
-	coarseRanker := coarse.NewRanker()
-	ltrRanker := ltr.NewRanker()
-	finalRanker := final.NewRanker()
+	svc, err := newServices(db, cfg)
+	if err != nil {
+		log.Fatalf("Failed to build ranking pipeline: %v", err)
+	}
+	svc.loadConfig = func() (*config.Config, error) { return config.Load(os.Args[1:], os.LookupEnv) }
+	go svc.watchFiles(nil)
+	if err := svc.merch.Load(); err != nil {
+		log.Fatalf("Failed to load query rules: %v", err)
+	}
+	go svc.seen.Run(cfg.Dedup.Seen.FlushInterval.Duration, nil)
+
+	log.Printf("API server starting on %s", cfg.Server.Addr)
+	if err := newRouter(svc).Run(cfg.Server.Addr); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
 
-	r := gin.Default()
+// newRouter registers the HTTP handlers
+func newRouter(svc *services) *gin.Engine {
+	storeService, recallService, dedupService := svc.store, svc.recall, svc.dedup
+
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.Use(gin.Logger(), gin.CustomRecovery(recoverPanic))
+	r.Use(svc.traceRequests, svc.metrics.middleware)
+	r.NoRoute(func(c *gin.Context) {
+		abortError(c, http.StatusNotFound, codeNotFound, "no route for %s %s", c.Request.Method, c.Request.URL.Path)
+	})
+	r.NoMethod(func(c *gin.Context) {
+		abortError(c, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method %s not allowed on %s", c.Request.Method, c.Request.URL.Path)
+	})
 
 	r.POST("/search", func(c *gin.Context) {
+		started := time.Now()
 		var req SearchRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			log.Printf("JSON binding error: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+			return
+		}
+		order, err := rank.ParseSortOrder(req.Sort)
+		if err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidSort, "%v", err)
+			return
+		}
+		if err := req.Filters.Validate(); err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidFilters, "%v", err)
 			return
 		}
 
-		log.Printf("Search request: query='%s', page=%d", req.Query, req.Page)
+		// One version of the ranking stages serves the whole request
+		p := svc.pipeline()
+		if req.ExcludeSeen {
+			req.Page = nil
+		}
+		pageSize, ok := pagination(c, &req, p.cfg.Server)
+		if !ok {
+			return
+		}
+
+		log.Printf("Search request %s: query='%s', page=%d, page_size=%d, sort=%s, user='%s'", requestID(c), req.Query, *req.Page, pageSize, order, req.UserID)
+		ctx := c.Request.Context()
+		coarseRanker, ltrRanker, finalRanker := p.coarse, p.ltr, p.final
+
+		// Merchandising rules may redirect the query outright
+		plan := svc.merch.Match(req.Query)
+		if plan.Redirect != "" {
+			svc.logSearch(c, req, p, nil, 0, nil, plan.Redirect, started)
+			c.JSON(http.StatusOK, SearchResponse{
+				Items:      []store.Item{},
+				Page:       *req.Page,
+				PageSize:   pageSize,
+				Sort:       order,
+				QueryRules: plan.Rules,
+				Redirect:   plan.Redirect,
+			})
+			return
+		}
 
 		// Implement parallel recall
-		items, err := recallService.ParallelRecall(req.Query)
+		recallStage := svc.metrics.startStage(ctx, stageRecall)
+		recalled, err := recallService.ParallelRecall(recallStage.ctx, recall.Request{
+			Query:      req.Query,
+			UserID:     req.UserID,
+			Expansions: plan.Expansions,
+			Limits:     &p.cfg.Recall.Limits,
+			Filters:    req.Filters,
+			Observe:    svc.metrics.recaller,
+		})
 		if err != nil {
-			log.Printf("Parallel recall error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			recallStage.fail(err)
+			internalError(c, "Parallel recall", err)
 			return
 		}
+		items := plan.Filter(recalled.Items)
+		recallStage.end(len(items))
 
 		log.Printf("Parallel recall returned %d items", len(items))
 
-		// TODO: Implement deduplication
+		dedupStage := svc.metrics.startStage(ctx, stageDedup)
 		dedupedItems := dedupService.Deduplicate(items)
+		if req.ExcludeSeen {
+			dedupedItems = svc.seen.FilterUnseen(req.UserID, dedupedItems)
+		}
+		dedupStage.end(len(dedupedItems))
+
+		rankCtx := coarse.Context{Query: recalled.Query, UserID: req.UserID, Filter: recalled.Filters.Match}
+		coarseStage := svc.metrics.startStage(ctx, stageCoarse)
+		var coarseRanked []store.Item
+		if order == rank.SortRelevance {
+			coarseRanked = coarseRanker.RankWithContext(dedupedItems, rankCtx)
+		} else {
+			// An explicit sort must see every candidate passing the hard
+			// rules, not the keep_top best by coarse score
+			coarseRanked = coarseRanker.Filter(dedupedItems, rankCtx)
+		}
+		coarseStage.end(len(coarseRanked))
+		// Candidate budgets cut the result set short of everything matching
+		estimated := recalled.Truncated || (order == rank.SortRelevance && capped(len(coarseRanked), p.cfg.Coarse.KeepTop))
+
+		// Explicit sort orders arrange the coarse candidate set directly,
+		// without re-ranking, exploration or paid and pinned placements
+		var ranked final.Result
+		if order != rank.SortRelevance {
+			sortStage := svc.metrics.startStage(ctx, stageSort)
+			ranked.Items = rank.SortItems(coarseRanked, order)
+			sortStage.end(len(ranked.Items))
+		} else {
+			ltrStage := svc.metrics.startStage(ctx, stageLTR)
+			ltrRanked := ltrRanker.Rank(coarseRanked)
+			ltrStage.end(len(ltrRanked))
+			estimated = estimated || capped(len(ltrRanked), p.cfg.LTR.KeepTop)
+
+			// Items the user has seen too often sink or disappear
+			ltrRanked = svc.seen.Apply(req.UserID, ltrRanked)
+
+			// The final stage covers its inputs: exploration candidates,
+			// feedback and paid or pinned placements
+			finalStage := svc.metrics.startStage(ctx, stageFinal)
+
+			// Exploration candidates must pass the same hard rules. The
+			// seed keeps them, and the bandit's choice, the same on every
+			// page of the result set for the day.
+			day := started.UTC().Truncate(24 * time.Hour)
+			seed := explorationSeed(req.Query, req.UserID, day)
+			explore, err := recallService.ExplorationRecall(finalStage.ctx, p.cfg.Recall.ExplorationCandidates, recalled.Filters, seed)
+			if err != nil {
+				log.Printf("Exploration recall error: %v", err)
+			}
+			if req.ExcludeSeen {
+				explore = svc.seen.FilterUnseen(req.UserID, explore)
+			} else {
+				explore = svc.seen.Apply(req.UserID, explore)
+			}
+			explore = coarseRanker.RankWithContext(plan.Filter(explore), rankCtx)
+			// Feedback drives the bandit and the new-item exposure guarantee
+			feedbackIDs := make([]int, 0, len(explore)+len(ltrRanked))
+			for _, item := range explore {
+				feedbackIDs = append(feedbackIDs, item.ItemID)
+			}
+			for _, item := range ltrRanked {
+				feedbackIDs = append(feedbackIDs, item.ItemID)
+			}
+			feedback, err := storeService.WithContext(finalStage.ctx).GetItemFeedback(feedbackIDs)
+			if err != nil {
+				log.Printf("Feedback lookup error: %v", err)
+			}
+			// The bandit learns from exploration exposures only, and its
+			// posteriors refresh daily, so exposures logged for one page do
+			// not reshuffle the next
+			exploreIDs := feedbackIDs[:len(explore)]
+			banditFeedback, err := storeService.WithContext(finalStage.ctx).GetExplorationFeedback(exploreIDs, day)
+			if err != nil {
+				log.Printf("Feedback lookup error: %v", err)
+			}
+			placements, err := svc.promo.Placements(req.Query, ltrRanked)
+			if err != nil {
+				log.Printf("Promotions error: %v", err)
+			}
+			// Bans, the hard rules and the request's filters override paid
+			// placements too
+			var allowed []final.Placement
+			for _, p := range placements {
+				if !plan.Banned(p.Item.ItemID) && coarseRanker.Passes(&p.Item, &rankCtx) {
+					allowed = append(allowed, p)
+				}
+			}
+			pins, err := pinnedItems(storeService.WithContext(finalStage.ctx).WithFilter(recalled.Filters.ItemFilter()), plan)
+			if err != nil {
+				log.Printf("Pinned items error: %v", err)
+			}
+			ranked = finalRanker.RankRequest(final.Request{
+				Items:          ltrRanked,
+				Candidates:     explore,
+				Feedback:       feedback,
+				BanditFeedback: banditFeedback,
+				Sponsored:      allowed,
+				Pinned:         pins,
+				Boost:          plan.Boost,
+				Seed:           seed,
+				PageSize:       pageSize,
+			})
+			finalStage.end(len(ranked.Items))
+		}
+		finalRanked, decisions := ranked.Items, ranked.Exploration
+		if len(finalRanked) == 0 {
+			svc.metrics.zeroResult.Inc()
+		}
+		for _, v := range ranked.Violations {
+			svc.metrics.violations.Inc(v.Constraint)
+		}
 
-		// TODO: Implement three-stage ranking
-		coarseRanked := coarseRanker.Rank(dedupedItems)
-		ltrRanked := ltrRanker.Rank(coarseRanked)
-		finalRanked := finalRanker.Rank(ltrRanked)
+		// Pagination; results past the window are never served
+		reachable := min(len(finalRanked), p.cfg.Server.MaxResultWindow)
+		start := min((*req.Page-1)*pageSize, reachable)
+		end := min(start+pageSize, reachable)
 
-		// Pagination
-		pageSize := 20
-		start := (req.Page - 1) * pageSize
-		end := start + pageSize
-		if end > len(finalRanked) {
-			end = len(finalRanked)
+		// Only exploration slots actually served on this page are logged
+		var served []store.ExplorationDecision
+		for _, d := range decisions {
+			if d.Position > start && d.Position <= end {
+				served = append(served, d)
+			}
 		}
-		if start >= len(finalRanked) {
-			start = len(finalRanked)
+		if err := storeService.WithContext(ctx).LogExploration(req.Query, req.UserID, served); err != nil {
+			log.Printf("Exploration log error: %v", err)
 		}
 
+		// Sponsored impressions on this page count towards campaign pacing
+		var sponsored []final.SponsoredSlot
+		for _, s := range ranked.Sponsored {
+			if s.Position > start && s.Position <= end {
+				sponsored = append(sponsored, s)
+			}
+		}
+		if err := svc.promo.RecordImpressions(sponsored); err != nil {
+			log.Printf("Campaign pacing error: %v", err)
+		}
+
+		// Every served item counts as an impression for the seen-filter
+		pageIDs := make([]int, 0, end-start)
+		for _, item := range finalRanked[start:end] {
+			pageIDs = append(pageIDs, item.ItemID)
+		}
+		svc.seen.RecordImpressions(req.UserID, pageIDs)
+		svc.logSearch(c, req, p, pageIDs, len(finalRanked), recalled.Relaxation, "", started)
+
 		response := SearchResponse{
-			Items:   finalRanked[start:end],
-			Total:   len(finalRanked),
-			Page:    req.Page,
-			HasNext: end < len(finalRanked),
+			Items:          finalRanked[start:end],
+			Total:          len(finalRanked),
+			TotalEstimated: estimated,
+			Page:           *req.Page,
+			PageSize:       pageSize,
+			Sort:           order,
+			HasNext:        end < reachable,
+			Exploration:    served,
+			Sponsored:      sponsored,
+			QueryRules:     plan.Rules,
+			Relaxation:     recalled.Relaxation,
+		}
+		if !recalled.Filters.Empty() {
+			response.Filters = &recalled.Filters
 		}
 
 		c.JSON(http.StatusOK, response)
 	})
 
-	log.Println("API server starting on :8080")
-	r.Run(":8080")
+	r.POST("/feedback", func(c *gin.Context) {
+		var req FeedbackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+			return
+		}
+		if !store.ValidActionType(req.ActionType) {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "unknown action_type")
+			return
+		}
+
+		if err := storeService.WithContext(c.Request.Context()).RecordAction(req.UserID, req.ItemID, req.ActionType, req.Query); err != nil {
+			internalError(c, "Record action", err)
+			return
+		}
+		if req.ActionType == store.ActionView {
+			svc.seen.RecordImpressions(req.UserID, []int{req.ItemID})
+		} else {
+			svc.seen.RecordClick(req.UserID, req.ItemID)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	r.GET("/items/:id/related", func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "invalid item id")
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 || limit > 100 {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be between 1 and 100")
+			return
+		}
+
+		items, err := recallService.GetCFRecaller().RelatedRecall(itemID, limit)
+		if err != nil {
+			internalError(c, "Related items", err)
+			return
+		}
+		if items == nil {
+			items = []store.Item{}
+		}
+
+		c.JSON(http.StatusOK, ItemsResponse{ItemID: itemID, Items: items})
+	})
+
+	r.GET("/items/:id/similar", func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "invalid item id")
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 || limit > 100 {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be between 1 and 100")
+			return
+		}
+
+		opts := recall.SimilarOptions{
+			Space: c.Query("space"),
+			Brand: c.Query("brand"),
+		}
+		if opts.Brand != recall.BrandAny && opts.Brand != recall.BrandSame && opts.Brand != recall.BrandDifferent {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "brand must be same or different")
+			return
+		}
+		if band := c.Query("price_band"); band != "" {
+			opts.PriceBand, err = strconv.ParseFloat(band, 64)
+			if err != nil || opts.PriceBand <= 0 || opts.PriceBand > 1 {
+				abortError(c, http.StatusBadRequest, codeInvalidRequest, "price_band must be in (0, 1]")
+				return
+			}
+		}
+		if inStock := c.Query("in_stock"); inStock != "" {
+			opts.InStockOnly, err = strconv.ParseBool(inStock)
+			if err != nil {
+				abortError(c, http.StatusBadRequest, codeInvalidRequest, "in_stock must be a boolean")
+				return
+			}
+		}
+
+		items, err := recallService.GetANNRecaller().SimilarItems(itemID, opts, limit)
+		if errors.Is(err, recall.ErrUnknownSpace) {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+			return
+		}
+		if errors.Is(err, recall.ErrNoEmbedding) {
+			abortError(c, http.StatusNotFound, codeNotFound, "%v", err)
+			return
+		}
+		if err != nil {
+			internalError(c, "Similar items", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, ItemsResponse{ItemID: itemID, Items: items})
+	})
+
+	r.GET("/admin/query-rules", func(c *gin.Context) {
+		rules := svc.merch.Rules()
+		if rules == nil {
+			rules = []merch.Rule{}
+		}
+		c.JSON(http.StatusOK, gin.H{"rules": rules})
+	})
+
+	r.POST("/admin/query-rules", func(c *gin.Context) {
+		var rule merch.Rule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+			return
+		}
+		created, err := svc.merch.Create(rule)
+		if err != nil {
+			queryRuleError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	})
+
+	r.PUT("/admin/query-rules/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "invalid rule id")
+			return
+		}
+		var rule merch.Rule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+			return
+		}
+		updated, err := svc.merch.Update(id, rule)
+		if err != nil {
+			queryRuleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+
+	r.DELETE("/admin/query-rules/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			abortError(c, http.StatusBadRequest, codeInvalidRequest, "invalid rule id")
+			return
+		}
+		if err := svc.merch.Delete(id); err != nil {
+			queryRuleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	r.GET("/metrics", gin.WrapH(svc.metrics.registry))
+
+	r.GET("/admin/config", func(c *gin.Context) {
+		c.JSON(http.StatusOK, svc.pipeline().cfg)
+	})
+
+	r.GET("/admin/pipeline", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"active": svc.pipeline(), "previous": svc.previous.Load()})
+	})
+
+	r.POST("/admin/reload", func(c *gin.Context) {
+		p, err := svc.reload("api")
+		if err != nil {
+			abortErrorDetails(c, http.StatusUnprocessableEntity, codeReloadFailed, gin.H{"active": svc.pipeline()}, "%v", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"active": p})
+	})
+
+	r.POST("/admin/rollback", func(c *gin.Context) {
+		p, err := svc.rollback()
+		if err != nil {
+			abortError(c, http.StatusConflict, codeConflict, "%v", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"active": p})
+	})
+
+	r.GET("/admin/rules", func(c *gin.Context) {
+		rules := svc.pipeline().coarse.Rules()
+		c.JSON(http.StatusOK, gin.H{
+			"source":    rules.Source(),
+			"loaded_at": rules.LoadedAt(),
+			"rules":     rules.Stats(),
+		})
+	})
+
+	return r
+}
+
+// logSearch records a served search in the search log
+func (s *services) logSearch(c *gin.Context, req SearchRequest, p *pipeline, pageIDs []int, results int, rel *recall.Relaxation, redirect string, started time.Time) {
+	entry := store.SearchLogEntry{
+		RequestID:   requestID(c),
+		Query:       req.Query,
+		NormQuery:   analytics.NormalizeQuery(req.Query),
+		Filters:     s.recall.GetAttrRecaller().QueryFilters(req.Query),
+		UserID:      req.UserID,
+		SessionID:   req.SessionID,
+		Page:        *req.Page,
+		ResultCount: results,
+		TopIDs:      pageIDs,
+		Latency:     time.Since(started),
+		Arm:         p.arm(),
+		Redirect:    redirect,
+	}
+	// Explicit filters replace those parsed from the query
+	for name, value := range req.Filters.Fields() {
+		entry.Filters[name] = value
+	}
+	if rel != nil {
+		entry.Relaxation = rel.Steps
+	}
+	if err := s.store.WithContext(c.Request.Context()).LogSearch(entry); err != nil {
+		log.Printf("Search log error: %v", err)
+	}
+}
+
+// pinnedItems loads the in-stock items pinned by a query rule plan that
+// pass the store's filter
+func pinnedItems(storeService *store.Service, plan *merch.Plan) ([]final.Pin, error) {
+	ids := plan.PinnedIDs()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	items, err := storeService.GetItemsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]store.Item, len(items))
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	var pins []final.Pin
+	for _, pin := range plan.Pins {
+		if item, ok := byID[pin.ItemID]; ok && item.Stock > 0 && !plan.Banned(pin.ItemID) {
+			pins = append(pins, final.Pin{Item: item, Position: pin.Position})
+		}
+	}
+	return pins, nil
+}
+
+// pagination resolves the page and page size of a search, setting req.Page
+// and ending the request with a 400 when either is out of bounds
+func pagination(c *gin.Context, req *SearchRequest, cfg config.ServerConfig) (int, bool) {
+	if req.Page == nil {
+		first := 1
+		req.Page = &first
+	}
+	page := *req.Page
+	if page < 1 {
+		abortError(c, http.StatusBadRequest, codeInvalidPage, "page must be at least 1, got %d", page)
+		return 0, false
+	}
+	pageSize := req.PageSize
+	if pageSize == 0 {
+		pageSize = cfg.PageSize
+	}
+	if pageSize < cfg.MinPageSize || pageSize > cfg.MaxPageSize {
+		abortError(c, http.StatusBadRequest, codeInvalidPageSize, "page_size must be between %d and %d, got %d",
+			cfg.MinPageSize, cfg.MaxPageSize, pageSize)
+		return 0, false
+	}
+	// A page partly inside the window serves its reachable results
+	if (page-1)*pageSize >= cfg.MaxResultWindow {
+		abortErrorDetails(c, http.StatusBadRequest, codeResultWindow, gin.H{"max_result_window": cfg.MaxResultWindow},
+			"page %d of size %d reaches past the first %d results", page, pageSize, cfg.MaxResultWindow)
+		return 0, false
+	}
+	return pageSize, true
+}
+
+// explorationSeed keys exploration to the query, the user and the day, so
+// every page of a result set serves the same exploration items while
+// exploration still rotates from one day to the next
+func explorationSeed(query, userID string, day time.Time) int64 {
+	h := fnv.New64a()
+	for _, part := range []string{query, userID, day.Format("2006-01-02")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return int64(h.Sum64() | 1) // Never 0, which means unseeded
+}
+
+// capped reports whether a stage returned as many candidates as its budget
+// allows, so more may have qualified
+func capped(n, keepTop int) bool {
+	return keepTop > 0 && n >= keepTop
+}
+
+// queryRuleError maps query rule service errors to HTTP responses
+func queryRuleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, merch.ErrInvalidRule):
+		abortError(c, http.StatusBadRequest, codeInvalidRequest, "%v", err)
+	case errors.Is(err, merch.ErrRuleNotFound):
+		abortError(c, http.StatusNotFound, codeNotFound, "%v", err)
+	default:
+		internalError(c, "Query rule", err)
+	}
 }
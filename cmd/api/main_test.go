@@ -0,0 +1,797 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/config"
+	"github.com/Boomshakalak/VibeRS/internal/merch"
+	"github.com/Boomshakalak/VibeRS/internal/rank"
+	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
+	"github.com/Boomshakalak/VibeRS/internal/rank/final"
+	"github.com/Boomshakalak/VibeRS/internal/recall"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+	"github.com/Boomshakalak/VibeRS/internal/trace"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer serves the real pipeline over a small temporary catalogue
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	return newRouter(newTestServices(t, newTestDB(t)))
+}
+
+// newTestServices wires the pipeline with the default configuration
+func newTestServices(t *testing.T, db *sql.DB) *services {
+	t.Helper()
+	svc, err := newServices(db, config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+// newTestDB creates a temporary database with 120 items
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dsn := filepath.Join(t.TempDir(), "api_test.db") + "?_busy_timeout=5000"
+	db, err := store.InitDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE items (
+		item_id INTEGER PRIMARY KEY,
+		title TEXT,
+		brand TEXT,
+		price_cents INTEGER,
+		discount REAL,
+		rating REAL,
+		stock INTEGER,
+		launched_at DATETIME,
+		click_7d INTEGER,
+		buy_7d INTEGER,
+		gmv_30d INTEGER,
+		embedding BLOB
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brands := []string{"Chanel", "Gucci", "Hermès", "Prada", "Dior"}
+	kinds := []string{"Tote Bag", "Shoulder Bag", "Wallet", "Clutch", "Backpack", "Belt"}
+	colors := []string{"Black", "Ivory", "Crimson", "Navy", "Olive", "Camel", "Blush"}
+	for i := 1; i <= 120; i++ {
+		brand := brands[i%len(brands)]
+		_, err := db.Exec(`INSERT INTO items VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, NULL)`,
+			i, fmt.Sprintf("%s %s %s", brand, colors[i%len(colors)], kinds[i%len(kinds)]), brand,
+			50000+i*1000, 3.5+float64(i%4)*0.4, 1+i%3,
+			fmt.Sprintf("2024-%02d-01 00:00:00", 1+i%12), i%50, i%7, i*100)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// pageOf returns a SearchRequest page number
+func pageOf(n int) *int {
+	return &n
+}
+
+func postJSON(t *testing.T, h http.Handler, path string, body interface{}) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TestSearchConcurrent hammers the search handler from many goroutines.
+// Run with -race to catch shared state in the pipeline.
+func TestSearchConcurrent(t *testing.T) {
+	h := newTestServer(t)
+	queries := []string{"", "chanel", "gucci wallet", "black leather tote for work", "bag"}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				req := SearchRequest{
+					Query:       queries[(g+i)%len(queries)],
+					Page:        pageOf(1 + i%2),
+					UserID:      fmt.Sprintf("user-%d", g%4),
+					ExcludeSeen: i%3 == 0,
+				}
+				if w := postJSON(t, h, "/search", req); w.Code != http.StatusOK {
+					t.Errorf("search %+v: status %d: %s", req, w.Code, w.Body.String())
+				}
+				fb := FeedbackRequest{UserID: req.UserID, ItemID: 1 + (g*10+i)%120, ActionType: store.ActionClick}
+				if w := postJSON(t, h, "/feedback", fb); w.Code != http.StatusOK {
+					t.Errorf("feedback: status %d: %s", w.Code, w.Body.String())
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestSearchExcludeSeen(t *testing.T) {
+	h := newTestServer(t)
+
+	served := make(map[int]bool)
+	for call := 0; call < 3; call++ {
+		w := postJSON(t, h, "/search", SearchRequest{Query: "bag", UserID: "alice", ExcludeSeen: true})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Items) == 0 {
+			t.Fatalf("call %d returned no items", call)
+		}
+		for _, item := range resp.Items {
+			if served[item.ItemID] {
+				t.Fatalf("call %d served item %d again", call, item.ItemID)
+			}
+			served[item.ItemID] = true
+		}
+	}
+}
+
+func TestSearchExplorationStable(t *testing.T) {
+	h := newTestServer(t)
+
+	exploration := func(page int) []store.ExplorationDecision {
+		w := postJSON(t, h, "/search", SearchRequest{Query: "bag", Page: pageOf(page)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Exploration
+	}
+	first := exploration(1)
+	if len(first) == 0 {
+		t.Fatal("no exploration slots served")
+	}
+	exploration(2)
+	if again := exploration(1); !reflect.DeepEqual(first, again) {
+		t.Errorf("page 1 exploration changed between requests: %+v, then %+v", first, again)
+	}
+}
+
+func TestBanditIgnoresOrganicPopularity(t *testing.T) {
+	st := store.NewService(newTestDB(t))
+	// Item 1 is popular organically but was explored twice, once clicked;
+	// item 2 was never explored
+	for i := 0; i < 30; i++ {
+		for _, action := range []string{store.ActionView, store.ActionClick, store.ActionBuy} {
+			if err := st.RecordAction(fmt.Sprintf("u%d", i), 1, action, "bag"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exposure := []store.ExplorationDecision{{ItemID: 1, Position: 5, Policy: final.PolicyUCB}}
+	for _, user := range []string{"alice", "bob"} {
+		if err := st.LogExploration("bag", user, exposure); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.RecordAction("alice", 1, store.ActionClick, "bag"); err != nil {
+		t.Fatal(err)
+	}
+
+	feedback, err := st.GetExplorationFeedback([]int{1, 2}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (map[int]store.ItemFeedback{1: {Impressions: 2, Clicks: 1}}); !reflect.DeepEqual(feedback, want) {
+		t.Fatalf("exploration feedback = %+v, want %+v", feedback, want)
+	}
+
+	r := final.NewRanker()
+	r.SetExploration(20, []int{1}, final.PolicyUCB)
+	var items []store.Item
+	for id := 10; id < 15; id++ {
+		items = append(items, store.Item{ItemID: id, Brand: fmt.Sprint(id), Rating: 4, Stock: 1})
+	}
+	res := r.RankRequest(final.Request{Items: items, Candidates: []store.Item{{ItemID: 1}, {ItemID: 2}}, BanditFeedback: feedback})
+	if len(res.Exploration) != 1 || res.Exploration[0].ItemID != 2 {
+		t.Errorf("exploration = %+v, want the unexplored item 2", res.Exploration)
+	}
+}
+
+func TestRelatedItems(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`INSERT INTO item_similarity (item_id, related_id, score, co_count)
+		VALUES (1, 2, 0.9, 9), (1, 3, 0.8, 8), (1, 4, 0.5, 5), (2, 1, 0.9, 9)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE items SET stock = 0 WHERE item_id = 3`); err != nil {
+		t.Fatal(err)
+	}
+	h := newRouter(newTestServices(t, db))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/1/related?limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp ItemsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, item := range resp.Items {
+		ids = append(ids, item.ItemID)
+	}
+	// Item 3 is out of stock; the limit applies after skipping it
+	if !reflect.DeepEqual(ids, []int{2, 4}) {
+		t.Errorf("related items = %v, want [2 4]", ids)
+	}
+
+	for _, path := range []string{"/items/x/related", "/items/1/related?limit=0"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", path, w.Code)
+		}
+	}
+}
+
+func TestSearchConstraints(t *testing.T) {
+	cfg := config.Default()
+	cfg.Final.Constraints = []final.ConstraintSpec{{
+		Name: "entry_price", Kind: final.ConstraintAtPositions, Positions: []int{1, 2},
+		Match: final.MatchSpec{PriceBelow: 60000},
+	}}
+	svc, err := newServices(newTestDB(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := postJSON(t, newRouter(svc), "/search", SearchRequest{Query: "bag"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) < 2 || resp.Items[0].PriceCents >= 60000 || resp.Items[1].PriceCents >= 60000 {
+		t.Errorf("positions 1 and 2 not entry-priced: %+v", resp.Items[:min(2, len(resp.Items))])
+	}
+}
+
+func TestSearchConstraintViolationsCounted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Final.Constraints = []final.ConstraintSpec{{
+		Name: "penny_price", Kind: final.ConstraintAtPositions, Positions: []int{1},
+		Match: final.MatchSpec{PriceBelow: 1},
+	}}
+	svc, err := newServices(newTestDB(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newRouter(svc)
+	for i := 0; i < 2; i++ {
+		if w := postJSON(t, h, "/search", SearchRequest{Query: "bag"}); w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `vibers_ranking_constraint_violations_total{constraint="penny_price"} 2`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("metrics missing %q", want)
+	}
+}
+
+func TestSearchSponsored(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`INSERT INTO campaigns (campaign_id, name, target_brands, placement, positions, daily_cap)
+		VALUES (1, 'Gucci spring', 'Gucci', 'fixed', '3', 1000)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO campaign_items (campaign_id, item_id, rank) VALUES (1, 6, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	h := newRouter(newTestServices(t, db))
+
+	w := postJSON(t, h, "/search", SearchRequest{Query: "gucci wallet", UserID: "bob"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sponsored) != 1 || resp.Sponsored[0].Position != 3 || resp.Sponsored[0].ItemID != 6 {
+		t.Fatalf("sponsored = %+v, want item 6 at position 3", resp.Sponsored)
+	}
+	for i, item := range resp.Items {
+		if item.Sponsored != (i == 2) || (item.ItemID == 6) != (i == 2) {
+			t.Errorf("position %d: item %d sponsored=%v", i+1, item.ItemID, item.Sponsored)
+		}
+	}
+
+	var served int
+	if err := db.QueryRow(`SELECT impressions FROM campaign_impressions WHERE campaign_id = 1`).Scan(&served); err != nil || served != 1 {
+		t.Errorf("impressions = %d (%v), want 1", served, err)
+	}
+}
+
+func TestSearchSponsoredPassesHardRules(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`INSERT INTO campaigns (campaign_id, name, target_brands, placement, positions, daily_cap)
+		VALUES (1, 'Gucci spring', 'Gucci', 'fixed', '3', 1000)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Item 6 is rated below min_rating
+	if _, err := db.Exec(`INSERT INTO campaign_items (campaign_id, item_id, rank) VALUES (1, 6, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE items SET rating = 2 WHERE item_id = 6`); err != nil {
+		t.Fatal(err)
+	}
+	h := newRouter(newTestServices(t, db))
+
+	w := postJSON(t, h, "/search", SearchRequest{Query: "gucci wallet"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sponsored) != 0 {
+		t.Errorf("sponsored = %+v, want the low-rated item left out", resp.Sponsored)
+	}
+	for _, item := range resp.Items {
+		if item.ItemID == 6 {
+			t.Errorf("low-rated item 6 served")
+		}
+	}
+}
+
+func TestSearchQueryRules(t *testing.T) {
+	h := newTestServer(t)
+	rules := []merch.Rule{
+		{Name: "gucci_pins", Match: merch.MatchContains, Query: "gucci", Pins: []merch.Pin{{ItemID: 2, Position: 1}}, Bans: []int{6}},
+		{Name: "sale", Match: merch.MatchExact, Query: "sale", Redirect: "/sale"},
+	}
+	for _, rule := range rules {
+		if w := postJSON(t, h, "/admin/query-rules", rule); w.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", rule.Name, w.Code, w.Body.String())
+		}
+	}
+	if w := postJSON(t, h, "/admin/query-rules", merch.Rule{Name: "bad", Match: "regex", Query: "x"}); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid rule: status %d, want 400", w.Code)
+	}
+
+	search := func(q string) SearchResponse {
+		w := postJSON(t, h, "/search", SearchRequest{Query: q})
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %q: status %d: %s", q, w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := search("gucci wallet")
+	if len(resp.Items) == 0 || resp.Items[0].ItemID != 2 {
+		t.Fatalf("first item = %+v, want pinned item 2", resp.Items)
+	}
+	for _, item := range resp.Items {
+		if item.ItemID == 6 {
+			t.Errorf("banned item 6 served")
+		}
+	}
+	if len(resp.QueryRules) != 1 || resp.QueryRules[0] != "gucci_pins" {
+		t.Errorf("query_rules = %v", resp.QueryRules)
+	}
+	if resp := search("Sale"); resp.Redirect != "/sale" || len(resp.Items) != 0 {
+		t.Errorf("redirect = %q with %d items", resp.Redirect, len(resp.Items))
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/query-rules/99", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("delete unknown rule: status %d, want 404", w.Code)
+	}
+}
+
+func TestReloadCanaryAndRollback(t *testing.T) {
+	svc := newTestServices(t, newTestDB(t))
+	h := newRouter(svc)
+	search := func() SearchResponse {
+		w := postJSON(t, h, "/search", SearchRequest{Query: "bag"})
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	small := config.Default()
+	small.Server.PageSize = 10
+	small.Final.Freshness.ExposureSlots = []int{10}
+	small.Final.ExplorationSlots = []int{5}
+	svc.loadConfig = func() (*config.Config, error) { return small, nil }
+	before := svc.pipeline().coarse.Rules().Stats()
+	if w := postJSON(t, h, "/admin/reload", nil); w.Code != http.StatusOK {
+		t.Fatalf("reload: status %d: %s", w.Code, w.Body.String())
+	}
+	// Canary rankings leave the rule counters of the old version alone
+	if after := svc.previous.Load().coarse.Rules().Stats(); !reflect.DeepEqual(after, before) {
+		t.Errorf("canary changed rule counters from %v to %v", before, after)
+	}
+	if got := len(search().Items); got != 10 {
+		t.Errorf("after reload: %d items per page, want 10", got)
+	}
+
+	// A version filtering out everything fails the canary and is not activated
+	broken := config.Default()
+	broken.Coarse.Rules = append(broken.Coarse.Rules, coarse.RuleSpec{
+		Name: "impossible", When: coarse.CondSpec{Field: "rating", Op: ">", Value: 5.0},
+	})
+	svc.loadConfig = func() (*config.Config, error) { return broken, nil }
+	if w := postJSON(t, h, "/admin/reload", nil); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("broken reload: status %d, want 422", w.Code)
+	}
+	if v := svc.pipeline().Version; v != 2 {
+		t.Errorf("active version %d after failed reload, want 2", v)
+	}
+
+	if w := postJSON(t, h, "/admin/rollback", nil); w.Code != http.StatusOK {
+		t.Fatalf("rollback: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := len(search().Items); got != 20 {
+		t.Errorf("after rollback: %d items per page, want 20", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	h := newTestServer(t)
+	if w := postJSON(t, h, "/search", SearchRequest{Query: "bag", UserID: "alice"}); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	postJSON(t, h, "/search", SearchRequest{Query: "zzzz-no-match"})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`vibers_http_requests_total{route="/search",code="200"} 2`,
+		`vibers_http_request_duration_seconds_count{route="/search"} 2`,
+		`vibers_stage_duration_seconds_count{stage="final"} 2`,
+		`vibers_recall_duration_seconds_count{recaller="text"}`,
+		`vibers_stage_candidates{stage="coarse"}`,
+		`vibers_cache_hit_ratio{cache="seen_filter"}`,
+		"vibers_ann_index_size ",
+		"# TYPE vibers_search_zero_results_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestSearchRequestIDAndTrace(t *testing.T) {
+	svc := newTestServices(t, newTestDB(t))
+	var traces bytes.Buffer
+	svc.tracer = trace.NewTracer(&traces, "test")
+	h := newRouter(svc)
+
+	w := postJSON(t, h, "/search", SearchRequest{Query: "bag"})
+	generated := w.Header().Get(requestIDHeader)
+	if len(generated) != 32 {
+		t.Fatalf("generated request ID %q", generated)
+	}
+
+	data, _ := json.Marshal(SearchRequest{Query: "bag"})
+	req := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(data))
+	req.Header.Set(requestIDHeader, "client-42")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get(requestIDHeader); got != "client-42" {
+		t.Errorf("request ID = %q, want the client's", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(traces.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("exported %d traces, want 2", len(lines))
+	}
+	for _, name := range []string{`"POST /search"`, `"recall"`, `"recall.text"`, `"sql.query"`, `"dedup"`, `"coarse"`, `"ltr"`, `"final"`, `"client-42"`} {
+		if !strings.Contains(lines[1], name) {
+			t.Errorf("trace missing %s", name)
+		}
+	}
+	if !strings.Contains(lines[0], generated) {
+		t.Error("generated request ID is not the trace ID")
+	}
+}
+
+func TestSearchLog(t *testing.T) {
+	db := newTestDB(t)
+	h := newRouter(newTestServices(t, db))
+
+	w := postJSON(t, h, "/search", SearchRequest{Query: "  Chanel  BAG ", UserID: "alice", SessionID: "s1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var requestID, norm, filters, session, topIDs, arm string
+	var results int
+	err := db.QueryRow(`SELECT request_id, norm_query, filters, session_id, result_count, top_ids, arm FROM search_log`).
+		Scan(&requestID, &norm, &filters, &session, &results, &topIDs, &arm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestID != w.Header().Get(requestIDHeader) || norm != "chanel bag" || filters != `{"brand":"Chanel"}` ||
+		session != "s1" || results != resp.Total || arm != "v1" {
+		t.Errorf("logged %q %q %q %q %d %q, response total %d", requestID, norm, filters, session, results, arm, resp.Total)
+	}
+	if want := fmt.Sprint(resp.Items[0].ItemID); !strings.HasPrefix(topIDs, want+",") {
+		t.Errorf("top_ids = %q, want page IDs starting with %s", topIDs, want)
+	}
+}
+
+func TestSearchRelaxation(t *testing.T) {
+	db := newTestDB(t)
+	h := newRouter(newTestServices(t, db))
+
+	search := func(q string) SearchResponse {
+		t.Helper()
+		w := postJSON(t, h, "/search", SearchRequest{Query: q})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Every item costs more than $500
+	resp := search("chanel wallet under $100")
+	rel := resp.Relaxation
+	if rel == nil || rel.Query != "chanel wallet" || len(rel.RemovedFilters) != 1 || rel.RemovedFilters[0] != "price" ||
+		rel.Message != `Showing results for "chanel wallet", price filter removed` {
+		t.Fatalf("relaxation = %+v", rel)
+	}
+	if want := search("chanel wallet").Total; resp.Total != want {
+		t.Errorf("total = %d, want the %d results of the relaxed query", resp.Total, want)
+	}
+
+	rel = search("chanle wallet").Relaxation
+	if rel == nil || rel.Corrections["chanle"] != "chanel" || rel.Steps[len(rel.Steps)-1] != recall.RelaxSpelling {
+		t.Errorf("relaxation = %+v", rel)
+	}
+
+	// Satisfiable filters are kept and nothing is relaxed
+	resp = search("chanel wallet under $1000")
+	if resp.Relaxation != nil || len(resp.Items) == 0 {
+		t.Fatalf("relaxation = %+v with %d items", resp.Relaxation, len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		if item.PriceCents > 100000 {
+			t.Errorf("item %d costs %d cents, over the $1000 filter", item.ItemID, item.PriceCents)
+		}
+	}
+
+	// Relaxed searches count as zero-result searches in the log
+	var relaxation string
+	if err := db.QueryRow(`SELECT relaxation FROM search_log WHERE query = 'chanel wallet under $100'`).Scan(&relaxation); err != nil {
+		t.Fatal(err)
+	}
+	if relaxation != recall.RelaxFilters {
+		t.Errorf("logged relaxation %q", relaxation)
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	h := newTestServer(t)
+
+	var prices []int
+	for page := 1; page <= 2; page++ {
+		w := postJSON(t, h, "/search", SearchRequest{Query: "bag", Page: pageOf(page), Sort: "price_asc"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Sort != rank.SortPriceAsc || len(resp.Exploration) > 0 || len(resp.Sponsored) > 0 {
+			t.Errorf("page %d: sort %q with %d exploration and %d sponsored slots", page, resp.Sort, len(resp.Exploration), len(resp.Sponsored))
+		}
+		for _, item := range resp.Items {
+			prices = append(prices, item.PriceCents)
+		}
+	}
+	if len(prices) == 0 || !sort.IntsAreSorted(prices) {
+		t.Errorf("prices across pages not ascending: %v", prices)
+	}
+
+	if w := postJSON(t, h, "/search", SearchRequest{Query: "bag", Sort: "cheapest"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown sort: status %d", w.Code)
+	}
+}
+
+func TestSearchSortIgnoresCoarseBudget(t *testing.T) {
+	cfg := config.Default()
+	cfg.Coarse.KeepTop = 5
+	svc, err := newServices(newTestDB(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := postJSON(t, newRouter(svc), "/search", SearchRequest{Query: "bag", Sort: "price_asc"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total <= cfg.Coarse.KeepTop || resp.TotalEstimated {
+		t.Errorf("sorted total %d (estimated %v), want every matching bag past keep_top %d", resp.Total, resp.TotalEstimated, cfg.Coarse.KeepTop)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	h := newTestServer(t)
+
+	filters := recall.Filters{Brands: []string{"gucci", "Prada"}, MinPriceCents: 60000, MaxPriceCents: 150000, MinRating: 4}
+	// The explicit price range replaces "under $700" from the query
+	w := postJSON(t, h, "/search", SearchRequest{Query: "bag under $700", Filters: filters})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) == 0 {
+		t.Fatal("no results")
+	}
+	for _, item := range resp.Items {
+		if !filters.Match(item) {
+			t.Errorf("item %d (%s, %d cents, rating %v) fails the filters", item.ItemID, item.Brand, item.PriceCents, item.Rating)
+		}
+	}
+	if resp.Filters == nil || resp.Filters.MaxPriceCents != 150000 || len(resp.Filters.Brands) != 2 {
+		t.Errorf("echoed filters = %+v", resp.Filters)
+	}
+
+	// Filters alone browse the catalog
+	w = postJSON(t, h, "/search", SearchRequest{Filters: recall.Filters{Brands: []string{"Dior"}}})
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) == 0 {
+		t.Error("browsing by brand returned nothing")
+	}
+	for _, item := range resp.Items {
+		if item.Brand != "Dior" {
+			t.Errorf("browse returned %s item %d", item.Brand, item.ItemID)
+		}
+	}
+
+	bad := recall.Filters{MinPriceCents: 2000, MaxPriceCents: 1000}
+	if w := postJSON(t, h, "/search", SearchRequest{Query: "bag", Filters: bad}); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid filters: status %d", w.Code)
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	h := newTestServer(t)
+
+	// An omitted page is the first page
+	w := postJSON(t, h, "/search", SearchRequest{Query: "bag", PageSize: 5})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Page != 1 || resp.PageSize != 5 || len(resp.Items) != 5 || !resp.HasNext {
+		t.Errorf("page %d of size %d with %d items, has_next %v", resp.Page, resp.PageSize, len(resp.Items), resp.HasNext)
+	}
+
+	// Page 34 of 30 holds results 991-1000 of the 1000-result window
+	if w := postJSON(t, h, "/search", SearchRequest{Query: "bag", Page: pageOf(34), PageSize: 30}); w.Code != http.StatusOK {
+		t.Errorf("page straddling the window end: status %d: %s", w.Code, w.Body.String())
+	}
+
+	cases := []struct {
+		name string
+		req  SearchRequest
+		code string
+	}{
+		{"page past window end", SearchRequest{Query: "bag", Page: pageOf(35), PageSize: 30}, codeResultWindow},
+		{"zero page", SearchRequest{Query: "bag", Page: pageOf(0)}, codeInvalidPage},
+		{"negative page", SearchRequest{Query: "bag", Page: pageOf(-1)}, codeInvalidPage},
+		{"page size too large", SearchRequest{Query: "bag", PageSize: 1000}, codeInvalidPageSize},
+		{"negative page size", SearchRequest{Query: "bag", PageSize: -5}, codeInvalidPageSize},
+		{"past result window", SearchRequest{Query: "bag", Page: pageOf(51)}, codeResultWindow},
+		{"unknown sort", SearchRequest{Query: "bag", Sort: "cheapest"}, codeInvalidSort},
+	}
+	for _, tc := range cases {
+		w := postJSON(t, h, "/search", tc.req)
+		var body ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if w.Code != http.StatusBadRequest || body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s: status %d, error %+v", tc.name, w.Code, body.Error)
+		}
+		if body.Error.RequestID == "" || body.Error.RequestID != w.Header().Get(requestIDHeader) {
+			t.Errorf("%s: error request id %q, header %q", tc.name, body.Error.RequestID, w.Header().Get(requestIDHeader))
+		}
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	h := newTestServer(t)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/nowhere", http.StatusNotFound, codeNotFound},
+		{http.MethodGet, "/search", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{http.MethodGet, "/items/abc/similar", http.StatusBadRequest, codeInvalidRequest},
+		{http.MethodPost, "/admin/rollback", http.StatusConflict, codeConflict},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		var body ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		if w.Code != tc.status || body.Error.Code != tc.code {
+			t.Errorf("%s %s: status %d, error %+v", tc.method, tc.path, w.Code, body.Error)
+		}
+	}
+}
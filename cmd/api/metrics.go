@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Search stages timed and counted by serverMetrics
+const (
+	stageRecall = "recall"
+	stageDedup  = "dedup"
+	stageCoarse = "coarse"
+	stageLTR    = "ltr"
+	stageFinal  = "final"
+	stageSort   = "sort" // Replaces ltr and final for explicit sort orders
+)
+
+// serverMetrics are the metrics exposed on /metrics
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests   *metrics.Counter   // By route and status code
+	errors     *metrics.Counter   // 5xx responses by route
+	latency    *metrics.Histogram // End-to-end, by route
+	zeroResult *metrics.Counter
+	violations *metrics.Counter // Unsatisfied ranking constraints, by constraint
+
+	stageLatency     *metrics.Histogram
+	stageCandidates  *metrics.Gauge // After each stage, for the latest search
+	recallLatency    *metrics.Histogram
+	recallCandidates *metrics.Gauge // Per recaller, for the latest search
+}
+
+// newServerMetrics registers the server metrics. Gauges backed by the
+// services are read on every scrape.
+func newServerMetrics(svc *services) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:   r,
+		requests:   r.Counter("vibers_http_requests_total", "HTTP requests served.", "route", "code"),
+		errors:     r.Counter("vibers_http_errors_total", "HTTP requests that failed with a server error.", "route"),
+		latency:    r.Histogram("vibers_http_request_duration_seconds", "End-to-end HTTP request latency.", metrics.LatencyBuckets, "route"),
+		zeroResult: r.Counter("vibers_search_zero_results_total", "Searches that returned no results."),
+		violations: r.Counter("vibers_ranking_constraint_violations_total", "Searches whose final ranking left a constraint unsatisfied.", "constraint"),
+
+		stageLatency:     r.Histogram("vibers_stage_duration_seconds", "Search pipeline stage latency.", metrics.LatencyBuckets, "stage"),
+		stageCandidates:  r.Gauge("vibers_stage_candidates", "Candidates left after each stage in the latest search.", "stage"),
+		recallLatency:    r.Histogram("vibers_recall_duration_seconds", "Latency of each recaller.", metrics.LatencyBuckets, "recaller"),
+		recallCandidates: r.Gauge("vibers_recall_candidates", "Candidates returned by each recaller in the latest search.", "recaller"),
+	}
+
+	annSize := r.Gauge("vibers_ann_index_size", "Items in the default ANN embedding index.")
+	hitRatio := r.Gauge("vibers_cache_hit_ratio", "Share of cache lookups served from memory.", "cache")
+	caches := map[string]func() (int64, int64){
+		"seen_filter": svc.seen.CacheStats,
+		"campaigns":   svc.promo.CacheStats,
+	}
+	r.OnCollect(func() {
+		annSize.Set(float64(svc.recall.GetANNRecaller().Size()))
+		for name, stats := range caches {
+			hits, misses := stats()
+			ratio := 0.0
+			if total := hits + misses; total > 0 {
+				ratio = float64(hits) / float64(total)
+			}
+			hitRatio.Set(ratio, name)
+		}
+	})
+	return m
+}
+
+// middleware counts and times every request by its route pattern
+func (m *serverMetrics) middleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := c.Writer.Status()
+	m.requests.Inc(route, strconv.Itoa(status))
+	if status >= 500 {
+		m.errors.Inc(route)
+	}
+	m.latency.ObserveDuration(time.Since(start), route)
+}
+
+// recaller records one recaller run; it is passed as recall.Request.Observe
+func (m *serverMetrics) recaller(name string, elapsed time.Duration, candidates int) {
+	m.recallLatency.ObserveDuration(elapsed, name)
+	m.recallCandidates.Set(float64(candidates), name)
+}
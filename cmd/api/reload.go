@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/config"
+	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
+	"github.com/Boomshakalak/VibeRS/internal/rank/final"
+	"github.com/Boomshakalak/VibeRS/internal/rank/ltr"
+	"github.com/Boomshakalak/VibeRS/internal/recall"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// pipeline is one immutable version of the reloadable ranking stages. A
+// request loads the active version once and uses it throughout.
+type pipeline struct {
+	Version  int       `json:"version"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Source   string    `json:"source"`                 // What triggered the load
+	Model    string    `json:"ltr_model,omitempty"`    // LTR model version
+	Rules    string    `json:"coarse_rules,omitempty"` // Coarse rule file
+
+	cfg    *config.Config
+	coarse *coarse.Ranker
+	ltr    *ltr.Ranker
+	final  *final.Ranker
+}
+
+// arm identifies the version in the search log, e.g. "v3" or "v3/ltr-2024-06"
+func (p *pipeline) arm() string {
+	arm := fmt.Sprintf("v%d", p.Version)
+	if p.Model != "" {
+		arm += "/" + p.Model
+	}
+	return arm
+}
+
+// buildPipeline creates the ranking stages for a valid configuration,
+// reading the coarse rule file and the LTR model file if configured
+func buildPipeline(cfg *config.Config, embeddingOf func(int) []float32) (*pipeline, error) {
+	p := &pipeline{LoadedAt: time.Now(), cfg: cfg}
+	constraints, err := final.CompileConstraints(cfg.Final.Constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := coarse.CompileRules(coarse.RuleConfig{Rules: cfg.Coarse.Rules})
+	if err != nil {
+		return nil, err
+	}
+	if path := cfg.Coarse.RulesPath; path != "" {
+		if _, err := os.Stat(path); err == nil {
+			if rules, err = coarse.LoadRuleFile(path); err != nil {
+				return nil, err
+			}
+			p.Rules = path
+		}
+	}
+	p.coarse = coarse.NewRankerWithRules(rules)
+	p.coarse.SetBudget(cfg.Coarse.KeepTop)
+
+	p.ltr = ltr.NewRanker()
+	p.ltr.SetBudget(cfg.LTR.KeepTop)
+	p.ltr.SetWeights(cfg.LTR.Weights)
+	if path := cfg.LTR.ModelPath; path != "" {
+		model, err := ltr.LoadModel(path)
+		if err != nil {
+			return nil, err
+		}
+		p.ltr.SetModel(model)
+		p.Model = model.Version
+	}
+
+	p.final = final.NewRanker()
+	p.final.SetBrandDiversity(cfg.Final.MaxSameBrand, cfg.Final.DiversityWeight)
+	p.final.SetExploration(cfg.Server.PageSize, cfg.Final.ExplorationSlots, cfg.Final.BanditPolicy)
+	p.final.SetDiversityConfig(cfg.Final.MMR)
+	p.final.SetFreshnessConfig(cfg.Final.Freshness.Ranker())
+	p.final.SetEmbeddingLookup(embeddingOf)
+	p.final.SetConstraints(constraints)
+	p.final.SetObjective(cfg.Final.Objective)
+	return p, nil
+}
+
+// rank runs the ranking stages over deduplicated candidates without side
+// effects; the coarse rule counters are left untouched
+func (p *pipeline) rank(query string, items []store.Item) []store.Item {
+	ranked := p.coarse.RankWithContext(items, coarse.Context{Query: query, Untracked: true})
+	return p.final.RankRequest(final.Request{Items: p.ltr.Rank(ranked)}).Items
+}
+
+// canary ranks the canary queries with a candidate version and compares the
+// result counts with the active version. Each query is recalled once with
+// the candidate's limits and both versions rank the same candidates. A
+// panic fails the canary.
+func (s *services) canary(candidate, active *pipeline) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("canary panicked: %v", r)
+		}
+	}()
+	cfg := candidate.cfg.Reload
+	for _, query := range cfg.CanaryQueries {
+		res, err := s.recall.ParallelRecall(context.Background(), recall.Request{Query: query, Limits: &candidate.cfg.Recall.Limits})
+		if err != nil {
+			return fmt.Errorf("canary %q: %w", query, err)
+		}
+		items := s.dedup.Deduplicate(res.Items)
+		want, got := active.rank(res.Query, items), candidate.rank(res.Query, items)
+		if float64(len(got)) < cfg.MinResultRatio*float64(len(want)) {
+			return fmt.Errorf("canary %q: %d results, active version has %d", query, len(got), len(want))
+		}
+	}
+	return nil
+}
+
+// reload loads the configuration again, builds a new version of the
+// ranking stages and activates it if it passes the canary. The active
+// version is kept for rollback.
+func (s *services) reload(source string) (*pipeline, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	active := s.pipeline()
+	old := active.cfg
+	if cfg.Server.Addr != old.Server.Addr || cfg.Server.DBPath != old.Server.DBPath ||
+		cfg.Tracing != old.Tracing || cfg.Recall.Hybrid != old.Recall.Hybrid || cfg.Recall.HybridAlpha != old.Recall.HybridAlpha || cfg.Dedup != old.Dedup {
+		return nil, fmt.Errorf("server.addr, server.db_path, tracing.output, recall.hybrid, recall.hybrid_alpha and dedup need a restart")
+	}
+	candidate, err := buildPipeline(cfg, s.recall.GetANNRecaller().Embedding)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.canary(candidate, active); err != nil {
+		return nil, err
+	}
+
+	candidate.Version = active.Version + 1
+	candidate.Source = source
+	s.previous.Store(active)
+	s.current.Store(candidate)
+	log.Printf("Pipeline version %d activated (%s)", candidate.Version, source)
+	return candidate, nil
+}
+
+// rollback reactivates the previous version, keeping the active one as the
+// new previous version so a rollback can be undone
+func (s *services) rollback() (*pipeline, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	previous := s.previous.Load()
+	if previous == nil {
+		return nil, fmt.Errorf("no previous version")
+	}
+	s.previous.Store(s.current.Load())
+	s.current.Store(previous)
+	log.Printf("Pipeline rolled back to version %d", previous.Version)
+	return previous, nil
+}
+
+// watchFiles reloads whenever the config, coarse rule or LTR model file of
+// the active version changes, until stop is closed. Failed reloads are
+// logged and the active version stays.
+func (s *services) watchFiles(stop <-chan struct{}) {
+	modTimes := func() map[string]time.Time {
+		cfg := s.pipeline().cfg
+		configPath := cfg.Path()
+		if configPath == "" {
+			configPath = config.DefaultPath // Picked up once created
+		}
+		times := make(map[string]time.Time)
+		for _, path := range []string{configPath, cfg.Coarse.RulesPath, cfg.LTR.ModelPath} {
+			if path == "" {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil {
+				times[path] = info.ModTime()
+			} else {
+				times[path] = time.Time{}
+			}
+		}
+		return times
+	}
+
+	last := modTimes()
+	for {
+		interval := s.pipeline().cfg.Reload.PollInterval.Duration
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+		current := modTimes()
+		changed := len(current) != len(last)
+		for path, t := range current {
+			if !last[path].Equal(t) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		last = current
+		if _, err := s.reload("watch"); err != nil {
+			log.Printf("Reload failed, keeping version %d: %v", s.pipeline().Version, err)
+		} else {
+			last = modTimes() // The new version may watch other files
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/config"
+	"github.com/Boomshakalak/VibeRS/internal/trace"
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader carries the request ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey stores the request ID in the gin context
+const requestIDKey = "request_id"
+
+// newTracer opens the trace output configured in cfg
+func newTracer(cfg config.TracingConfig) (*trace.Tracer, error) {
+	var w io.Writer
+	switch cfg.Output {
+	case "":
+	case "stdout":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing.output: %w", err)
+		}
+		w = f // Open for the life of the process
+	}
+	return trace.NewTracer(w, "vibers-api"), nil
+}
+
+// validRequestID accepts client request IDs of up to 128 visible ASCII
+// characters; anything else is replaced by a generated ID
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// traceRequests assigns every request an ID, taken from X-Request-ID when
+// valid, returns it in the X-Request-ID header and traces the request
+// under a root span carried by the request context. A client ID that is a
+// valid trace ID also becomes the trace ID.
+func (s *services) traceRequests(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = trace.NewRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	ctx, span := s.tracer.StartRequest(c.Request.Context(), c.Request.Method+" "+route, id)
+	span.SetAttr("request.id", id)
+	span.SetAttr("http.method", c.Request.Method)
+	span.SetAttr("http.route", route)
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttr("http.status_code", status)
+	if status >= 500 {
+		span.SetError(fmt.Errorf("HTTP %d", status))
+	}
+	span.End()
+}
+
+// requestID returns the ID assigned to the request by traceRequests
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// stage times one search stage for both the metrics and the trace
+type stage struct {
+	ctx     context.Context // Carries the stage span to the work inside it
+	name    string
+	start   time.Time
+	span    *trace.Span
+	metrics *serverMetrics
+}
+
+// startStage starts timing a search stage as a child of the span in ctx
+func (m *serverMetrics) startStage(ctx context.Context, name string) *stage {
+	ctx, span := trace.Start(ctx, name)
+	return &stage{ctx: ctx, name: name, start: time.Now(), span: span, metrics: m}
+}
+
+// end records the stage latency and the candidates it left
+func (st *stage) end(candidates int) {
+	st.metrics.stageLatency.ObserveDuration(time.Since(st.start), st.name)
+	st.metrics.stageCandidates.Set(float64(candidates), st.name)
+	st.span.SetAttr("candidates", candidates)
+	st.span.End()
+}
+
+// fail ends a stage that could not complete
+func (st *stage) fail(err error) {
+	st.span.SetError(err)
+	st.span.End()
+}
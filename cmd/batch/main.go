@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/Boomshakalak/VibeRS/internal/itemsim"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func main() {
+	cfg := itemsim.DefaultConfig()
+
+	dbPath := flag.String("db", "./data/vibers.db", "SQLite database path")
+	flag.DurationVar(&cfg.SessionGap, "session-gap", cfg.SessionGap, "inactivity gap that ends a session")
+	flag.StringVar(&cfg.Measure, "measure", cfg.Measure, "similarity normalisation: cosine or jaccard")
+	flag.IntVar(&cfg.MinCoCount, "min-co-count", cfg.MinCoCount, "minimum shared sessions per pair")
+	flag.Float64Var(&cfg.MinScore, "min-score", cfg.MinScore, "minimum similarity score kept")
+	flag.IntVar(&cfg.TopK, "top-k", cfg.TopK, "related items kept per item")
+	flag.Parse()
+
+	if cfg.Measure != itemsim.MeasureCosine && cfg.Measure != itemsim.MeasureJaccard {
+		log.Fatalf("Unknown measure %q", cfg.Measure)
+	}
+
+	db, err := store.InitDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	storeService := store.NewService(db)
+
+	builder := itemsim.NewBuilder(cfg)
+	actions := 0
+	err = storeService.ScanSessionActions(func(a store.SessionAction) error {
+		builder.Add(a)
+		actions++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read user actions: %v", err)
+	}
+
+	sims := builder.Similarities()
+	if err := storeService.ReplaceItemSimilarities(sims); err != nil {
+		log.Fatalf("Failed to write item similarities: %v", err)
+	}
+
+	log.Printf("Item similarity job done: %d actions, %d similarity rows", actions, len(sims))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/analytics"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func main() {
+	opts := analytics.DefaultOptions()
+
+	dbPath := flag.String("db", "./data/vibers.db", "SQLite database path")
+	days := flag.Int("days", 30, "days of search log covered")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.IntVar(&opts.Limit, "limit", opts.Limit, "rows per section (0 = all)")
+	flag.IntVar(&opts.MinSearches, "min-searches", opts.MinSearches, "searches a query needs for the low-CTR and trending sections")
+	flag.IntVar(&opts.TrendDays, "trend-days", opts.TrendDays, "window compared with the one before it for trending queries")
+	flag.Parse()
+
+	if *days <= 0 {
+		log.Fatalf("-days must be positive")
+	}
+
+	db, err := store.InitDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	since := opts.Now.AddDate(0, 0, -*days)
+	report, err := analytics.Generate(store.NewService(db), since, opts)
+	if err != nil {
+		log.Fatalf("Failed to build report: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		return
+	}
+	writeText(os.Stdout, report, *days)
+}
+
+// writeText prints the report as aligned tables
+func writeText(out io.Writer, r *analytics.Report, days int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Search report: %d searches since %s (%d days)\n", r.Searches, r.Since.UTC().Format(time.RFC3339), days)
+
+	queries := func(title string, rows []analytics.QueryReport) {
+		fmt.Fprintf(w, "\n== %s ==\n", title)
+		if len(rows) == 0 {
+			fmt.Fprintln(w, "(none)")
+			return
+		}
+		fmt.Fprintln(w, "QUERY\tSEARCHES\tZERO\tZERO%\tCLICKS\tCTR\tAVG RESULTS\tAVG MS")
+		for _, q := range rows {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.0f%%\t%d\t%.1f%%\t%.0f\t%.1f\n", displayQuery(q.Query),
+				q.Searches, q.ZeroResults, 100*q.ZeroRate, q.Clicks, 100*q.CTR, q.AvgResults, q.AvgLatencyMs)
+		}
+	}
+	queries("Top queries", r.TopQueries)
+	queries("Zero-result queries", r.ZeroResultQueries)
+	queries("Lowest CTR queries", r.LowCTRQueries)
+
+	fmt.Fprintln(w, "\n== Daily volume ==")
+	if len(r.Daily) == 0 {
+		fmt.Fprintln(w, "(none)")
+	} else {
+		fmt.Fprintln(w, "DAY\tSEARCHES\tZERO\tQUERIES")
+		for _, d := range r.Daily {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", d.Day, d.Searches, d.ZeroResults, d.Queries)
+		}
+	}
+
+	fmt.Fprintln(w, "\n== Trending queries ==")
+	if len(r.Trending) == 0 {
+		fmt.Fprintln(w, "(none)")
+	} else {
+		fmt.Fprintln(w, "QUERY\tRECENT\tPREVIOUS\tGROWTH")
+		for _, t := range r.Trending {
+			fmt.Fprintf(w, "%s\t%d\t%d\t+%.0f%%\n", displayQuery(t.Query), t.Recent, t.Previous, 100*t.Growth)
+		}
+	}
+}
+
+// displayQuery makes the empty query visible
+func displayQuery(q string) string {
+	if q == "" {
+		return "(empty)"
+	}
+	return q
+}
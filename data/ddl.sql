@@ -49,4 +49,105 @@ CREATE TABLE IF NOT EXISTS user_actions (
 
 CREATE INDEX IF NOT EXISTS idx_user_actions_item ON user_actions(item_id);
 CREATE INDEX IF NOT EXISTS idx_user_actions_user ON user_actions(user_id);
-CREATE INDEX IF NOT EXISTS idx_user_actions_time ON user_actions(timestamp DESC); 
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_user_actions_time ON user_actions(timestamp DESC); 
+
+-- Exploration slot decisions (one row per exploration impression)
+CREATE TABLE IF NOT EXISTS exploration_log (
+  log_id        INTEGER PRIMARY KEY,
+  query         TEXT,
+  item_id       INTEGER NOT NULL,
+  position      INTEGER NOT NULL,  -- 1-based position in the result list
+  policy        TEXT NOT NULL,     -- 'thompson' or 'ucb'
+  score         REAL,              -- bandit score at decision time
+  created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exploration_log_item ON exploration_log(item_id);
+
+-- Item-to-item similarities computed offline by cmd/batch
+CREATE TABLE IF NOT EXISTS item_similarity (
+  item_id       INTEGER NOT NULL,
+  related_id    INTEGER NOT NULL,
+  score         REAL NOT NULL,     -- blended co-click / co-purchase similarity
+  co_count      INTEGER NOT NULL,  -- sessions containing both items
+  updated_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (item_id, related_id)
+);
+
+-- Additional named embedding spaces (e.g. 'image'); items.embedding is 'default'
+CREATE TABLE IF NOT EXISTS item_embeddings (
+  item_id       INTEGER NOT NULL,
+  space         TEXT NOT NULL,
+  embedding     BLOB NOT NULL,     -- []float32 serialized
+  PRIMARY KEY (item_id, space)
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_embeddings_space ON item_embeddings(space);
+
+-- Per-user seen-item bloom filters, persisted by the API server
+CREATE TABLE IF NOT EXISTS seen_filters (
+  user_id       TEXT PRIMARY KEY,
+  filter        BLOB NOT NULL,     -- dedup.SeenFilter generations, binary encoded
+  updated_at    DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_seen_filters_updated ON seen_filters(updated_at);
+
+-- Sponsored campaigns injected into search results by the promotions subsystem
+CREATE TABLE IF NOT EXISTS campaigns (
+  campaign_id    INTEGER PRIMARY KEY,
+  name           TEXT NOT NULL,
+  target_queries TEXT NOT NULL DEFAULT '',  -- comma-separated query terms
+  target_brands  TEXT NOT NULL DEFAULT '',  -- comma-separated brands; both empty = every query
+  placement      TEXT NOT NULL DEFAULT 'floating',  -- 'fixed' or 'floating'
+  positions      TEXT NOT NULL,     -- comma-separated 1-based positions, e.g. '3,8'
+  starts_at      DATETIME,          -- UTC 'YYYY-MM-DD HH:MM:SS'; NULL = no start
+  ends_at        DATETIME,          -- NULL = no end
+  daily_cap      INTEGER NOT NULL DEFAULT 0,  -- impressions per UTC day; 0 = uncapped
+  priority       INTEGER NOT NULL DEFAULT 0   -- higher claims positions first
+);
+
+CREATE TABLE IF NOT EXISTS campaign_items (
+  campaign_id    INTEGER NOT NULL,
+  item_id        INTEGER NOT NULL,
+  rank           INTEGER NOT NULL DEFAULT 0,  -- lower is shown first
+  PRIMARY KEY (campaign_id, item_id)
+);
+
+-- Served sponsored impressions per campaign and UTC day, for pacing
+CREATE TABLE IF NOT EXISTS campaign_impressions (
+  campaign_id    INTEGER NOT NULL,
+  day            TEXT NOT NULL,     -- 'YYYY-MM-DD'
+  impressions    INTEGER NOT NULL,
+  PRIMARY KEY (campaign_id, day)
+);
+
+-- Merchandising query rules (synonyms, redirects, pins, bans, boost/bury),
+-- managed through /admin/query-rules
+CREATE TABLE IF NOT EXISTS query_rules (
+  rule_id       INTEGER PRIMARY KEY,
+  spec          TEXT NOT NULL,      -- JSON rule definition
+  updated_at    DATETIME NOT NULL
+);
+
+-- One row per /search request, read by cmd/report
+CREATE TABLE IF NOT EXISTS search_log (
+  search_id     INTEGER PRIMARY KEY,
+  request_id    TEXT,              -- X-Request-ID of the search
+  query         TEXT NOT NULL,     -- As typed
+  norm_query    TEXT NOT NULL,     -- Lowercased, whitespace collapsed
+  filters       TEXT,              -- JSON object of filters parsed from the query
+  user_id       TEXT,
+  session_id    TEXT,
+  page          INTEGER,
+  result_count  INTEGER NOT NULL,  -- Total results, 0 for zero-result searches
+  top_ids       TEXT,              -- Comma-separated item IDs served on the page
+  latency_ms    REAL,
+  arm           TEXT,              -- Pipeline version serving the search, e.g. 'v3' or 'v3/ltr-2024-06'
+  redirect      TEXT,              -- Set when a query rule redirected the search
+  relaxation    TEXT,              -- Comma-separated relaxation steps when the query matched nothing as typed
+  created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_log_time ON search_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_search_log_query ON search_log(norm_query);
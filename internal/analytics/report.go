@@ -0,0 +1,227 @@
+// Package analytics turns the search log into reports on what users search
+// for and where search fails them.
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// NormalizeQuery lowercases a query and collapses whitespace so spelling
+// variants of one query are counted together
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Options controls report sizes and thresholds
+type Options struct {
+	Limit       int       // Rows per section
+	MinSearches int       // Searches a query needs for low-CTR and trend ranking
+	TrendDays   int       // Length of the windows compared for trends
+	Now         time.Time // End of the trend window
+}
+
+// DefaultOptions returns the default report options
+func DefaultOptions() Options {
+	return Options{Limit: 20, MinSearches: 5, TrendDays: 7, Now: time.Now()}
+}
+
+// QueryReport summarises one normalized query
+type QueryReport struct {
+	Query        string    `json:"query"`
+	Searches     int       `json:"searches"`
+	ZeroResults  int       `json:"zero_results"`
+	ZeroRate     float64   `json:"zero_result_rate"`
+	Redirects    int       `json:"redirects"`
+	Clicks       int       `json:"clicks"`
+	CTR          float64   `json:"ctr"` // Clicks per search that showed results
+	AvgResults   float64   `json:"avg_results"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// shown is the number of searches that showed results
+func (q QueryReport) shown() int {
+	return q.Searches - q.ZeroResults - q.Redirects
+}
+
+// DayReport is the search volume of one UTC day
+type DayReport struct {
+	Day         string `json:"day"`
+	Searches    int    `json:"searches"`
+	ZeroResults int    `json:"zero_results"`
+	Queries     int    `json:"distinct_queries"`
+}
+
+// Trend compares a query's searches in the latest window with the window
+// before it
+type Trend struct {
+	Query    string  `json:"query"`
+	Recent   int     `json:"recent"`
+	Previous int     `json:"previous"`
+	Growth   float64 `json:"growth"` // (recent - previous) / max(previous, 1)
+}
+
+// Report is the search analytics report
+type Report struct {
+	Since             time.Time     `json:"since"`
+	Searches          int           `json:"searches"`
+	TopQueries        []QueryReport `json:"top_queries"`
+	ZeroResultQueries []QueryReport `json:"zero_result_queries"`
+	LowCTRQueries     []QueryReport `json:"low_ctr_queries"`
+	Daily             []DayReport   `json:"daily"`
+	Trending          []Trend       `json:"trending"`
+}
+
+// Generate reads the searches and clicks logged since the given time and
+// builds the report
+func Generate(st *store.Service, since time.Time, opts Options) (*Report, error) {
+	stats, err := st.GetSearchQueryStats(since)
+	if err != nil {
+		return nil, err
+	}
+	clicks, err := st.GetQueryClicks(since)
+	if err != nil {
+		return nil, err
+	}
+	days, err := st.GetSearchDayCounts(since)
+	if err != nil {
+		return nil, err
+	}
+	report := Build(stats, clicks, days, opts)
+	report.Since = since
+	return report, nil
+}
+
+// Build assembles a report from per-query stats (most searched first),
+// clicks by raw query and per-day counts
+func Build(stats []store.SearchQueryStat, clicks map[string]int, days []store.SearchDayCount, opts Options) *Report {
+	normClicks := make(map[string]int, len(clicks))
+	for query, n := range clicks {
+		normClicks[NormalizeQuery(query)] += n
+	}
+
+	report := &Report{}
+	queries := make([]QueryReport, 0, len(stats))
+	for _, st := range stats {
+		q := QueryReport{
+			Query:        st.NormQuery,
+			Searches:     st.Searches,
+			ZeroResults:  st.ZeroResults,
+			Redirects:    st.Redirects,
+			Clicks:       normClicks[st.NormQuery],
+			AvgResults:   st.AvgResults,
+			AvgLatencyMs: st.AvgLatencyMs,
+			LastSeen:     st.LastSeen,
+		}
+		if q.Searches > 0 {
+			q.ZeroRate = float64(q.ZeroResults) / float64(q.Searches)
+		}
+		if q.shown() > 0 {
+			q.CTR = float64(q.Clicks) / float64(q.shown())
+		}
+		report.Searches += q.Searches
+		queries = append(queries, q)
+	}
+
+	report.TopQueries = head(queries, opts.Limit)
+
+	var zero []QueryReport
+	for _, q := range queries {
+		if q.ZeroResults > 0 {
+			zero = append(zero, q)
+		}
+	}
+	sort.SliceStable(zero, func(i, j int) bool { return zero[i].ZeroResults > zero[j].ZeroResults })
+	report.ZeroResultQueries = head(zero, opts.Limit)
+
+	var low []QueryReport
+	for _, q := range queries {
+		if q.shown() >= opts.MinSearches {
+			low = append(low, q)
+		}
+	}
+	sort.SliceStable(low, func(i, j int) bool { return low[i].CTR < low[j].CTR })
+	report.LowCTRQueries = head(low, opts.Limit)
+
+	report.Daily = daily(days)
+	report.Trending = trending(days, opts)
+	return report
+}
+
+// daily totals the per-query day counts
+func daily(days []store.SearchDayCount) []DayReport {
+	var out []DayReport
+	for _, d := range days {
+		if len(out) == 0 || out[len(out)-1].Day != d.Day {
+			out = append(out, DayReport{Day: d.Day})
+		}
+		day := &out[len(out)-1]
+		day.Searches += d.Searches
+		day.ZeroResults += d.ZeroResults
+		day.Queries++
+	}
+	return out
+}
+
+// trending ranks queries by growth of the last opts.TrendDays days over the
+// same number of days before
+func trending(days []store.SearchDayCount, opts Options) []Trend {
+	if opts.TrendDays <= 0 {
+		return nil
+	}
+	today := opts.Now.UTC().Truncate(24 * time.Hour)
+	recentFrom := today.AddDate(0, 0, 1-opts.TrendDays).Format("2006-01-02")
+	previousFrom := today.AddDate(0, 0, 1-2*opts.TrendDays).Format("2006-01-02")
+
+	byQuery := make(map[string]*Trend)
+	for _, d := range days {
+		if d.Day < previousFrom {
+			continue
+		}
+		t, ok := byQuery[d.NormQuery]
+		if !ok {
+			t = &Trend{Query: d.NormQuery}
+			byQuery[d.NormQuery] = t
+		}
+		if d.Day >= recentFrom {
+			t.Recent += d.Searches
+		} else {
+			t.Previous += d.Searches
+		}
+	}
+
+	var trends []Trend
+	for _, t := range byQuery {
+		if t.Recent+t.Previous < opts.MinSearches || t.Recent <= t.Previous {
+			continue
+		}
+		previous := t.Previous
+		if previous < 1 {
+			previous = 1
+		}
+		t.Growth = float64(t.Recent-t.Previous) / float64(previous)
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Growth != trends[j].Growth {
+			return trends[i].Growth > trends[j].Growth
+		}
+		if trends[i].Recent != trends[j].Recent {
+			return trends[i].Recent > trends[j].Recent
+		}
+		return trends[i].Query < trends[j].Query
+	})
+	return head(trends, opts.Limit)
+}
+
+// head returns up to limit elements; limit <= 0 keeps all
+func head[T any](list []T, limit int) []T {
+	if limit > 0 && len(list) > limit {
+		return list[:limit]
+	}
+	return list
+}
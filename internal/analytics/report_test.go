@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestBuildReport(t *testing.T) {
+	stats := []store.SearchQueryStat{
+		{NormQuery: "bag", Searches: 20, AvgResults: 40},
+		{NormQuery: "chanel flap", Searches: 10, ZeroResults: 2},
+		{NormQuery: "hermes kelly", Searches: 6, ZeroResults: 6},
+		{NormQuery: "sale", Searches: 4, Redirects: 4},
+	}
+	clicks := map[string]int{"Bag": 8, " bag ": 2, "chanel  flap": 1, "unlogged": 5}
+	days := []store.SearchDayCount{
+		{Day: "2024-05-01", NormQuery: "bag", Searches: 12},
+		{Day: "2024-05-01", NormQuery: "chanel flap", Searches: 1, ZeroResults: 1},
+		{Day: "2024-05-09", NormQuery: "bag", Searches: 8},
+		{Day: "2024-05-09", NormQuery: "chanel flap", Searches: 9, ZeroResults: 1},
+	}
+	opts := Options{Limit: 2, MinSearches: 5, TrendDays: 7, Now: time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)}
+
+	r := Build(stats, clicks, days, opts)
+
+	if r.Searches != 40 || len(r.TopQueries) != 2 || r.TopQueries[0].Query != "bag" {
+		t.Fatalf("top queries = %+v (of %d)", r.TopQueries, r.Searches)
+	}
+	if bag := r.TopQueries[0]; bag.Clicks != 10 || bag.CTR != 0.5 {
+		t.Errorf("bag clicks=%d ctr=%v, want 10 clicks merged across spellings at 0.5", bag.Clicks, bag.CTR)
+	}
+	if z := r.ZeroResultQueries; len(z) != 2 || z[0].Query != "hermes kelly" || z[0].ZeroRate != 1 {
+		t.Errorf("zero-result queries = %+v", z)
+	}
+	// Redirects and zero-result searches do not count as shown
+	if low := r.LowCTRQueries; len(low) != 2 || low[0].Query != "chanel flap" || low[0].CTR != 1.0/8 {
+		t.Errorf("low CTR queries = %+v", low)
+	}
+	if len(r.Daily) != 2 || r.Daily[0] != (DayReport{Day: "2024-05-01", Searches: 13, ZeroResults: 1, Queries: 2}) {
+		t.Errorf("daily = %+v", r.Daily)
+	}
+	// Window of 05-04..05-10 against 04-27..05-03: "bag" fell, "chanel flap" grew 1 → 9
+	if tr := r.Trending; len(tr) != 1 || tr[0] != (Trend{Query: "chanel flap", Recent: 9, Previous: 1, Growth: 8}) {
+		t.Errorf("trending = %+v", tr)
+	}
+}
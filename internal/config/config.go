@@ -0,0 +1,368 @@
+// Package config holds the typed configuration of the search pipeline.
+// Values come from built-in defaults, then an optional JSON file, then
+// VIBERS_* environment variables, then command-line flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/dedup"
+	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
+	"github.com/Boomshakalak/VibeRS/internal/rank/final"
+	"github.com/Boomshakalak/VibeRS/internal/rank/ltr"
+	"github.com/Boomshakalak/VibeRS/internal/recall"
+)
+
+// Config is the effective configuration of the API server
+type Config struct {
+	Server  ServerConfig  `json:"server"`
+	Reload  ReloadConfig  `json:"reload"`
+	Tracing TracingConfig `json:"tracing"`
+	Recall  RecallConfig  `json:"recall"`
+	Dedup   DedupConfig   `json:"dedup"`
+	Coarse  CoarseConfig  `json:"coarse"`
+	LTR     LTRConfig     `json:"ltr"`
+	Final   FinalConfig   `json:"final"`
+
+	path string // Config file read, if any
+}
+
+// Path returns the config file the configuration was read from, or ""
+func (c *Config) Path() string {
+	return c.path
+}
+
+// ServerConfig covers the HTTP server and storage
+type ServerConfig struct {
+	Addr     string `json:"addr"`
+	DBPath   string `json:"db_path"`
+	PageSize int    `json:"page_size"` // Default results per page; slots must fit on a page of this size
+
+	MinPageSize     int `json:"min_page_size"`     // Smallest page_size a search may ask for
+	MaxPageSize     int `json:"max_page_size"`     // Largest page_size a search may ask for
+	MaxResultWindow int `json:"max_result_window"` // Results reachable by paging: page × page_size may not exceed it
+}
+
+// ReloadConfig covers hot reloading of the ranking stages. Reloads apply
+// every key except server.addr, server.db_path, tracing.output,
+// recall.hybrid, recall.hybrid_alpha and dedup, which need a restart.
+type ReloadConfig struct {
+	PollInterval   Duration `json:"poll_interval"`    // How often config, rule and model files are checked
+	CanaryQueries  []string `json:"canary_queries"`   // Queries ranked by a new version before it activates
+	MinResultRatio float64  `json:"min_result_ratio"` // Canary results needed, relative to the active version
+}
+
+// TracingConfig covers request tracing. Every response carries an
+// X-Request-ID header; spans are exported only when Output is set.
+type TracingConfig struct {
+	Output string `json:"output"` // "" (off), "stdout" or a file appended with one OTLP/JSON trace per line
+}
+
+// RecallConfig covers candidate generation
+type RecallConfig struct {
+	Hybrid                bool          `json:"hybrid"`       // Blend lexical and vector recall
+	HybridAlpha           HybridAlpha   `json:"hybrid_alpha"` // Lexical weight of the blend per query type
+	Limits                recall.Limits `json:"limits"`
+	ExplorationCandidates int           `json:"exploration_candidates"` // Pool the bandit chooses from
+}
+
+// HybridAlpha is the lexical weight of hybrid recall for each query type;
+// the rest goes to semantic similarity
+type HybridAlpha struct {
+	Brand       float64 `json:"brand"`
+	Short       float64 `json:"short"`
+	Default     float64 `json:"default"`
+	Descriptive float64 `json:"descriptive"`
+}
+
+// Recall returns the blend settings in the recall package's form
+func (a HybridAlpha) Recall() recall.HybridConfig {
+	cfg := recall.DefaultHybridConfig()
+	cfg.Alpha = map[recall.QueryType]float64{
+		recall.QueryBrand:       a.Brand,
+		recall.QueryShort:       a.Short,
+		recall.QueryDefault:     a.Default,
+		recall.QueryDescriptive: a.Descriptive,
+	}
+	return cfg
+}
+
+// DedupConfig covers near-duplicate merging and the per-user seen-filter
+type DedupConfig struct {
+	NearDup dedup.NearDupConfig `json:"near_dup"`
+	Seen    SeenConfig          `json:"seen"`
+}
+
+// SeenConfig is dedup.SeenConfig with readable durations
+type SeenConfig struct {
+	Capacity      int      `json:"capacity"`
+	FPRate        float64  `json:"fp_rate"`
+	Window        Duration `json:"window"` // Span of one generation
+	Generations   int      `json:"generations"`
+	ClickWeight   int      `json:"click_weight"`
+	DemoteAfter   int      `json:"demote_after"`   // 0 disables
+	RemoveAfter   int      `json:"remove_after"`   // 0 disables
+	FlushInterval Duration `json:"flush_interval"` // How often filters are persisted
+}
+
+// Filter returns the settings in the dedup package's form
+func (c SeenConfig) Filter() dedup.SeenConfig {
+	return dedup.SeenConfig{
+		Capacity:    c.Capacity,
+		FPRate:      c.FPRate,
+		Window:      c.Window.Duration,
+		Generations: c.Generations,
+		ClickWeight: c.ClickWeight,
+		DemoteAfter: c.DemoteAfter,
+		RemoveAfter: c.RemoveAfter,
+	}
+}
+
+// CoarseConfig covers hard-rule filtering
+type CoarseConfig struct {
+	KeepTop   int               `json:"keep_top"`   // Candidates passed on to LTR (0 = all)
+	Rules     []coarse.RuleSpec `json:"rules"`      // Built-in hard rules
+	RulesPath string            `json:"rules_path"` // Rule file replacing Rules when present
+}
+
+// LTRConfig covers learning-to-rank scoring
+type LTRConfig struct {
+	KeepTop   int         `json:"keep_top"` // Candidates passed on to final ranking (0 = all)
+	Weights   ltr.Weights `json:"weights"`
+	ModelPath string      `json:"model_path,omitempty"` // Model file replacing Weights when set
+}
+
+// FinalConfig covers business-aware final ranking
+type FinalConfig struct {
+	MaxSameBrand     int                   `json:"max_same_brand"`    // Greedy per-brand cap
+	DiversityWeight  float64               `json:"diversity_weight"`  // Score penalty per repeated brand
+	ExplorationSlots []int                 `json:"exploration_slots"` // 1-based positions on each page
+	BanditPolicy     string                `json:"bandit_policy"`
+	MMR              final.DiversityConfig `json:"mmr"`
+	Freshness        FreshnessConfig       `json:"freshness"`
+	// Constraints on the composition of the ranked list, enforced by the
+	// re-ranker while it maximises Objective
+	Constraints []final.ConstraintSpec `json:"constraints"`
+	Objective   final.Objective        `json:"objective"`
+}
+
+// FreshnessConfig is final.FreshnessConfig with readable durations
+type FreshnessConfig struct {
+	Curve          string   `json:"curve"`
+	HalfLife       Duration `json:"half_life"`
+	Horizon        Duration `json:"horizon"`
+	MaxBoost       float64  `json:"max_boost"`
+	NewWithin      Duration `json:"new_within"`
+	MinImpressions int      `json:"min_impressions"`
+	ExposureSlots  []int    `json:"exposure_slots"`
+}
+
+// Ranker returns the settings in the final package's form
+func (c FreshnessConfig) Ranker() final.FreshnessConfig {
+	return final.FreshnessConfig{
+		Curve:          c.Curve,
+		HalfLife:       c.HalfLife.Duration,
+		Horizon:        c.Horizon.Duration,
+		MaxBoost:       c.MaxBoost,
+		NewWithin:      c.NewWithin.Duration,
+		MinImpressions: c.MinImpressions,
+		ExposureSlots:  c.ExposureSlots,
+	}
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "336h"
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the configuration matching the built-in behavior
+func Default() *Config {
+	freshness := final.DefaultFreshnessConfig()
+	alpha := recall.DefaultHybridConfig().Alpha
+	seen := dedup.DefaultSeenConfig()
+	return &Config{
+		Server: ServerConfig{
+			Addr:     ":8080",
+			DBPath:   "./data/vibers.db",
+			PageSize: 20,
+
+			MinPageSize:     1,
+			MaxPageSize:     100,
+			MaxResultWindow: 1000,
+		},
+		Reload: ReloadConfig{
+			PollInterval:   Duration{5 * time.Second},
+			CanaryQueries:  []string{"", "bag", "chanel", "black leather tote"},
+			MinResultRatio: 0.5,
+		},
+		Recall: RecallConfig{
+			Hybrid: true,
+			HybridAlpha: HybridAlpha{
+				Brand:       alpha[recall.QueryBrand],
+				Short:       alpha[recall.QueryShort],
+				Default:     alpha[recall.QueryDefault],
+				Descriptive: alpha[recall.QueryDescriptive],
+			},
+			Limits:                recall.DefaultLimits(),
+			ExplorationCandidates: 100,
+		},
+		Dedup: DedupConfig{
+			NearDup: dedup.DefaultNearDupConfig(),
+			Seen: SeenConfig{
+				Capacity:      seen.Capacity,
+				FPRate:        seen.FPRate,
+				Window:        Duration{seen.Window},
+				Generations:   seen.Generations,
+				ClickWeight:   seen.ClickWeight,
+				DemoteAfter:   seen.DemoteAfter,
+				RemoveAfter:   seen.RemoveAfter,
+				FlushInterval: Duration{30 * time.Second},
+			},
+		},
+		Coarse: CoarseConfig{
+			KeepTop:   500,
+			Rules:     coarse.DefaultRuleConfig().Rules,
+			RulesPath: "./config/coarse_rules.json",
+		},
+		LTR: LTRConfig{
+			KeepTop: 100,
+			Weights: ltr.DefaultWeights(),
+		},
+		Final: FinalConfig{
+			MaxSameBrand:     3,
+			DiversityWeight:  0.15,
+			ExplorationSlots: []int{5, 15},
+			BanditPolicy:     final.PolicyThompson,
+			MMR:              final.DefaultDiversityConfig(),
+			Constraints:      []final.ConstraintSpec{},
+			Objective:        final.DefaultObjective(),
+			Freshness: FreshnessConfig{
+				Curve:          freshness.Curve,
+				HalfLife:       Duration{freshness.HalfLife},
+				Horizon:        Duration{freshness.Horizon},
+				MaxBoost:       freshness.MaxBoost,
+				NewWithin:      Duration{freshness.NewWithin},
+				MinImpressions: freshness.MinImpressions,
+				ExposureSlots:  freshness.ExposureSlots,
+			},
+		},
+	}
+}
+
+// Validate reports every invalid setting
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	inPage := func(key string, slots []int) {
+		for _, pos := range slots {
+			check(pos >= 1 && pos <= c.Server.PageSize, "%s: position %d outside page of %d", key, pos, c.Server.PageSize)
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr: required")
+	check(c.Server.DBPath != "", "server.db_path: required")
+	check(c.Server.PageSize >= 1 && c.Server.PageSize <= 100, "server.page_size: must be between 1 and 100")
+	check(c.Server.MinPageSize >= 1 && c.Server.MinPageSize <= c.Server.PageSize,
+		"server.min_page_size: must be between 1 and server.page_size")
+	check(c.Server.MaxPageSize >= c.Server.PageSize && c.Server.MaxPageSize <= c.Server.MaxResultWindow,
+		"server.max_page_size: must be between server.page_size and server.max_result_window")
+
+	check(c.Reload.PollInterval.Duration > 0, "reload.poll_interval: must be positive")
+	check(c.Reload.MinResultRatio >= 0 && c.Reload.MinResultRatio <= 1, "reload.min_result_ratio: must be between 0 and 1")
+
+	l := c.Recall.Limits
+	check(l.Text > 0, "recall.limits.text: must be positive")
+	check(l.Hybrid >= 0 && l.Personal >= 0 && l.HotPool >= 0 && l.MaxDiversity >= 0 && l.Hot >= 0 &&
+		l.EmptyQueryHot >= 0 && l.Random >= 0 && l.ANN >= 0 && l.Attr >= 0 && l.Profile >= 0 && l.CF >= 0,
+		"recall.limits: must not be negative")
+	a := c.Recall.HybridAlpha
+	for _, alpha := range []struct {
+		key   string
+		value float64
+	}{{"brand", a.Brand}, {"short", a.Short}, {"default", a.Default}, {"descriptive", a.Descriptive}} {
+		check(alpha.value >= 0 && alpha.value <= 1, "recall.hybrid_alpha.%s: must be between 0 and 1", alpha.key)
+	}
+	check(c.Recall.ExplorationCandidates >= 0, "recall.exploration_candidates: must not be negative")
+
+	nd := c.Dedup.NearDup
+	check(nd.ShingleSize >= 1, "dedup.near_dup.shingle_size: must be at least 1")
+	check(nd.Bands >= 1 && nd.RowsPerBand >= 1, "dedup.near_dup: bands and rows_per_band must be at least 1")
+	check(nd.TitleThreshold >= 0 && nd.TitleThreshold <= 1, "dedup.near_dup.title_threshold: must be between 0 and 1")
+	check(nd.EmbeddingThreshold >= 0 && nd.EmbeddingThreshold <= 1, "dedup.near_dup.embedding_threshold: must be between 0 and 1")
+	switch nd.Policy {
+	case dedup.KeepHighestScore, dedup.KeepLowestPrice, dedup.KeepHighestRating:
+	default:
+		errs = append(errs, fmt.Errorf("dedup.near_dup.policy: unknown policy %q", nd.Policy))
+	}
+	seen := c.Dedup.Seen
+	check(seen.Capacity >= 1, "dedup.seen.capacity: must be at least 1")
+	check(seen.FPRate > 0 && seen.FPRate < 1, "dedup.seen.fp_rate: must be between 0 and 1 exclusive")
+	check(seen.Window.Duration > 0, "dedup.seen.window: must be positive")
+	check(seen.Generations >= 1, "dedup.seen.generations: must be at least 1")
+	check(seen.ClickWeight >= 1, "dedup.seen.click_weight: must be at least 1")
+	check(seen.DemoteAfter >= 0 && seen.RemoveAfter >= 0, "dedup.seen: demote_after and remove_after must not be negative")
+	check(seen.FlushInterval.Duration > 0, "dedup.seen.flush_interval: must be positive")
+
+	check(c.Coarse.KeepTop >= 0, "coarse.keep_top: must not be negative")
+	if _, err := coarse.CompileRules(coarse.RuleConfig{Rules: c.Coarse.Rules}); err != nil {
+		errs = append(errs, fmt.Errorf("coarse.rules: %w", err))
+	}
+
+	check(c.LTR.KeepTop >= 0, "ltr.keep_top: must not be negative")
+
+	f := c.Final
+	check(f.MaxSameBrand >= 1, "final.max_same_brand: must be at least 1")
+	check(f.DiversityWeight >= 0 && f.DiversityWeight <= 1, "final.diversity_weight: must be between 0 and 1")
+	inPage("final.exploration_slots", f.ExplorationSlots)
+	check(f.BanditPolicy == final.PolicyThompson || f.BanditPolicy == final.PolicyUCB,
+		"final.bandit_policy: must be %s or %s", final.PolicyThompson, final.PolicyUCB)
+	check(f.MMR.Lambda >= 0 && f.MMR.Lambda <= 1, "final.mmr.lambda: must be between 0 and 1")
+	check(f.MMR.Window >= 0, "final.mmr.window: must not be negative")
+	check(f.MMR.EmbeddingWeight >= 0 && f.MMR.PriceBandWeight >= 0 && f.MMR.BrandWeight >= 0,
+		"final.mmr: weights must not be negative")
+	switch f.Freshness.Curve {
+	case final.CurveExponential, final.CurveLinear, final.CurveStep:
+	default:
+		errs = append(errs, fmt.Errorf("final.freshness.curve: unknown curve %q", f.Freshness.Curve))
+	}
+	check(f.Freshness.MaxBoost >= 1, "final.freshness.max_boost: must be at least 1")
+	check(f.Freshness.HalfLife.Duration >= 0 && f.Freshness.Horizon.Duration >= 0 && f.Freshness.NewWithin.Duration >= 0,
+		"final.freshness: durations must not be negative")
+	check(f.Freshness.MinImpressions >= 0, "final.freshness.min_impressions: must not be negative")
+	inPage("final.freshness.exposure_slots", f.Freshness.ExposureSlots)
+	if _, err := final.CompileConstraints(f.Constraints); err != nil {
+		errs = append(errs, fmt.Errorf("final.constraints: %w", err))
+	}
+	check(f.Objective.Relevance >= 0 && f.Objective.GMV >= 0 && f.Objective.Freshness >= 0,
+		"final.objective: weights must not be negative")
+	check(f.Objective.Relevance > 0 || f.Objective.GMV > 0 || f.Objective.Freshness > 0,
+		"final.objective: at least one weight must be positive")
+
+	return errors.Join(errs...)
+}
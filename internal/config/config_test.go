@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vibers.json")
+	file := `{"server": {"page_size": 30, "addr": ":9000"}, "final": {"mmr": {"lambda": 0.5}, "freshness": {"half_life": "48h"}}}`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(
+		[]string{"-config", path, "-addr", ":9100", "-set", "final.exploration_slots=3,7", "-set", "dedup.seen.flush_interval=1m"},
+		env(map[string]string{"VIBERS_SERVER_PAGE_SIZE": "25", "VIBERS_SERVER_ADDR": ":9050", "VIBERS_RECALL_HYBRID": "false"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.PageSize != 25 {
+		t.Errorf("page_size = %d, want env 25 over file 30", cfg.Server.PageSize)
+	}
+	if cfg.Server.Addr != ":9100" {
+		t.Errorf("addr = %q, want flag over env", cfg.Server.Addr)
+	}
+	if cfg.Final.MMR.Lambda != 0.5 || cfg.Final.MMR.Window != 60 {
+		t.Errorf("mmr = %+v, want file lambda with default window", cfg.Final.MMR)
+	}
+	if cfg.Final.Freshness.HalfLife.Duration != 48*time.Hour {
+		t.Errorf("half_life = %v", cfg.Final.Freshness.HalfLife)
+	}
+	if cfg.Recall.Hybrid {
+		t.Errorf("hybrid not overridden by env")
+	}
+	if !reflect.DeepEqual(cfg.Final.ExplorationSlots, []int{3, 7}) {
+		t.Errorf("exploration_slots = %v", cfg.Final.ExplorationSlots)
+	}
+	if cfg.Dedup.Seen.FlushInterval.Duration != time.Minute {
+		t.Errorf("seen flush_interval = %v", cfg.Dedup.Seen.FlushInterval)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	cases := map[string][]string{
+		"unknown key":           {"-set", "server.port=1"},
+		"bad value":             {"-set", "server.page_size=many"},
+		"slot outside page":     {"-set", "server.page_size=10"}, // Freshness exposure slot 20
+		"alpha above 1":         {"-set", "recall.hybrid_alpha.brand=1.5"},
+		"negative objective":    {"-set", "final.objective.gmv=-1"},
+		"near-dup policy":       {"-set", "dedup.near_dup.policy=newest"},
+		"seen fp rate of 1":     {"-set", "dedup.seen.fp_rate=1"},
+		"unknown policy":        {"-set", "final.bandit_policy=greedy"},
+		"page size past window": {"-set", "server.max_page_size=2000"},
+		"missing config file":   {"-config", "/nonexistent/vibers.json"},
+	}
+	for name, args := range cases {
+		if _, err := Load(args, env(nil)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	_, err := Load([]string{"-set", "final.mmr.lambda=2", "-set", "ltr.keep_top=-1"}, env(nil))
+	if err == nil || !strings.Contains(err.Error(), "final.mmr.lambda") || !strings.Contains(err.Error(), "ltr.keep_top") {
+		t.Errorf("want both errors reported, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPath is read when present and no file is given explicitly
+const DefaultPath = "./config/vibers.json"
+
+// envPrefix starts the environment variable of every key: server.page_size
+// is overridden by VIBERS_SERVER_PAGE_SIZE
+const envPrefix = "VIBERS_"
+
+// Load builds the configuration from the defaults, the config file, the
+// environment (looked up with lookupEnv) and the command-line args, each
+// overriding the previous, and validates the result.
+//
+// Flags:
+//
+//	-config path      JSON config file (also VIBERS_CONFIG)
+//	-addr addr        shorthand for -set server.addr=addr
+//	-db path          shorthand for -set server.db_path=path
+//	-set key=value    override any scalar or list key; repeatable
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet("vibers", flag.ContinueOnError)
+	path := fs.String("config", "", "JSON config file (default "+DefaultPath+" if present)")
+	addr := fs.String("addr", "", "listen address")
+	db := fs.String("db", "", "SQLite database path")
+	var sets setFlags
+	fs.Var(&sets, "set", "override a config key, e.g. -set server.page_size=30 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	file := *path
+	if file == "" {
+		file, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(DefaultPath); err == nil {
+		if err := cfg.readFile(DefaultPath); err != nil {
+			return nil, err
+		}
+	}
+
+	leaves := cfg.leaves()
+	for _, key := range sortedKeys(leaves) {
+		if value, ok := lookupEnv(EnvName(key)); ok {
+			if err := setLeaf(leaves[key], value); err != nil {
+				return nil, fmt.Errorf("%s: %w", EnvName(key), err)
+			}
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			sets = append(sets, "server.addr="+*addr)
+		case "db":
+			sets = append(sets, "server.db_path="+*db)
+		}
+	})
+	for _, kv := range sets {
+		key, value, _ := strings.Cut(kv, "=")
+		leaf, ok := leaves[key]
+		if !ok {
+			return nil, fmt.Errorf("-set %s: unknown key", key)
+		}
+		if err := setLeaf(leaf, value); err != nil {
+			return nil, fmt.Errorf("-set %s: %w", key, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// EnvName returns the environment variable overriding a key
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// readFile overlays a JSON file; keys it omits keep their current values
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.path = path
+	return nil
+}
+
+// setFlags collects repeated -set flags
+type setFlags []string
+
+func (s *setFlags) String() string { return strings.Join(*s, ",") }
+
+func (s *setFlags) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("want key=value")
+	}
+	*s = append(*s, v)
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// leaves maps every overridable key ("final.mmr.lambda") to its field.
+// Strings, numbers, booleans, durations and integer lists are overridable;
+// structured lists such as coarse.rules are file-only.
+func (c *Config) leaves() map[string]reflect.Value {
+	leaves := make(map[string]reflect.Value)
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			key, field := prefix+name, v.Field(i)
+			switch {
+			case field.Type() == durationType:
+				leaves[key] = field
+			case field.Kind() == reflect.Struct:
+				walk(key+".", field)
+			case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Int:
+				leaves[key] = field
+			case field.Kind() != reflect.Slice:
+				leaves[key] = field
+			}
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return leaves
+}
+
+// setLeaf parses value into a leaf field
+func setLeaf(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var list []int
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return err
+			}
+			list = append(list, n)
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]reflect.Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,194 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// BloomFilter is a fixed-size bloom filter over item IDs. It is not safe for
+// concurrent use; SeenFilter guards its filters with a mutex.
+type BloomFilter struct {
+	bits     []uint64
+	m        uint64 // Number of bits
+	k        int    // Hash functions per key
+	n        int    // Keys added
+	capacity int    // Keys the filter was sized for
+}
+
+// NewBloomFilter sizes a filter for expected keys at the given false-positive rate
+func NewBloomFilter(expected int, fpRate float64) *BloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	// m = -n ln p / (ln 2)^2, k = m/n ln 2
+	m := uint64(math.Ceil(-float64(expected) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / float64(expected) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k, capacity: expected}
+}
+
+// locations derives the k bit positions of a key by double hashing
+func (b *BloomFilter) locations(id int, fn func(pos uint64) bool) {
+	h1 := mix64(uint64(id))
+	h2 := mix64(h1^0x9e3779b97f4a7c15) | 1
+	for i := 0; i < b.k; i++ {
+		if !fn((h1 + uint64(i)*h2) % b.m) {
+			return
+		}
+	}
+}
+
+// Add inserts an item ID
+func (b *BloomFilter) Add(id int) {
+	if b.Test(id) {
+		return
+	}
+	b.locations(id, func(pos uint64) bool {
+		b.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+	b.n++
+}
+
+// Test reports whether an item ID may have been added
+func (b *BloomFilter) Test(id int) bool {
+	found := true
+	b.locations(id, func(pos uint64) bool {
+		found = b.bits[pos/64]&(1<<(pos%64)) != 0
+		return found
+	})
+	return found
+}
+
+// Count returns the number of distinct keys added (up to false positives)
+func (b *BloomFilter) Count() int {
+	return b.n
+}
+
+// full reports whether the filter holds as many keys as it was sized for
+func (b *BloomFilter) full() bool {
+	return b.n >= b.capacity
+}
+
+// ScalableBloomFilter grows by chaining filters of doubling capacity and
+// halving false-positive rate, so the compound rate stays below the target
+// however many keys are added (Almeida et al., 2007).
+type ScalableBloomFilter struct {
+	stages   []*BloomFilter
+	capacity int     // Capacity of the first stage
+	fpRate   float64 // Compound false-positive target
+}
+
+// NewScalableBloomFilter creates a filter starting at capacity keys
+func NewScalableBloomFilter(capacity int, fpRate float64) *ScalableBloomFilter {
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	return &ScalableBloomFilter{capacity: capacity, fpRate: fpRate}
+}
+
+// Add inserts an item ID, opening a new stage when the last one is full
+func (s *ScalableBloomFilter) Add(id int) {
+	if s.Test(id) {
+		return
+	}
+	if len(s.stages) == 0 || s.stages[len(s.stages)-1].full() {
+		// Stage i gets p0 * 2^-i with p0 = p/2, summing to at most p
+		i := len(s.stages)
+		capacity := s.capacity << uint(i)
+		fp := s.fpRate / 2 * math.Pow(0.5, float64(i))
+		s.stages = append(s.stages, NewBloomFilter(capacity, fp))
+	}
+	s.stages[len(s.stages)-1].Add(id)
+}
+
+// Test reports whether an item ID may have been added
+func (s *ScalableBloomFilter) Test(id int) bool {
+	for _, stage := range s.stages {
+		if stage.Test(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of distinct keys added (up to false positives)
+func (s *ScalableBloomFilter) Count() int {
+	n := 0
+	for _, stage := range s.stages {
+		n += stage.n
+	}
+	return n
+}
+
+var errCorruptFilter = errors.New("corrupt bloom filter encoding")
+
+// writeTo appends the binary encoding of the filter
+func (b *BloomFilter) writeTo(w io.Writer) error {
+	header := []uint64{b.m, uint64(b.k), uint64(b.n), uint64(b.capacity)}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, b.bits)
+}
+
+// readBloomFilter decodes a filter written by writeTo
+func readBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	m := header[0]
+	if m == 0 || m > 1<<32 || header[1] == 0 || header[1] > 64 {
+		return nil, errCorruptFilter
+	}
+	b := &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: int(header[1]), n: int(header[2]), capacity: int(header[3])}
+	if err := binary.Read(r, binary.LittleEndian, b.bits); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeTo appends the binary encoding of the filter and its stages
+func (s *ScalableBloomFilter) writeTo(w io.Writer) error {
+	header := []uint64{uint64(s.capacity), math.Float64bits(s.fpRate), uint64(len(s.stages))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, stage := range s.stages {
+		if err := stage.writeTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readScalableBloomFilter decodes a filter written by writeTo
+func readScalableBloomFilter(r io.Reader) (*ScalableBloomFilter, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if header[2] > 64 {
+		return nil, errCorruptFilter
+	}
+	s := &ScalableBloomFilter{capacity: int(header[0]), fpRate: math.Float64frombits(header[1])}
+	for i := uint64(0); i < header[2]; i++ {
+		stage, err := readBloomFilter(r)
+		if err != nil {
+			return nil, err
+		}
+		s.stages = append(s.stages, stage)
+	}
+	return s, nil
+}
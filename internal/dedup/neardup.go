@@ -0,0 +1,272 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Representative policies: which listing of a near-duplicate cluster is kept
+const (
+	KeepHighestScore  = "highest_score"
+	KeepLowestPrice   = "lowest_price"
+	KeepHighestRating = "highest_rating"
+)
+
+// NearDupConfig controls near-duplicate detection
+type NearDupConfig struct {
+	Enabled            bool    `json:"enabled"`
+	ShingleSize        int     `json:"shingle_size"`        // Character shingle length on normalized titles
+	Bands              int     `json:"bands"`               // LSH bands
+	RowsPerBand        int     `json:"rows_per_band"`       // MinHash values per band (Bands*RowsPerBand hashes)
+	TitleThreshold     float64 `json:"title_threshold"`     // Min shingle Jaccard similarity of titles
+	EmbeddingThreshold float64 `json:"embedding_threshold"` // If > 0, pairs must also have cosine >= this
+	RequireSameBrand   bool    `json:"require_same_brand"`
+	Policy             string  `json:"policy"` // KeepHighestScore, KeepLowestPrice or KeepHighestRating
+}
+
+// DefaultNearDupConfig returns the default near-duplicate settings
+func DefaultNearDupConfig() NearDupConfig {
+	return NearDupConfig{
+		Enabled:          true,
+		ShingleSize:      4,
+		Bands:            16,
+		RowsPerBand:      4, // 64 MinHash values; ~50% catch rate at J=0.5, ~99% at J=0.8
+		TitleThreshold:   0.7,
+		RequireSameBrand: true,
+		Policy:           KeepHighestScore,
+	}
+}
+
+// accentFolder maps common accented letters to ASCII ("Hermès" ~ "Hermes")
+var accentFolder = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// normalizeTitle lowercases, folds accents and reduces punctuation to spaces
+func normalizeTitle(title string) string {
+	title = accentFolder.Replace(strings.ToLower(title))
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, title)
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// shingles returns the set of hashed character k-grams of a normalized title
+func shingles(title string, k int) map[uint64]bool {
+	runes := []rune(normalizeTitle(title))
+	set := make(map[uint64]bool)
+	if len(runes) == 0 {
+		return set
+	}
+	if len(runes) < k {
+		set[hashString(string(runes))] = true
+		return set
+	}
+	for i := 0; i+k <= len(runes); i++ {
+		set[hashString(string(runes[i:i+k]))] = true
+	}
+	return set
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix64 is the splitmix64 finalizer, used to derive independent hash functions
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// minhash computes the MinHash signature of a shingle set
+func minhash(set map[uint64]bool, n int) []uint64 {
+	sig := make([]uint64, n)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	for sh := range set {
+		for i := range sig {
+			if h := mix64(sh ^ uint64(i+1)*0x9e3779b97f4a7c15); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+// jaccard computes the exact Jaccard similarity of two shingle sets
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for sh := range a {
+		if b[sh] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// unionFind groups near-duplicate items into clusters
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra != rb {
+		uf[rb] = ra
+	}
+}
+
+// collapseNearDuplicates clusters listings of the same product and keeps one
+// representative per cluster, recording the collapsed listings on it. Items
+// must already be unique by ItemID. Output preserves the position of each
+// cluster's first member.
+func (s *Service) collapseNearDuplicates(items []store.Item) []store.Item {
+	cfg := s.nearDup
+	if !cfg.Enabled || len(items) < 2 {
+		return items
+	}
+
+	sets := make([]map[uint64]bool, len(items))
+	buckets := make(map[string][]int)
+	key := make([]byte, 8*cfg.RowsPerBand+2)
+	for i, item := range items {
+		sets[i] = shingles(item.Title, cfg.ShingleSize)
+		if len(sets[i]) == 0 {
+			continue
+		}
+		sig := minhash(sets[i], cfg.Bands*cfg.RowsPerBand)
+		for b := 0; b < cfg.Bands; b++ {
+			binary.LittleEndian.PutUint16(key, uint16(b))
+			for r := 0; r < cfg.RowsPerBand; r++ {
+				binary.LittleEndian.PutUint64(key[2+8*r:], sig[b*cfg.RowsPerBand+r])
+			}
+			buckets[string(key)] = append(buckets[string(key)], i)
+		}
+	}
+
+	// Verify LSH candidate pairs exactly
+	uf := newUnionFind(len(items))
+	checked := make(map[[2]int]bool)
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				a, b := members[x], members[y]
+				pair := [2]int{a, b}
+				if checked[pair] || uf.find(a) == uf.find(b) {
+					continue
+				}
+				checked[pair] = true
+				if s.isNearDuplicate(&items[a], &items[b], sets[a], sets[b]) {
+					uf.union(a, b)
+				}
+			}
+		}
+	}
+
+	clusters := make(map[int][]int)
+	var roots []int
+	for i := range items {
+		root := uf.find(i)
+		if _, ok := clusters[root]; !ok {
+			roots = append(roots, root)
+		}
+		clusters[root] = append(clusters[root], i)
+	}
+	if len(roots) == len(items) {
+		return items
+	}
+
+	result := make([]store.Item, 0, len(roots))
+	for _, root := range roots {
+		members := clusters[root]
+		best := members[0]
+		for _, m := range members[1:] {
+			if s.preferred(items[m], items[best]) {
+				best = m
+			}
+		}
+		kept := items[best]
+		for _, m := range members {
+			if m != best {
+				kept.VariantIDs = append(kept.VariantIDs, items[m].ItemID)
+			}
+		}
+		kept.Variants = len(kept.VariantIDs)
+		result = append(result, kept)
+	}
+	return result
+}
+
+// isNearDuplicate decides whether two listings describe the same product
+func (s *Service) isNearDuplicate(a, b *store.Item, sa, sb map[uint64]bool) bool {
+	cfg := s.nearDup
+	if cfg.RequireSameBrand && !strings.EqualFold(normalizeTitle(a.Brand), normalizeTitle(b.Brand)) {
+		return false
+	}
+	if jaccard(sa, sb) < cfg.TitleThreshold {
+		return false
+	}
+	if cfg.EmbeddingThreshold > 0 && s.embeddingOf != nil {
+		ea, eb := s.embeddingOf(a.ItemID), s.embeddingOf(b.ItemID)
+		if len(ea) > 0 && len(eb) > 0 && store.CosineSimilarity(ea, eb) < cfg.EmbeddingThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+// preferred reports whether a should represent its cluster instead of b
+func (s *Service) preferred(a, b store.Item) bool {
+	// A sold-out listing never represents an available one
+	if (a.Stock > 0) != (b.Stock > 0) {
+		return a.Stock > 0
+	}
+	switch s.nearDup.Policy {
+	case KeepLowestPrice:
+		if a.PriceCents != b.PriceCents {
+			return a.PriceCents < b.PriceCents
+		}
+	case KeepHighestRating:
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+	}
+	return s.calculateScore(a) > s.calculateScore(b)
+}
@@ -0,0 +1,396 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// SeenConfig controls the per-user seen-filter
+type SeenConfig struct {
+	Capacity    int           // Items per filter before it grows
+	FPRate      float64       // Target false-positive rate of each filter
+	Window      time.Duration // Span of one generation
+	Generations int           // Generations kept; older exposures are forgotten
+	ClickWeight int           // A click counts as this many impressions
+	DemoteAfter int           // Exposures before an item is moved to the end; 0 disables
+	RemoveAfter int           // Exposures before an item is dropped; 0 disables
+}
+
+// DefaultSeenConfig returns the default seen-filter settings: exposures are
+// remembered for a week in daily generations
+func DefaultSeenConfig() SeenConfig {
+	return SeenConfig{
+		Capacity:    256,
+		FPRate:      0.01,
+		Window:      24 * time.Hour,
+		Generations: 7,
+		ClickWeight: 2,
+		DemoteAfter: 3,
+		RemoveAfter: 6,
+	}
+}
+
+// ttl is how long an exposure is remembered
+func (c SeenConfig) ttl() time.Duration {
+	return c.Window * time.Duration(c.Generations)
+}
+
+// maxCount is the exposure count beyond which counting saturates
+func (c SeenConfig) maxCount() int {
+	n := 1
+	if c.DemoteAfter > n {
+		n = c.DemoteAfter
+	}
+	if c.RemoveAfter > n {
+		n = c.RemoveAfter
+	}
+	return n
+}
+
+// SeenStore persists serialized seen-filters; *store.Service implements it
+type SeenStore interface {
+	LoadSeenFilter(userID string) ([]byte, error)
+	SaveSeenFilters(filters map[string][]byte) error
+	DeleteSeenFiltersBefore(cutoff time.Time) (int64, error)
+}
+
+// seenGeneration holds the exposures of one time window. levels[j] contains
+// the items exposed more than j times, so the count of an item is the number
+// of leading levels that contain it.
+type seenGeneration struct {
+	start  time.Time
+	levels []*ScalableBloomFilter
+}
+
+func (g *seenGeneration) count(id int) int {
+	n := 0
+	for _, level := range g.levels {
+		if !level.Test(id) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// userSeen is the seen state of one user, oldest generation first
+type userSeen struct {
+	generations []*seenGeneration
+	lastUsed    time.Time
+	dirty       bool // Changed since the last flush
+}
+
+// SeenFilter counts, per user, how often each item has been shown or
+// clicked, so feeds can demote or remove items the user has seen too often.
+// Counts are kept in bloom filters bucketed into time generations that age
+// out after Window*Generations. Filters are cached in memory and written
+// behind to a SeenStore by Flush. It is safe for concurrent use.
+type SeenFilter struct {
+	cfg     SeenConfig
+	backend SeenStore // nil keeps filters in memory only
+
+	mu     sync.Mutex
+	users  map[string]*userSeen
+	hits   int64 // User lookups served from memory
+	misses int64 // User lookups that loaded from the backend
+	now    func() time.Time
+}
+
+// NewSeenFilter creates a seen-filter. backend may be nil.
+func NewSeenFilter(cfg SeenConfig, backend SeenStore) *SeenFilter {
+	return &SeenFilter{
+		cfg:     cfg,
+		backend: backend,
+		users:   make(map[string]*userSeen),
+		now:     time.Now,
+	}
+}
+
+// user returns the cached state of a user, loading it from the backend on
+// first use. Must be called with f.mu held; the lock is released while loading.
+func (f *SeenFilter) user(userID string) *userSeen {
+	if u, ok := f.users[userID]; ok {
+		f.hits++
+		return u
+	}
+	f.misses++
+
+	u := &userSeen{}
+	if f.backend != nil {
+		f.mu.Unlock()
+		data, err := f.backend.LoadSeenFilter(userID)
+		f.mu.Lock()
+		if cached, ok := f.users[userID]; ok {
+			return cached // Loaded concurrently
+		}
+		if err != nil {
+			log.Printf("Seen filter load error for %q: %v", userID, err)
+		} else if data != nil {
+			if u.generations, err = decodeGenerations(data); err != nil {
+				log.Printf("Seen filter for %q discarded: %v", userID, err)
+				u.generations = nil
+			}
+		}
+	}
+	f.users[userID] = u
+	return u
+}
+
+// CacheStats returns how many user lookups were served from memory and how
+// many had to load from the backend
+func (f *SeenFilter) CacheStats() (hits, misses int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits, f.misses
+}
+
+// expire drops generations older than the TTL
+func (f *SeenFilter) expire(u *userSeen, now time.Time) {
+	cutoff := now.Add(-f.cfg.ttl())
+	keep := 0
+	for keep < len(u.generations) && !u.generations[keep].start.After(cutoff) {
+		keep++
+	}
+	if keep > 0 {
+		u.generations = u.generations[keep:]
+		u.dirty = true
+	}
+}
+
+// record adds weight exposures of each item to the user's current generation
+func (f *SeenFilter) record(userID string, ids []int, weight int) {
+	if userID == "" || len(ids) == 0 || weight <= 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	u := f.user(userID)
+	f.expire(u, now)
+	if len(u.generations) == 0 || now.Sub(u.generations[len(u.generations)-1].start) >= f.cfg.Window {
+		u.generations = append(u.generations, &seenGeneration{start: now})
+	}
+	gen := u.generations[len(u.generations)-1]
+
+	maxCount := f.cfg.maxCount()
+	for _, id := range ids {
+		for w, n := 0, gen.count(id); w < weight && n < maxCount; w, n = w+1, n+1 {
+			if n == len(gen.levels) {
+				gen.levels = append(gen.levels, NewScalableBloomFilter(f.cfg.Capacity, f.cfg.FPRate))
+			}
+			gen.levels[n].Add(id)
+		}
+	}
+	u.lastUsed = now
+	u.dirty = true
+}
+
+// RecordImpressions records items shown to a user. Anonymous users are ignored.
+func (f *SeenFilter) RecordImpressions(userID string, ids []int) {
+	f.record(userID, ids, 1)
+}
+
+// RecordClick records an engagement, which counts as ClickWeight impressions
+func (f *SeenFilter) RecordClick(userID string, itemID int) {
+	f.record(userID, []int{itemID}, f.cfg.ClickWeight)
+}
+
+// counts returns the exposure count of each item for a user, or nil if the
+// user has no history
+func (f *SeenFilter) counts(userID string, items []store.Item) []int {
+	if userID == "" || len(items) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	u := f.user(userID)
+	f.expire(u, now)
+	u.lastUsed = now
+	if len(u.generations) == 0 {
+		return nil
+	}
+	counts := make([]int, len(items))
+	for i, item := range items {
+		for _, gen := range u.generations {
+			counts[i] += gen.count(item.ItemID)
+		}
+	}
+	return counts
+}
+
+// Count returns how often an item was exposed to a user within the TTL,
+// saturating at max(DemoteAfter, RemoveAfter)
+func (f *SeenFilter) Count(userID string, itemID int) int {
+	counts := f.counts(userID, []store.Item{{ItemID: itemID}})
+	if counts == nil {
+		return 0
+	}
+	return counts[0]
+}
+
+// FilterUnseen returns the items the user has not been exposed to, in order
+func (f *SeenFilter) FilterUnseen(userID string, items []store.Item) []store.Item {
+	counts := f.counts(userID, items)
+	if counts == nil {
+		return items
+	}
+	result := make([]store.Item, 0, len(items))
+	for i, item := range items {
+		if counts[i] == 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Apply drops items exposed at least RemoveAfter times and moves items
+// exposed at least DemoteAfter times behind the rest, keeping relative order
+func (f *SeenFilter) Apply(userID string, items []store.Item) []store.Item {
+	counts := f.counts(userID, items)
+	if counts == nil {
+		return items
+	}
+	result := make([]store.Item, 0, len(items))
+	var demoted []store.Item
+	for i, item := range items {
+		switch {
+		case f.cfg.RemoveAfter > 0 && counts[i] >= f.cfg.RemoveAfter:
+		case f.cfg.DemoteAfter > 0 && counts[i] >= f.cfg.DemoteAfter:
+			demoted = append(demoted, item)
+		default:
+			result = append(result, item)
+		}
+	}
+	return append(result, demoted...)
+}
+
+// Flush writes changed filters to the backend, evicts users idle for longer
+// than the TTL from memory and deletes their expired rows
+func (f *SeenFilter) Flush() error {
+	now := f.now()
+	f.mu.Lock()
+	dirty := make(map[string][]byte)
+	for userID, u := range f.users {
+		if u.dirty {
+			f.expire(u, now)
+			data, err := encodeGenerations(u.generations)
+			if err != nil {
+				f.mu.Unlock()
+				return err
+			}
+			dirty[userID] = data
+			u.dirty = false
+		} else if now.Sub(u.lastUsed) > f.cfg.ttl() {
+			delete(f.users, userID)
+		}
+	}
+	f.mu.Unlock()
+
+	if f.backend == nil {
+		return nil
+	}
+	if err := f.backend.SaveSeenFilters(dirty); err != nil {
+		// Mark the users dirty again so the next flush retries
+		f.mu.Lock()
+		for userID := range dirty {
+			if u, ok := f.users[userID]; ok {
+				u.dirty = true
+			}
+		}
+		f.mu.Unlock()
+		return err
+	}
+	_, err := f.backend.DeleteSeenFiltersBefore(now.Add(-f.cfg.ttl()))
+	return err
+}
+
+// Run flushes every interval until stop is closed
+func (f *SeenFilter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if err := f.Flush(); err != nil {
+				log.Printf("Seen filter flush error: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := f.Flush(); err != nil {
+				log.Printf("Seen filter flush error: %v", err)
+			}
+		}
+	}
+}
+
+// seenEncodingVersion prefixes serialized generations
+const seenEncodingVersion = 1
+
+// encodeGenerations serializes a user's generations
+func encodeGenerations(gens []*seenGeneration) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(seenEncodingVersion)
+	if err := binary.Write(&buf, binary.LittleEndian, uint64(len(gens))); err != nil {
+		return nil, err
+	}
+	for _, gen := range gens {
+		header := []uint64{uint64(gen.start.UnixNano()), uint64(len(gen.levels))}
+		if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+			return nil, err
+		}
+		for _, level := range gen.levels {
+			if err := level.writeTo(&buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeGenerations parses the output of encodeGenerations
+func decodeGenerations(data []byte) ([]*seenGeneration, error) {
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != seenEncodingVersion {
+		return nil, fmt.Errorf("unsupported seen filter version %d", version)
+	}
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > 1024 {
+		return nil, errCorruptFilter
+	}
+	gens := make([]*seenGeneration, 0, n)
+	for i := uint64(0); i < n; i++ {
+		header := make([]uint64, 2)
+		if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+			return nil, err
+		}
+		if header[1] > 1024 {
+			return nil, errCorruptFilter
+		}
+		gen := &seenGeneration{start: time.Unix(0, int64(header[0]))}
+		for j := uint64(0); j < header[1]; j++ {
+			level, err := readScalableBloomFilter(r)
+			if err != nil {
+				return nil, err
+			}
+			gen.levels = append(gen.levels, level)
+		}
+		gens = append(gens, gen)
+	}
+	return gens, nil
+}
@@ -6,18 +6,34 @@ import (
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
 
-// Service handles deduplication using min-heap and bloom filters
+// Service handles deduplication using a min-heap. It holds no per-request
+// state and is safe for concurrent use once configured; cross-request
+// suppression of already-served items lives in SeenFilter.
 type Service struct {
-	seen map[int]bool // Simple dedup map (could be replaced with bloom filter)
+	nearDup     NearDupConfig
+	embeddingOf func(itemID int) []float32 // Optional, for embedding confirmation
 }
 
 // NewService creates a new deduplication service
 func NewService() *Service {
 	return &Service{
-		seen: make(map[int]bool),
+		nearDup: DefaultNearDupConfig(),
 	}
 }
 
+// SetNearDupConfig replaces the near-duplicate detection settings.
+// Call it before the service starts handling requests.
+func (s *Service) SetNearDupConfig(cfg NearDupConfig) {
+	s.nearDup = cfg
+}
+
+// SetEmbeddingLookup provides item embeddings for the optional
+// embedding-distance check of near-duplicate pairs. Call it before the
+// service starts handling requests.
+func (s *Service) SetEmbeddingLookup(lookup func(itemID int) []float32) {
+	s.embeddingOf = lookup
+}
+
 // ItemHeap implements a min-heap of items ordered by score
 type ItemHeap []ScoredItem
 
@@ -42,23 +58,30 @@ func (h *ItemHeap) Pop() interface{} {
 	return item
 }
 
-// Deduplicate removes duplicate items and maintains top-N by score
+// Deduplicate removes duplicate items and near-duplicate listings and
+// maintains top-N by score
 func (s *Service) Deduplicate(items []store.Item) []store.Item {
 	// Initialize heap
 	h := &ItemHeap{}
 	heap.Init(h)
 
-	// Reset seen map for new deduplication session
-	s.seen = make(map[int]bool)
-
-	// Process items
+	// Drop exact duplicates by ItemID; the seen set is local to this call
+	seen := make(map[int]bool, len(items))
+	var unique []store.Item
 	for _, item := range items {
 		// Skip if already seen
-		if s.seen[item.ItemID] {
+		if seen[item.ItemID] {
 			continue
 		}
-		s.seen[item.ItemID] = true
+		seen[item.ItemID] = true
+		unique = append(unique, item)
+	}
 
+	// Collapse near-duplicate listings of the same product
+	unique = s.collapseNearDuplicates(unique)
+
+	// Process items
+	for _, item := range unique {
 		// Calculate basic score (can be improved)
 		score := s.calculateScore(item)
 
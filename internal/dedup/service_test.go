@@ -0,0 +1,140 @@
+package dedup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestDeduplicateCollapsesNearDuplicates(t *testing.T) {
+	items := []store.Item{
+		{ItemID: 1, Title: "Hermès Birkin 30cm Togo Leather", Brand: "Hermès", PriceCents: 1200000, Rating: 4.9, Stock: 1},
+		{ItemID: 2, Title: "Hermes Birkin 30cm Togo Leather Bag", Brand: "Hermes", PriceCents: 1150000, Rating: 4.7, Stock: 2},
+		{ItemID: 3, Title: "HERMES BIRKIN 30CM - TOGO LEATHER", Brand: "Hermès", PriceCents: 1300000, Rating: 4.8, Stock: 0},
+		{ItemID: 4, Title: "Hermès Kelly 28 Epsom", Brand: "Hermès", PriceCents: 900000, Rating: 4.8, Stock: 1},
+		{ItemID: 5, Title: "Gucci GG Marmont Small Shoulder Bag", Brand: "Gucci", PriceCents: 180000, Rating: 4.7, Stock: 3},
+		{ItemID: 1, Title: "Hermès Birkin 30cm Togo Leather", Brand: "Hermès", PriceCents: 1200000, Rating: 4.9, Stock: 1},
+	}
+
+	s := NewService()
+	cfg := DefaultNearDupConfig()
+	cfg.Policy = KeepLowestPrice
+	s.SetNearDupConfig(cfg)
+
+	result := s.Deduplicate(items)
+	if len(result) != 3 {
+		t.Fatalf("expected 3 items after collapsing, got %d: %+v", len(result), result)
+	}
+	byID := make(map[int]store.Item)
+	for _, it := range result {
+		byID[it.ItemID] = it
+	}
+	birkin, ok := byID[2]
+	if !ok {
+		t.Fatalf("expected cheapest in-stock Birkin (2) to be kept, got %+v", result)
+	}
+	if birkin.Variants != 2 || len(birkin.VariantIDs) != 2 {
+		t.Fatalf("expected 2 collapsed variants, got %+v", birkin)
+	}
+	if byID[4].Variants != 0 || byID[5].Variants != 0 {
+		t.Fatalf("distinct products must not be collapsed: %+v", result)
+	}
+}
+
+func TestNearDupEmbeddingConfirmation(t *testing.T) {
+	items := []store.Item{
+		{ItemID: 1, Title: "Chanel Classic Flap Bag Medium", Brand: "Chanel", Stock: 1},
+		{ItemID: 2, Title: "Chanel Classic Flap Bag Medium", Brand: "Chanel", Stock: 1},
+	}
+	s := NewService()
+	cfg := DefaultNearDupConfig()
+	cfg.EmbeddingThreshold = 0.95
+	s.SetNearDupConfig(cfg)
+	s.SetEmbeddingLookup(func(id int) []float32 {
+		if id == 1 {
+			return []float32{1, 0}
+		}
+		return []float32{0, 1}
+	})
+
+	if result := s.Deduplicate(items); len(result) != 2 {
+		t.Fatalf("dissimilar embeddings should veto the title match, got %d items", len(result))
+	}
+}
+
+// memSeenStore is an in-memory SeenStore
+type memSeenStore map[string][]byte
+
+func (m memSeenStore) LoadSeenFilter(userID string) ([]byte, error) { return m[userID], nil }
+func (m memSeenStore) SaveSeenFilters(filters map[string][]byte) error {
+	for k, v := range filters {
+		m[k] = v
+	}
+	return nil
+}
+func (m memSeenStore) DeleteSeenFiltersBefore(time.Time) (int64, error) { return 0, nil }
+
+func TestSeenFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	backend := memSeenStore{}
+	cfg := DefaultSeenConfig()
+	cfg.DemoteAfter, cfg.RemoveAfter = 2, 4
+	f := NewSeenFilter(cfg, backend)
+	f.now = func() time.Time { return now }
+
+	items := []store.Item{{ItemID: 1}, {ItemID: 2}, {ItemID: 3}, {ItemID: 4}}
+	f.RecordImpressions("alice", []int{1, 2, 3})
+	f.RecordImpressions("alice", []int{2})
+	f.RecordClick("alice", 3) // counts as two impressions
+	f.RecordImpressions("alice", []int{3})
+
+	if got := f.FilterUnseen("alice", items); len(got) != 1 || got[0].ItemID != 4 {
+		t.Fatalf("expected only item 4 unseen, got %+v", got)
+	}
+	got := f.Apply("alice", items)
+	order := make([]int, len(got))
+	for i, item := range got {
+		order[i] = item.ItemID
+	}
+	if fmt.Sprint(order) != "[1 4 2]" {
+		t.Fatalf("expected 2 demoted and 3 removed, got %v", order)
+	}
+	if got := f.Apply("bob", items); len(got) != 4 {
+		t.Fatalf("other users are unaffected, got %+v", got)
+	}
+
+	// Filters survive a restart through the backend
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewSeenFilter(cfg, backend)
+	restored.now = f.now
+	if c := restored.Count("alice", 3); c != 4 {
+		t.Fatalf("expected restored count 4, got %d", c)
+	}
+
+	// Exposures age out after Window*Generations
+	now = now.Add(cfg.Window * time.Duration(cfg.Generations))
+	if c := restored.Count("alice", 3); c != 0 {
+		t.Fatalf("expected exposures to expire, got count %d", c)
+	}
+}
+
+func TestScalableBloomFilterFalsePositives(t *testing.T) {
+	// Grows well past its initial capacity and stays near the target rate
+	bf := NewScalableBloomFilter(100, 0.01)
+	for id := 0; id < 5000; id++ {
+		bf.Add(id)
+	}
+	fp := 0
+	for id := 5000; id < 55000; id++ {
+		if bf.Test(id) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 50000; rate > 0.015 {
+		t.Fatalf("false-positive rate %.4f exceeds target", rate)
+	}
+}
@@ -0,0 +1,178 @@
+// Package itemsim computes item-to-item similarities from co-occurrence of
+// items within user sessions ("customers also bought").
+package itemsim
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Similarity measures for normalising co-occurrence counts
+const (
+	MeasureCosine  = "cosine"
+	MeasureJaccard = "jaccard"
+)
+
+// Config controls session building, normalisation and thresholds
+type Config struct {
+	SessionGap     time.Duration // Inactivity that ends a session
+	MaxSessionSize int           // Items beyond this in one session are ignored
+	Measure        string        // "cosine" or "jaccard"
+	ClickWeight    float64       // Weight of co-click similarity
+	BuyWeight      float64       // Weight of co-purchase similarity
+	MinCoCount     int           // Minimum sessions a pair must share
+	MinScore       float64       // Minimum blended score kept
+	TopK           int           // Related items kept per item
+}
+
+// DefaultConfig returns the settings used by the batch job
+func DefaultConfig() Config {
+	return Config{
+		SessionGap:     30 * time.Minute,
+		MaxSessionSize: 50,
+		Measure:        MeasureCosine,
+		ClickWeight:    1.0,
+		BuyWeight:      2.0,
+		MinCoCount:     2,
+		MinScore:       0.05,
+		TopK:           50,
+	}
+}
+
+type pairKey struct{ a, b int } // a < b
+
+// counter accumulates occurrence and co-occurrence counts for one signal
+type counter struct {
+	items map[int]int
+	pairs map[pairKey]int
+}
+
+func newCounter() *counter {
+	return &counter{items: make(map[int]int), pairs: make(map[pairKey]int)}
+}
+
+func (c *counter) add(session map[int]bool) {
+	ids := make([]int, 0, len(session))
+	for id := range session {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for i, a := range ids {
+		c.items[a]++
+		for _, b := range ids[i+1:] {
+			c.pairs[pairKey{a, b}]++
+		}
+	}
+}
+
+// Builder consumes time-ordered actions and produces similarities
+type Builder struct {
+	cfg    Config
+	clicks *counter // click, add_to_cart and buy all count as engagement
+	buys   *counter
+
+	user      string
+	last      time.Time
+	engaged   map[int]bool
+	purchased map[int]bool
+}
+
+// NewBuilder creates a builder with the given configuration
+func NewBuilder(cfg Config) *Builder {
+	return &Builder{
+		cfg:       cfg,
+		clicks:    newCounter(),
+		buys:      newCounter(),
+		engaged:   make(map[int]bool),
+		purchased: make(map[int]bool),
+	}
+}
+
+// Add feeds one action; actions must be ordered by user then timestamp
+func (b *Builder) Add(a store.SessionAction) {
+	newSession := a.UserID != b.user ||
+		(!a.Timestamp.IsZero() && !b.last.IsZero() && a.Timestamp.Sub(b.last) > b.cfg.SessionGap)
+	if newSession {
+		b.flush()
+		b.user = a.UserID
+	}
+	b.last = a.Timestamp
+
+	if len(b.engaged) < b.cfg.MaxSessionSize || b.engaged[a.ItemID] {
+		b.engaged[a.ItemID] = true
+	}
+	if a.ActionType == store.ActionBuy && (len(b.purchased) < b.cfg.MaxSessionSize || b.purchased[a.ItemID]) {
+		b.purchased[a.ItemID] = true
+	}
+}
+
+// flush closes the current session. Single-item sessions add no pairs but
+// still count towards the item's occurrences.
+func (b *Builder) flush() {
+	b.clicks.add(b.engaged)
+	b.buys.add(b.purchased)
+	b.engaged = make(map[int]bool)
+	b.purchased = make(map[int]bool)
+}
+
+// similarity normalises a co-occurrence count
+func (b *Builder) similarity(co, na, nb int) float64 {
+	if co == 0 {
+		return 0
+	}
+	if b.cfg.Measure == MeasureJaccard {
+		return float64(co) / float64(na+nb-co)
+	}
+	return float64(co) / math.Sqrt(float64(na)*float64(nb))
+}
+
+// Similarities returns the thresholded top-k related items for every item,
+// in both directions
+func (b *Builder) Similarities() []store.ItemSimilarity {
+	b.flush()
+
+	totalWeight := b.cfg.ClickWeight + b.cfg.BuyWeight
+	if totalWeight == 0 {
+		return nil
+	}
+
+	related := make(map[int][]store.ItemSimilarity)
+	for key, co := range b.clicks.pairs {
+		if co < b.cfg.MinCoCount {
+			continue
+		}
+		clickSim := b.similarity(co, b.clicks.items[key.a], b.clicks.items[key.b])
+		buySim := b.similarity(b.buys.pairs[key], b.buys.items[key.a], b.buys.items[key.b])
+		score := (b.cfg.ClickWeight*clickSim + b.cfg.BuyWeight*buySim) / totalWeight
+		if score < b.cfg.MinScore {
+			continue
+		}
+		related[key.a] = append(related[key.a], store.ItemSimilarity{ItemID: key.a, RelatedID: key.b, Score: score, CoCount: co})
+		related[key.b] = append(related[key.b], store.ItemSimilarity{ItemID: key.b, RelatedID: key.a, Score: score, CoCount: co})
+	}
+
+	ids := make([]int, 0, len(related))
+	for id := range related {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var sims []store.ItemSimilarity
+	for _, id := range ids {
+		list := related[id]
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Score != list[j].Score {
+				return list[i].Score > list[j].Score
+			}
+			return list[i].RelatedID < list[j].RelatedID
+		})
+		if len(list) > b.cfg.TopK {
+			list = list[:b.cfg.TopK]
+		}
+		sims = append(sims, list...)
+	}
+	return sims
+}
@@ -0,0 +1,66 @@
+package itemsim
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestBuilderSessionsAndThresholds(t *testing.T) {
+	cfg := DefaultConfig()
+	b := NewBuilder(cfg)
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	add := func(user string, item int, action string, offset time.Duration) {
+		b.Add(store.SessionAction{UserID: user, ItemID: item, ActionType: action, Timestamp: t0.Add(offset)})
+	}
+
+	// Items 1 and 2 are co-clicked in two sessions; 3 only once with 1
+	add("u1", 1, "click", 0)
+	add("u1", 2, "buy", time.Minute)
+	add("u1", 3, "click", 2*time.Hour) // new session after the gap
+	add("u2", 1, "click", 0)
+	add("u2", 2, "click", time.Minute)
+	add("u3", 1, "click", 0)
+	add("u3", 3, "click", time.Minute)
+
+	sims := b.Similarities()
+	if len(sims) != 2 {
+		t.Fatalf("expected 1 pair in both directions, got %+v", sims)
+	}
+	for _, sim := range sims {
+		pair := map[int]bool{sim.ItemID: true, sim.RelatedID: true}
+		if !pair[1] || !pair[2] || sim.CoCount != 2 {
+			t.Fatalf("unexpected similarity %+v", sim)
+		}
+		if sim.Score <= 0 || sim.Score > 1 {
+			t.Fatalf("score out of range: %+v", sim)
+		}
+	}
+}
+
+func TestBuilderCountsSingleItemSessions(t *testing.T) {
+	score := func(solo int) float64 {
+		b := NewBuilder(DefaultConfig())
+		for i := 0; i < 2; i++ {
+			user := fmt.Sprintf("pair%d", i)
+			b.Add(store.SessionAction{UserID: user, ItemID: 1, ActionType: store.ActionClick})
+			b.Add(store.SessionAction{UserID: user, ItemID: 2, ActionType: store.ActionClick})
+		}
+		// Item 1 is mostly engaged with on its own
+		for i := 0; i < solo; i++ {
+			b.Add(store.SessionAction{UserID: fmt.Sprintf("solo%d", i), ItemID: 1, ActionType: store.ActionClick})
+		}
+		sims := b.Similarities()
+		if len(sims) != 2 {
+			t.Fatalf("expected the 1-2 pair in both directions, got %+v", sims)
+		}
+		return sims[0].Score
+	}
+
+	together, alone := score(0), score(6)
+	if alone >= together {
+		t.Errorf("score with single-item sessions %v, want below %v", alone, together)
+	}
+}
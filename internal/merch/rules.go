@@ -0,0 +1,240 @@
+// Package merch applies merchandising query rules: synonym expansion,
+// redirects, pinned and banned items and boost/bury by item attributes.
+package merch
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Query match types
+const (
+	MatchExact    = "exact"    // The whole normalised query equals Query
+	MatchContains = "contains" // Query occurs in the query on word boundaries
+)
+
+var (
+	// ErrInvalidRule is wrapped by rule validation errors
+	ErrInvalidRule = errors.New("invalid query rule")
+	// ErrRuleNotFound is returned for unknown rule ids
+	ErrRuleNotFound = errors.New("query rule not found")
+)
+
+// Rule is a merchandising rule for the queries it matches
+//
+//	{"name": "lv", "match": "contains", "query": "lv", "synonyms": ["louis vuitton"]}
+//	{"name": "birkin", "match": "contains", "query": "birkin",
+//	 "pins": [{"item_id": 42, "position": 1}],
+//	 "boosts": [{"when": {"field": "brand", "op": "==", "value": "Hermès"}, "factor": 3}]}
+//	{"name": "sale", "match": "exact", "query": "sale", "redirect": "/sale"}
+type Rule struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Enabled  *bool  `json:"enabled,omitempty"` // Defaults to true
+	Match    string `json:"match"`
+	Query    string `json:"query"`
+	Priority int    `json:"priority,omitempty"` // Higher wins conflicting pins and redirects
+
+	Synonyms []string `json:"synonyms,omitempty"` // Replacements for Query, recalled alongside the original
+	Redirect string   `json:"redirect,omitempty"` // URL or path returned instead of results
+	Pins     []Pin    `json:"pins,omitempty"`
+	Bans     []int    `json:"bans,omitempty"` // Item ids never shown
+	Boosts   []Boost  `json:"boosts,omitempty"`
+}
+
+// Pin places an item at a 1-based position
+type Pin struct {
+	ItemID   int `json:"item_id"`
+	Position int `json:"position"`
+}
+
+// Boost multiplies the final score of items matching a condition. Factors
+// above 1 boost, factors between 0 and 1 bury.
+type Boost struct {
+	When   coarse.CondSpec `json:"when"`
+	Factor float64         `json:"factor"`
+}
+
+// compiledRule is a validated rule ready for matching
+type compiledRule struct {
+	Rule
+	query  string // Normalised
+	boosts []compiledBoost
+}
+
+type compiledBoost struct {
+	match  func(item *store.Item) bool
+	factor float64
+}
+
+// normalize lowercases a query and collapses whitespace
+func normalize(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// compile validates a rule
+func compile(r Rule) (*compiledRule, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidRule, r.Name, fmt.Sprintf(format, args...))
+	}
+	if r.Name == "" {
+		return nil, fmt.Errorf("%w: missing name", ErrInvalidRule)
+	}
+	if r.Match != MatchExact && r.Match != MatchContains {
+		return nil, invalid("match must be %s or %s", MatchExact, MatchContains)
+	}
+	c := &compiledRule{Rule: r, query: normalize(r.Query)}
+	if c.query == "" {
+		return nil, invalid("missing query")
+	}
+	if r.Redirect != "" {
+		if u, err := url.Parse(r.Redirect); err != nil || (u.Scheme == "" && !strings.HasPrefix(r.Redirect, "/")) {
+			return nil, invalid("redirect must be an absolute URL or path")
+		}
+	}
+	for _, syn := range r.Synonyms {
+		if normalize(syn) == "" {
+			return nil, invalid("empty synonym")
+		}
+	}
+	for _, p := range r.Pins {
+		if p.ItemID <= 0 || p.Position < 1 {
+			return nil, invalid("pin needs an item_id and a position >= 1")
+		}
+	}
+	for _, id := range r.Bans {
+		if id <= 0 {
+			return nil, invalid("invalid banned item id %d", id)
+		}
+	}
+	for i, b := range r.Boosts {
+		if b.Factor <= 0 {
+			return nil, invalid("boost %d: factor must be positive", i)
+		}
+		match, err := coarse.CompileCondition(b.When)
+		if err != nil {
+			return nil, invalid("boost %d: %v", i, err)
+		}
+		c.boosts = append(c.boosts, compiledBoost{match: match, factor: b.Factor})
+	}
+	return c, nil
+}
+
+// ruleSet is an immutable list of enabled rules, highest priority first
+type ruleSet struct {
+	all   []Rule // Every stored rule, by id
+	rules []*compiledRule
+}
+
+func newRuleSet(rules []Rule, compiled []*compiledRule) *ruleSet {
+	rs := &ruleSet{all: rules}
+	for _, c := range compiled {
+		if c.Enabled == nil || *c.Enabled {
+			rs.rules = append(rs.rules, c)
+		}
+	}
+	sort.SliceStable(rs.rules, func(i, j int) bool {
+		if rs.rules[i].Priority != rs.rules[j].Priority {
+			return rs.rules[i].Priority > rs.rules[j].Priority
+		}
+		return rs.rules[i].ID < rs.rules[j].ID
+	})
+	return rs
+}
+
+// matches reports whether a rule applies to a normalised query
+func (c *compiledRule) matches(query string) bool {
+	if c.Match == MatchExact {
+		return query == c.query
+	}
+	return strings.Contains(" "+query+" ", " "+c.query+" ")
+}
+
+// Plan is the combined effect of the rules matching a query
+type Plan struct {
+	Rules      []string // Names of the matched rules, highest priority first
+	Redirect   string
+	Expansions []string // Rewritten queries recalled alongside the original
+	Pins       []Pin
+	banned     map[int]bool
+	boosts     []compiledBoost
+}
+
+// plan combines the rules matching a query
+func (rs *ruleSet) plan(query string) *Plan {
+	p := &Plan{banned: make(map[int]bool)}
+	query = normalize(query)
+	if query == "" {
+		return p
+	}
+	expanded := map[string]bool{query: true}
+	for _, c := range rs.rules {
+		if !c.matches(query) {
+			continue
+		}
+		p.Rules = append(p.Rules, c.Name)
+		if p.Redirect == "" {
+			p.Redirect = c.Redirect
+		}
+		for _, syn := range c.Synonyms {
+			rewritten := strings.TrimSpace(strings.Replace(" "+query+" ", " "+c.query+" ", " "+normalize(syn)+" ", 1))
+			if !expanded[rewritten] {
+				expanded[rewritten] = true
+				p.Expansions = append(p.Expansions, rewritten)
+			}
+		}
+		p.Pins = append(p.Pins, c.Pins...)
+		for _, id := range c.Bans {
+			p.banned[id] = true
+		}
+		p.boosts = append(p.boosts, c.boosts...)
+	}
+	return p
+}
+
+// Banned reports whether a matched rule bans the item
+func (p *Plan) Banned(itemID int) bool {
+	return p.banned[itemID]
+}
+
+// Filter drops banned items
+func (p *Plan) Filter(items []store.Item) []store.Item {
+	if len(p.banned) == 0 {
+		return items
+	}
+	kept := make([]store.Item, 0, len(items))
+	for _, item := range items {
+		if !p.banned[item.ItemID] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// Boost returns the product of the boost factors matching an item
+func (p *Plan) Boost(item store.Item) float64 {
+	factor := 1.0
+	for _, b := range p.boosts {
+		if b.match(&item) {
+			factor *= b.factor
+		}
+	}
+	return factor
+}
+
+// PinnedIDs returns the ids of the pinned items that are not banned
+func (p *Plan) PinnedIDs() []int {
+	var ids []int
+	for _, pin := range p.Pins {
+		if !p.banned[pin.ItemID] {
+			ids = append(ids, pin.ItemID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,87 @@
+package merch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank/coarse"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func mustRuleSet(t *testing.T, rules ...Rule) *ruleSet {
+	t.Helper()
+	var compiled []*compiledRule
+	for i := range rules {
+		rules[i].ID = i + 1
+		c, err := compile(rules[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		compiled = append(compiled, c)
+	}
+	return newRuleSet(rules, compiled)
+}
+
+func TestPlanCombinesMatchingRules(t *testing.T) {
+	off := false
+	rs := mustRuleSet(t,
+		Rule{Name: "lv", Match: MatchContains, Query: "LV", Synonyms: []string{"Louis Vuitton"}},
+		Rule{Name: "birkin", Match: MatchContains, Query: "birkin", Priority: 10,
+			Pins:   []Pin{{ItemID: 7, Position: 1}},
+			Bans:   []int{9},
+			Boosts: []Boost{{When: coarse.CondSpec{Field: "brand", Op: "==", Value: "Hermès"}, Factor: 3}}},
+		Rule{Name: "sale", Match: MatchExact, Query: "sale", Redirect: "/sale"},
+		Rule{Name: "disabled", Match: MatchContains, Query: "bag", Enabled: &off, Bans: []int{1}},
+	)
+
+	p := rs.plan("  LV   Birkin bag ")
+	if want := []string{"birkin", "lv"}; !reflect.DeepEqual(p.Rules, want) {
+		t.Errorf("rules = %v, want %v", p.Rules, want)
+	}
+	if want := []string{"louis vuitton birkin bag"}; !reflect.DeepEqual(p.Expansions, want) {
+		t.Errorf("expansions = %v, want %v", p.Expansions, want)
+	}
+	if p.Redirect != "" {
+		t.Errorf("redirect = %q, want none", p.Redirect)
+	}
+	if !p.Banned(9) || p.Banned(1) {
+		t.Errorf("banned 9=%v 1=%v, want true false", p.Banned(9), p.Banned(1))
+	}
+	if got := p.Filter([]store.Item{{ItemID: 9}, {ItemID: 2}}); len(got) != 1 || got[0].ItemID != 2 {
+		t.Errorf("filter kept %v", got)
+	}
+	if got := p.Boost(store.Item{Brand: "hermès"}); got != 3 {
+		t.Errorf("boost = %v, want 3", got)
+	}
+	if got := p.PinnedIDs(); !reflect.DeepEqual(got, []int{7}) {
+		t.Errorf("pinned = %v", got)
+	}
+
+	if p := rs.plan("sale"); p.Redirect != "/sale" {
+		t.Errorf("exact match redirect = %q", p.Redirect)
+	}
+	if p := rs.plan("summer sale"); p.Redirect != "" || len(p.Rules) != 0 {
+		t.Errorf("exact rule matched a longer query: %+v", p)
+	}
+	if p := rs.plan("lvmh"); len(p.Rules) != 0 {
+		t.Errorf("contains rule matched inside a word: %v", p.Rules)
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	cases := []Rule{
+		{Match: MatchExact, Query: "x"},
+		{Name: "bad match", Match: "regex", Query: "x"},
+		{Name: "no query", Match: MatchExact, Query: "  "},
+		{Name: "bad pin", Match: MatchExact, Query: "x", Pins: []Pin{{ItemID: 1}}},
+		{Name: "bad redirect", Match: MatchExact, Query: "x", Redirect: "sale"},
+		{Name: "bad factor", Match: MatchExact, Query: "x", Boosts: []Boost{{When: coarse.CondSpec{Field: "brand", Op: "==", Value: "A"}}}},
+		{Name: "bad cond", Match: MatchExact, Query: "x", Boosts: []Boost{{When: coarse.CondSpec{Field: "color", Op: "==", Value: "red"}, Factor: 2}}},
+	}
+	for _, r := range cases {
+		if _, err := compile(r); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%q: err = %v, want ErrInvalidRule", r.Name, err)
+		}
+	}
+}
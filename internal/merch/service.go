@@ -0,0 +1,126 @@
+package merch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Service manages query rules stored in the database. Matching reads an
+// immutable snapshot and is safe for concurrent use; changes made through
+// the service are persisted and take effect immediately.
+type Service struct {
+	store *store.Service
+	mu    sync.Mutex // Serialises changes
+	rules atomic.Pointer[ruleSet]
+}
+
+// NewService creates a query rules service with no rules loaded
+func NewService(storeService *store.Service) *Service {
+	s := &Service{store: storeService}
+	s.rules.Store(newRuleSet(nil, nil))
+	return s
+}
+
+// Load reads every stored rule. Rules that no longer compile are logged
+// and skipped.
+func (s *Service) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *Service) load() error {
+	records, err := s.store.GetQueryRules()
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	var compiled []*compiledRule
+	for _, rec := range records {
+		var r Rule
+		if err := json.Unmarshal(rec.Spec, &r); err != nil {
+			log.Printf("Query rule %d skipped: %v", rec.ID, err)
+			continue
+		}
+		r.ID = rec.ID
+		c, err := compile(r)
+		if err != nil {
+			log.Printf("Query rule %d skipped: %v", rec.ID, err)
+			continue
+		}
+		rules = append(rules, r)
+		compiled = append(compiled, c)
+	}
+	s.rules.Store(newRuleSet(rules, compiled))
+	return nil
+}
+
+// Rules returns every loaded rule ordered by id
+func (s *Service) Rules() []Rule {
+	return s.rules.Load().all
+}
+
+// Match returns the combined effect of the enabled rules matching a query
+func (s *Service) Match(query string) *Plan {
+	return s.rules.Load().plan(query)
+}
+
+// Create validates and stores a new rule
+func (s *Service) Create(r Rule) (Rule, error) {
+	if _, err := compile(r); err != nil {
+		return Rule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = 0
+	spec, err := json.Marshal(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	if r.ID, err = s.store.InsertQueryRule(spec); err != nil {
+		return Rule{}, err
+	}
+	return r, s.load()
+}
+
+// Update validates and replaces a stored rule
+func (s *Service) Update(id int, r Rule) (Rule, error) {
+	if _, err := compile(r); err != nil {
+		return Rule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = 0
+	spec, err := json.Marshal(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	if err := s.store.UpdateQueryRule(id, spec); errors.Is(err, sql.ErrNoRows) {
+		return Rule{}, ErrRuleNotFound
+	} else if err != nil {
+		return Rule{}, err
+	}
+	r.ID = id
+	return r, s.load()
+}
+
+// Delete removes a stored rule
+func (s *Service) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.DeleteQueryRule(id); errors.Is(err, sql.ErrNoRows) {
+		return ErrRuleNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.load()
+}
@@ -0,0 +1,334 @@
+// Package metrics is a small Prometheus-compatible metrics registry. It
+// supports labelled counters, gauges and histograms and writes them in the
+// text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are histogram upper bounds in seconds suited to request and
+// stage latencies
+var LatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Registry holds metrics in registration order. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+	collect  []func()
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// family is one named metric with all its label combinations
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// desc describes a metric family
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (r *Registry) register(d desc, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[d.name] {
+		panic("metrics: duplicate metric " + d.name)
+	}
+	r.names[d.name] = true
+	r.families = append(r.families, f)
+}
+
+// OnCollect registers fn to run before every write, typically to set gauges
+// from state owned elsewhere
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collect = append(r.collect, fn)
+}
+
+// Write writes every metric in the text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collect := append([]func(){}, r.collect...)
+	families := append([]family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, fn := range collect {
+		fn()
+	}
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP implements http.Handler, serving the metrics for scraping
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := r.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// vec keeps one value per label combination
+type vec[T any] struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string // Label values per series key
+	create func() *T
+}
+
+// init prepares a vec whose series are created by create
+func (v *vec[T]) init(d desc, create func() *T) {
+	v.desc, v.create = d, create
+	v.series = make(map[string]*T)
+	v.values = make(map[string][]string)
+	if len(d.labels) == 0 {
+		v.series[""], v.values[""] = create(), nil // Exposed as zero before first use
+	}
+}
+
+// get returns the series for labelValues, creating it on first use. Must be
+// called with v.mu held.
+func (v *vec[T]) get(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = v.create()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	return s
+}
+
+// each calls fn for every series ordered by label values. Must be called
+// with v.mu held.
+func (v *vec[T]) each(fn func(labelValues []string, s *T)) {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(v.values[k], v.series[k])
+	}
+}
+
+func (v *vec[T]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct {
+	vec[float64]
+}
+
+// Counter registers a counter with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{}
+	c.init(desc{name, help, "counter", labels}, func() *float64 { return new(float64) })
+	r.register(c.desc, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to a series
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " decreased")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(labelValues) += delta
+}
+
+// Value returns the current value of a series
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *c.get(labelValues)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	c.each(func(lv []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, lv), formatValue(*v))
+	})
+}
+
+// Gauge is a value per label combination that can go up and down
+type Gauge struct {
+	vec[float64]
+}
+
+// Gauge registers a gauge with the given label names
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{}
+	g.init(desc{name, help, "gauge", labels}, func() *float64 { return new(float64) })
+	r.register(g.desc, g)
+	return g
+}
+
+// Set sets the series with the given label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(labelValues) = value
+}
+
+// Value returns the current value of a series
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return *g.get(labelValues)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	g.each(func(lv []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, lv), formatValue(*v))
+	})
+}
+
+// Histogram counts observations into cumulative buckets per label combination
+type Histogram struct {
+	vec[histogramSeries]
+	buckets []float64 // Sorted upper bounds, without +Inf
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Histogram registers a histogram with the given bucket upper bounds and
+// label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &Histogram{buckets: bounds}
+	h.init(desc{name, help, "histogram", labels}, func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(bounds)+1)}
+	})
+	r.register(h.desc, h)
+	return h
+}
+
+// Observe records one value in the series with the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	i := sort.SearchFloat64s(h.buckets, value) // First bound >= value
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	s.counts[i]++
+	s.sum += value
+	s.count++
+}
+
+// ObserveDuration records a duration in seconds
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+// Count returns the number of observations in a series
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.get(labelValues).count
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	labels := append(append([]string(nil), h.labels...), "le")
+	h.each(func(lv []string, s *histogramSeries) {
+		var cumulative uint64
+		for i, n := range s.counts {
+			cumulative += n
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(lv[:len(lv):len(lv)], formatValue(le))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, lv), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, lv), s.count)
+	})
+}
+
+// formatLabels renders {name="value",...}, or nothing without labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
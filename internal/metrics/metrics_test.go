@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteExpositionFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.", "route", "code")
+	size := r.Gauge("index_size", "Indexed items.")
+	r.Counter("unused_total", "Never incremented.")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 0.01}, "stage")
+
+	requests.Inc("/search", "200")
+	requests.Add(2, "/search", "200")
+	requests.Inc(`/a"b`, "500")
+	r.OnCollect(func() { size.Set(42) })
+	latency.Observe(0.005, "ltr")
+	latency.Observe(0.05, "ltr")
+	latency.Observe(3, "ltr")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a\"b",code="500"} 1
+requests_total{route="/search",code="200"} 3
+# HELP index_size Indexed items.
+# TYPE index_size gauge
+index_size 42
+# HELP unused_total Never incremented.
+# TYPE unused_total counter
+unused_total 0
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{stage="ltr",le="0.01"} 1
+latency_seconds_bucket{stage="ltr",le="0.1"} 2
+latency_seconds_bucket{stage="ltr",le="+Inf"} 3
+latency_seconds_sum{stage="ltr"} 3.055
+latency_seconds_count{stage="ltr"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBucketBoundIsInclusive(t *testing.T) {
+	r := NewRegistry()
+	h := r.Histogram("h", "h", []float64{1})
+	h.Observe(1)
+
+	var b strings.Builder
+	r.Write(&b)
+	if !strings.Contains(b.String(), `h_bucket{le="1"} 1`) {
+		t.Errorf("observation equal to a bound belongs in its bucket:\n%s", b.String())
+	}
+}
@@ -0,0 +1,219 @@
+// Package promo turns merchandising campaigns into sponsored placements for
+// final ranking and paces them against their daily impression caps.
+package promo
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank/final"
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// dayFormat keys pacing counters by UTC day
+const dayFormat = "2006-01-02"
+
+// campaign is an active campaign with its items loaded
+type campaign struct {
+	store.Campaign
+	items []store.Item // In display order
+}
+
+// Service selects sponsored placements. It caches active campaigns and
+// today's impression counts, refreshing them periodically. It is safe for
+// concurrent use.
+type Service struct {
+	store        *store.Service
+	refreshEvery time.Duration
+	burst        float64 // Share of the daily cap allowed ahead of even pacing
+	targetWindow int     // Organic results checked for brand targeting
+	now          func() time.Time
+
+	mu        sync.Mutex
+	campaigns []campaign
+	loadedAt  time.Time
+	day       string
+	served    map[int]int // Impressions served today per campaign
+
+	hits, misses atomic.Int64 // Lookups served from the cache and reloads
+}
+
+// NewService creates a promotions service backed by the store
+func NewService(storeService *store.Service) *Service {
+	return &Service{
+		store:        storeService,
+		refreshEvery: 30 * time.Second,
+		burst:        0.1, // 10% of the cap may be spent early
+		targetWindow: 20,  // First page
+		now:          time.Now,
+		served:       make(map[int]int),
+	}
+}
+
+// refresh reloads campaigns and counters when stale or on a new day
+func (s *Service) refresh(now time.Time) error {
+	day := now.UTC().Format(dayFormat)
+	s.mu.Lock()
+	fresh := day == s.day && now.Sub(s.loadedAt) < s.refreshEvery
+	s.mu.Unlock()
+	if fresh {
+		s.hits.Add(1)
+		return nil
+	}
+	s.misses.Add(1)
+
+	active, err := s.store.GetActiveCampaigns(now)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, c := range active {
+		ids = append(ids, c.ItemIDs...)
+	}
+	items, err := s.store.GetItemsByIDs(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]store.Item, len(items))
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	campaigns := make([]campaign, 0, len(active))
+	for _, c := range active {
+		loaded := campaign{Campaign: c}
+		for _, id := range c.ItemIDs {
+			if item, ok := byID[id]; ok {
+				loaded.items = append(loaded.items, item)
+			}
+		}
+		campaigns = append(campaigns, loaded)
+	}
+	served, err := s.store.GetCampaignImpressions(day)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if day == s.day {
+		// Keep increments recorded while the counts were loading
+		for id, n := range s.served {
+			if n > served[id] {
+				served[id] = n
+			}
+		}
+	}
+	s.campaigns, s.served, s.day, s.loadedAt = campaigns, served, day, now
+	return nil
+}
+
+// CacheStats returns how many lookups were served from the campaign cache
+// and how many reloaded it
+func (s *Service) CacheStats() (hits, misses int64) {
+	return s.hits.Load(), s.misses.Load()
+}
+
+// paced reports whether a campaign may serve now under even daily pacing
+func (s *Service) paced(c *campaign, now time.Time) bool {
+	if c.DailyCap <= 0 {
+		return true
+	}
+	served := s.served[c.ID]
+	if served >= c.DailyCap {
+		return false
+	}
+	utc := now.UTC()
+	midnight := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+	elapsed := utc.Sub(midnight).Seconds() / (24 * 60 * 60)
+	budget := float64(c.DailyCap) * (elapsed + s.burst)
+	return float64(served) < budget || served == 0
+}
+
+// containsPhrase reports whether phrase occurs in text on word boundaries
+func containsPhrase(text, phrase string) bool {
+	return strings.Contains(" "+text+" ", " "+phrase+" ")
+}
+
+// matches reports whether a campaign targets the query or its top results.
+// A campaign without targets runs on every query.
+func (s *Service) matches(c *campaign, query string, organic []store.Item) bool {
+	if len(c.TargetQueries) == 0 && len(c.TargetBrands) == 0 {
+		return true
+	}
+	for _, term := range c.TargetQueries {
+		if containsPhrase(query, term) {
+			return true
+		}
+	}
+	if len(organic) > s.targetWindow {
+		organic = organic[:s.targetWindow]
+	}
+	for _, brand := range c.TargetBrands {
+		if containsPhrase(query, strings.ToLower(brand)) {
+			return true
+		}
+		for _, item := range organic {
+			if strings.EqualFold(item.Brand, brand) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Placements returns the sponsored placements for a query, highest priority
+// campaign first. organic is the ranked result list used for brand targeting.
+func (s *Service) Placements(query string, organic []store.Item) ([]final.Placement, error) {
+	now := s.now()
+	if err := s.refresh(now); err != nil {
+		return nil, err
+	}
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var placements []final.Placement
+	for i := range s.campaigns {
+		c := &s.campaigns[i]
+		if !s.matches(c, query, organic) || !s.paced(c, now) {
+			continue
+		}
+		var items []store.Item
+		for _, item := range c.items {
+			if item.Stock > 0 && len(items) < len(c.Positions) {
+				items = append(items, item)
+			}
+		}
+		for j, item := range items {
+			positions := c.Positions
+			if c.Placement == store.PlacementFixed {
+				positions = c.Positions[j : j+1]
+			}
+			placements = append(placements, final.Placement{Item: item, CampaignID: c.ID, Positions: positions})
+		}
+	}
+	return placements, nil
+}
+
+// RecordImpressions counts served sponsored slots towards pacing
+func (s *Service) RecordImpressions(slots []final.SponsoredSlot) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	counts := make(map[int]int)
+	for _, slot := range slots {
+		counts[slot.CampaignID]++
+	}
+
+	day := s.now().UTC().Format(dayFormat)
+	s.mu.Lock()
+	if day == s.day {
+		for id, n := range counts {
+			s.served[id] += n
+		}
+	}
+	s.mu.Unlock()
+	return s.store.AddCampaignImpressions(day, counts)
+}
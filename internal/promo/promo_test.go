@@ -0,0 +1,59 @@
+package promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestPacedSpreadsCapOverDay(t *testing.T) {
+	s := NewService(nil)
+	c := &campaign{Campaign: store.Campaign{ID: 1, DailyCap: 100}}
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		served int
+		at     time.Time
+		want   bool
+	}{
+		{0, noon, true},
+		{59, noon, true},  // Half the day plus 10% burst
+		{60, noon, false}, // Ahead of pace
+		{60, noon.Add(6 * time.Hour), true},
+		{100, noon.Add(11 * time.Hour), false}, // Cap reached
+		{0, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), true},
+	}
+	for _, tc := range cases {
+		s.served[c.ID] = tc.served
+		if got := s.paced(c, tc.at); got != tc.want {
+			t.Errorf("paced(served=%d, %s) = %v, want %v", tc.served, tc.at.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestMatchesTargets(t *testing.T) {
+	s := NewService(nil)
+	organic := []store.Item{{ItemID: 1, Brand: "Prada"}}
+
+	cases := []struct {
+		name    string
+		queries []string
+		brands  []string
+		query   string
+		want    bool
+	}{
+		{"untargeted", nil, nil, "anything", true},
+		{"query phrase", []string{"tote bag"}, nil, "black tote bag", true},
+		{"partial word", []string{"tote"}, nil, "totes", false},
+		{"brand in query", nil, []string{"Gucci"}, "gucci wallet", true},
+		{"brand in results", nil, []string{"Prada"}, "wallet", true},
+		{"no match", []string{"belt"}, []string{"Dior"}, "wallet", false},
+	}
+	for _, tc := range cases {
+		c := &campaign{Campaign: store.Campaign{TargetQueries: tc.queries, TargetBrands: tc.brands}}
+		if got := s.matches(c, tc.query, organic); got != tc.want {
+			t.Errorf("%s: matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
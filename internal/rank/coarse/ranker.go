@@ -1,36 +1,44 @@
 package coarse
 
 import (
+	"github.com/Boomshakalak/VibeRS/internal/rank"
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
 
 // Ranker implements coarse ranking with hard rules
 type Ranker struct {
-	// Configuration could be loaded from config file
-	minStock      int
-	maxPriceCents int
-	minRating     float64
+	// Hard rules are fixed for the ranker's lifetime; a rule change builds
+	// a new ranker
+	rules *RuleSet
+
+	keepTop int // Candidates passed on to LTR (0 = all)
 }
 
-// NewRanker creates a new coarse ranker
+// NewRanker creates a new coarse ranker with the built-in rules
 func NewRanker() *Ranker {
+	rs, err := CompileRules(DefaultRuleConfig())
+	if err != nil {
+		panic(err) // Built-in rules are static
+	}
+	return NewRankerWithRules(rs)
+}
+
+// NewRankerWithRules creates a new coarse ranker applying a compiled rule set
+func NewRankerWithRules(rs *RuleSet) *Ranker {
 	return &Ranker{
-		minStock:      1,       // At least 1 in stock
-		maxPriceCents: 2000000, // Max 20k USD
-		minRating:     3.0,     // Min 3.0 rating
+		rules:   rs,
+		keepTop: 500, // LTR sees at most the top 500
 	}
 }
 
 // Rank applies hard filtering rules and basic scoring
 func (r *Ranker) Rank(items []store.Item) []store.Item {
-	var filtered []store.Item
+	return r.RankWithContext(items, Context{})
+}
 
-	// Apply hard rules
-	for _, item := range items {
-		if r.passesHardRules(item) {
-			filtered = append(filtered, item)
-		}
-	}
+// RankWithContext applies hard rules that may depend on the request context
+func (r *Ranker) RankWithContext(items []store.Item, ctx Context) []store.Item {
+	filtered := r.Filter(items, ctx)
 
 	// Apply coarse scoring and sorting
 	scored := r.scoreItems(filtered)
@@ -38,46 +46,38 @@ func (r *Ranker) Rank(items []store.Item) []store.Item {
 	return scored
 }
 
-// passesHardRules checks if an item passes all hard filtering rules
-func (r *Ranker) passesHardRules(item store.Item) bool {
-	// Stock check
-	if item.Stock < r.minStock {
-		return false
+// Filter applies the hard rules only, keeping every passing item in its
+// original order regardless of the budget
+func (r *Ranker) Filter(items []store.Item, ctx Context) []store.Item {
+	var filtered []store.Item
+	for i := range items {
+		if r.Passes(&items[i], &ctx) {
+			filtered = append(filtered, items[i])
+		}
 	}
+	return filtered
+}
 
-	// Price check
-	if item.PriceCents > r.maxPriceCents {
-		return false
-	}
+// Passes reports whether an item satisfies the hard rules and the request's
+// filter, e.g. for items placed outside the ranked candidates
+func (r *Ranker) Passes(item *store.Item, ctx *Context) bool {
+	return r.rules.Passes(item, ctx) && (ctx.Filter == nil || ctx.Filter(*item))
+}
 
-	// Rating check
-	if item.Rating < r.minRating {
-		return false
-	}
+// Rules returns the ranker's rule set
+func (r *Ranker) Rules() *RuleSet {
+	return r.rules
+}
 
-	// Additional business rules can be added here
-	return true
+// SetBudget sets how many top candidates survive coarse ranking (0 = all)
+func (r *Ranker) SetBudget(keepTop int) {
+	r.keepTop = keepTop
 }
 
 // scoreItems applies coarse scoring logic
+// Each item is scored once; only the top keepTop are selected and sorted
 func (r *Ranker) scoreItems(items []store.Item) []store.Item {
-	// For now, just return items sorted by a simple formula
-	// In production, this could use a more sophisticated rule engine
-
-	// Simple bubble sort by composite score (for demonstration)
-	// In production, use sort.Slice
-	for i := 0; i < len(items); i++ {
-		for j := i + 1; j < len(items); j++ {
-			score1 := r.calculateCoarseScore(items[i])
-			score2 := r.calculateCoarseScore(items[j])
-
-			if score1 < score2 {
-				items[i], items[j] = items[j], items[i]
-			}
-		}
-	}
-
-	return items
+	return rank.TopK(items, r.keepTop, r.calculateCoarseScore)
 }
 
 // calculateCoarseScore calculates a coarse relevance score
@@ -0,0 +1,42 @@
+package coarse
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank/ranktest"
+)
+
+func BenchmarkRank1k(b *testing.B)  { ranktest.Benchmark(b, 1000, NewRanker().Rank) }
+func BenchmarkRank10k(b *testing.B) { ranktest.Benchmark(b, 10000, NewRanker().Rank) }
+
+func TestRankRespectsBudget(t *testing.T) {
+	items := ranktest.Items(1000)
+	// Every tenth item breaks a hard rule
+	for i := 0; i < len(items); i += 10 {
+		if i%20 == 0 {
+			items[i].Stock = 0
+		} else {
+			items[i].Rating = 2
+		}
+	}
+
+	r := NewRanker()
+	r.SetBudget(50)
+	ranked := r.Rank(items)
+	if len(ranked) != 50 {
+		t.Fatalf("expected 50 items, got %d", len(ranked))
+	}
+	for i, item := range ranked {
+		if item.Stock == 0 || item.Rating < 3 {
+			t.Fatalf("item %d breaks a hard rule but was kept", item.ItemID)
+		}
+		if i > 0 && r.calculateCoarseScore(item) > r.calculateCoarseScore(ranked[i-1]) {
+			t.Fatalf("position %d scores above position %d", i+1, i)
+		}
+	}
+
+	r.SetBudget(0)
+	if all := r.Rank(items); len(all) != 900 {
+		t.Fatalf("expected the 900 items passing the rules without a budget, got %d", len(all))
+	}
+}
@@ -0,0 +1,365 @@
+package coarse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Context carries per-request information rules may condition on
+type Context struct {
+	Query  string
+	UserID string
+	// Filter, when set, drops items failing the request's filters like a
+	// hard rule
+	Filter func(store.Item) bool
+	// Untracked leaves the rule counters alone, for rankings that serve
+	// no request such as reload canaries
+	Untracked bool
+}
+
+// RuleConfig is the declarative form of a rule set, loaded from JSON
+//
+//	{"rules": [
+//	  {"name": "in_stock", "when": {"field": "stock", "op": ">=", "value": 1}},
+//	  {"name": "no_replicas", "when": {"field": "brand", "op": "not_in", "values": ["Replica Co"]}},
+//	  {"name": "budget_queries_under_500",
+//	   "if":   {"field": "query", "op": "contains", "value": "cheap"},
+//	   "when": {"field": "price_cents", "op": "<=", "value": 50000}}
+//	]}
+//
+// An item is kept only if it satisfies the "when" condition of every rule
+// whose "if" condition holds for the request.
+type RuleConfig struct {
+	Rules []RuleSpec `json:"rules"`
+}
+
+// RuleSpec declares one hard rule
+type RuleSpec struct {
+	Name    string    `json:"name"`
+	Enabled *bool     `json:"enabled,omitempty"` // Defaults to true
+	If      *CondSpec `json:"if,omitempty"`      // Request context guard
+	When    CondSpec  `json:"when"`              // Condition items must satisfy
+}
+
+// CondSpec is a condition: exactly one of a comparison (field/op/value),
+// all, any or not
+type CondSpec struct {
+	Field  string        `json:"field,omitempty"`
+	Op     string        `json:"op,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+
+	All []CondSpec `json:"all,omitempty"`
+	Any []CondSpec `json:"any,omitempty"`
+	Not *CondSpec  `json:"not,omitempty"`
+}
+
+// DefaultRuleConfig returns the built-in hard rules
+func DefaultRuleConfig() RuleConfig {
+	return RuleConfig{Rules: []RuleSpec{
+		{Name: "min_stock", When: CondSpec{Field: "stock", Op: ">=", Value: 1.0}},             // At least 1 in stock
+		{Name: "max_price", When: CondSpec{Field: "price_cents", Op: "<=", Value: 2000000.0}}, // Max 20k USD
+		{Name: "min_rating", When: CondSpec{Field: "rating", Op: ">=", Value: 3.0}},           // Min 3.0 rating
+	}}
+}
+
+// predicate is a compiled condition
+type predicate func(item *store.Item, ctx *Context) bool
+
+// rule is a compiled RuleSpec with its counters
+type rule struct {
+	name      string
+	guard     predicate // nil means always applies
+	cond      predicate
+	evaluated atomic.Int64
+	hits      atomic.Int64 // Items this rule filtered out
+}
+
+// RuleSet is an immutable compiled set of rules
+type RuleSet struct {
+	rules    []*rule
+	loadedAt time.Time
+	source   string
+}
+
+// RuleStat reports how often a rule was evaluated and how many items it removed
+type RuleStat struct {
+	Name      string `json:"name"`
+	Evaluated int64  `json:"evaluated"`
+	Hits      int64  `json:"hits"`
+}
+
+// CompileRules validates and compiles a rule configuration
+func CompileRules(cfg RuleConfig) (*RuleSet, error) {
+	rs := &RuleSet{loadedAt: time.Now(), source: "default"}
+	names := make(map[string]bool)
+	for i, spec := range cfg.Rules {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("rule %d: missing name", i)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", spec.Name)
+		}
+		names[spec.Name] = true
+		if spec.Enabled != nil && !*spec.Enabled {
+			continue
+		}
+
+		r := &rule{name: spec.Name}
+		var err error
+		if spec.If != nil {
+			if r.guard, err = compileCond(*spec.If); err != nil {
+				return nil, fmt.Errorf("rule %q if: %w", spec.Name, err)
+			}
+		}
+		if r.cond, err = compileCond(spec.When); err != nil {
+			return nil, fmt.Errorf("rule %q when: %w", spec.Name, err)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+	return rs, nil
+}
+
+// LoadRuleFile reads and compiles a JSON rule file
+func LoadRuleFile(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg RuleConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rs, err := CompileRules(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rs.source = path
+	return rs, nil
+}
+
+// Passes reports whether an item satisfies every applicable rule. The first
+// failing rule is credited with the hit unless ctx is untracked.
+func (rs *RuleSet) Passes(item *store.Item, ctx *Context) bool {
+	for _, r := range rs.rules {
+		if r.guard != nil && !r.guard(item, ctx) {
+			continue
+		}
+		if !ctx.Untracked {
+			r.evaluated.Add(1)
+		}
+		if !r.cond(item, ctx) {
+			if !ctx.Untracked {
+				r.hits.Add(1)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// Stats returns the per-rule counters since the rule set was loaded
+func (rs *RuleSet) Stats() []RuleStat {
+	stats := make([]RuleStat, len(rs.rules))
+	for i, r := range rs.rules {
+		stats[i] = RuleStat{Name: r.name, Evaluated: r.evaluated.Load(), Hits: r.hits.Load()}
+	}
+	return stats
+}
+
+// Source returns the file the rule set was loaded from, or "default"
+func (rs *RuleSet) Source() string {
+	return rs.source
+}
+
+// LoadedAt returns when the rule set was compiled
+func (rs *RuleSet) LoadedAt() time.Time {
+	return rs.loadedAt
+}
+
+// CompileCondition compiles a condition on item fields for use outside
+// rule sets. Request fields (query, user_id) compare as empty.
+func CompileCondition(c CondSpec) (func(item *store.Item) bool, error) {
+	p, err := compileCond(c)
+	if err != nil {
+		return nil, err
+	}
+	var ctx Context
+	return func(item *store.Item) bool { return p(item, &ctx) }, nil
+}
+
+// compileCond compiles a condition tree into a predicate
+func compileCond(c CondSpec) (predicate, error) {
+	forms := 0
+	if c.Field != "" {
+		forms++
+	}
+	if c.All != nil {
+		forms++
+	}
+	if c.Any != nil {
+		forms++
+	}
+	if c.Not != nil {
+		forms++
+	}
+	if forms != 1 {
+		return nil, fmt.Errorf("condition needs exactly one of field, all, any, not")
+	}
+
+	switch {
+	case c.All != nil:
+		preds, err := compileConds(c.All)
+		if err != nil {
+			return nil, err
+		}
+		return func(item *store.Item, ctx *Context) bool {
+			for _, p := range preds {
+				if !p(item, ctx) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case c.Any != nil:
+		preds, err := compileConds(c.Any)
+		if err != nil {
+			return nil, err
+		}
+		return func(item *store.Item, ctx *Context) bool {
+			for _, p := range preds {
+				if p(item, ctx) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case c.Not != nil:
+		p, err := compileCond(*c.Not)
+		if err != nil {
+			return nil, err
+		}
+		return func(item *store.Item, ctx *Context) bool { return !p(item, ctx) }, nil
+	}
+	return compileComparison(c)
+}
+
+func compileConds(specs []CondSpec) ([]predicate, error) {
+	preds := make([]predicate, len(specs))
+	for i, spec := range specs {
+		p, err := compileCond(spec)
+		if err != nil {
+			return nil, err
+		}
+		preds[i] = p
+	}
+	return preds, nil
+}
+
+// numericFields and stringFields map rule field names to accessors
+var numericFields = map[string]func(*store.Item, *Context) float64{
+	"item_id":     func(it *store.Item, _ *Context) float64 { return float64(it.ItemID) },
+	"price_cents": func(it *store.Item, _ *Context) float64 { return float64(it.PriceCents) },
+	"discount":    func(it *store.Item, _ *Context) float64 { return it.Discount },
+	"rating":      func(it *store.Item, _ *Context) float64 { return it.Rating },
+	"stock":       func(it *store.Item, _ *Context) float64 { return float64(it.Stock) },
+	"click_7d":    func(it *store.Item, _ *Context) float64 { return float64(it.Click7d) },
+	"buy_7d":      func(it *store.Item, _ *Context) float64 { return float64(it.Buy7d) },
+	"gmv_30d":     func(it *store.Item, _ *Context) float64 { return float64(it.GMV30d) },
+	"days_since_launch": func(it *store.Item, _ *Context) float64 {
+		if it.LaunchedAt.IsZero() {
+			return 0
+		}
+		return time.Since(it.LaunchedAt).Hours() / 24
+	},
+}
+
+var stringFields = map[string]func(*store.Item, *Context) string{
+	"title":   func(it *store.Item, _ *Context) string { return it.Title },
+	"brand":   func(it *store.Item, _ *Context) string { return it.Brand },
+	"query":   func(_ *store.Item, ctx *Context) string { return ctx.Query },
+	"user_id": func(_ *store.Item, ctx *Context) string { return ctx.UserID },
+}
+
+// compileComparison compiles a field/op/value comparison
+func compileComparison(c CondSpec) (predicate, error) {
+	if get, ok := numericFields[c.Field]; ok {
+		value, ok := c.Value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("field %q needs a numeric value", c.Field)
+		}
+		cmp, err := numericOp(c.Op)
+		if err != nil {
+			return nil, err
+		}
+		return func(item *store.Item, ctx *Context) bool { return cmp(get(item, ctx), value) }, nil
+	}
+
+	get, ok := stringFields[c.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", c.Field)
+	}
+	switch c.Op {
+	case "in", "not_in":
+		set := make(map[string]bool, len(c.Values))
+		for _, v := range c.Values {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q needs string values", c.Field)
+			}
+			set[strings.ToLower(s)] = true
+		}
+		negate := c.Op == "not_in"
+		return func(item *store.Item, ctx *Context) bool {
+			return set[strings.ToLower(get(item, ctx))] != negate
+		}, nil
+	}
+
+	value, ok := c.Value.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %q needs a string value", c.Field)
+	}
+	value = strings.ToLower(value)
+	switch c.Op {
+	case "==":
+		return func(item *store.Item, ctx *Context) bool { return strings.ToLower(get(item, ctx)) == value }, nil
+	case "!=":
+		return func(item *store.Item, ctx *Context) bool { return strings.ToLower(get(item, ctx)) != value }, nil
+	case "contains":
+		return func(item *store.Item, ctx *Context) bool {
+			return strings.Contains(strings.ToLower(get(item, ctx)), value)
+		}, nil
+	case "prefix":
+		return func(item *store.Item, ctx *Context) bool {
+			return strings.HasPrefix(strings.ToLower(get(item, ctx)), value)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown string operator %q", c.Op)
+}
+
+func numericOp(op string) (func(a, b float64) bool, error) {
+	switch op {
+	case "==":
+		return func(a, b float64) bool { return a == b }, nil
+	case "!=":
+		return func(a, b float64) bool { return a != b }, nil
+	case "<":
+		return func(a, b float64) bool { return a < b }, nil
+	case "<=":
+		return func(a, b float64) bool { return a <= b }, nil
+	case ">":
+		return func(a, b float64) bool { return a > b }, nil
+	case ">=":
+		return func(a, b float64) bool { return a >= b }, nil
+	}
+	return nil, fmt.Errorf("unknown numeric operator %q", op)
+}
@@ -0,0 +1,98 @@
+package coarse
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func mustCompile(t *testing.T, js string) *RuleSet {
+	t.Helper()
+	var cfg RuleConfig
+	if err := json.Unmarshal([]byte(js), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := CompileRules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestRulesCombinatorsAndContext(t *testing.T) {
+	rs := mustCompile(t, `{"rules": [
+		{"name": "deny", "when": {"field": "brand", "op": "not_in", "values": ["Fake"]}},
+		{"name": "quality", "when": {"any": [
+			{"field": "rating", "op": ">=", "value": 4.5},
+			{"all": [{"field": "rating", "op": ">=", "value": 4}, {"not": {"field": "discount", "op": ">", "value": 0.3}}]}
+		]}},
+		{"name": "budget", "if": {"field": "query", "op": "contains", "value": "cheap"},
+		 "when": {"field": "price_cents", "op": "<=", "value": 50000}}
+	]}`)
+
+	cases := []struct {
+		item  store.Item
+		query string
+		want  bool
+	}{
+		{store.Item{Brand: "fake", Rating: 5}, "", false},
+		{store.Item{Brand: "Gucci", Rating: 4.6, Discount: 0.5}, "", true},
+		{store.Item{Brand: "Gucci", Rating: 4.2, Discount: 0.5}, "", false},
+		{store.Item{Brand: "Gucci", Rating: 4.2, PriceCents: 90000}, "", true},
+		{store.Item{Brand: "Gucci", Rating: 4.2, PriceCents: 90000}, "Cheap bag", false},
+	}
+	for i, c := range cases {
+		ctx := Context{Query: c.query}
+		if got := rs.Passes(&c.item, &ctx); got != c.want {
+			t.Errorf("case %d: Passes = %v, want %v", i, got, c.want)
+		}
+	}
+
+	hits := map[string]int64{}
+	for _, st := range rs.Stats() {
+		hits[st.Name] = st.Hits
+	}
+	if hits["deny"] != 1 || hits["quality"] != 1 || hits["budget"] != 1 {
+		t.Fatalf("unexpected hit counters %v", hits)
+	}
+
+	before := rs.Stats()
+	if rs.Passes(&cases[0].item, &Context{Untracked: true}) {
+		t.Fatal("untracked context changed the verdict")
+	}
+	if after := rs.Stats(); !reflect.DeepEqual(after, before) {
+		t.Errorf("untracked context counted: %v, want %v", after, before)
+	}
+}
+
+func TestRulesValidation(t *testing.T) {
+	bad := []string{
+		`{"rules": [{"name": "x", "when": {"field": "nope", "op": ">", "value": 1}}]}`,
+		`{"rules": [{"name": "x", "when": {"field": "rating", "op": "~", "value": 1}}]}`,
+		`{"rules": [{"name": "x", "when": {"field": "rating", "op": ">", "value": "high"}}]}`,
+		`{"rules": [{"name": "x", "when": {}}]}`,
+		`{"rules": [{"when": {"field": "rating", "op": ">", "value": 1}}]}`,
+	}
+	for _, js := range bad {
+		var cfg RuleConfig
+		if err := json.Unmarshal([]byte(js), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CompileRules(cfg); err == nil {
+			t.Errorf("expected compile error for %s", js)
+		}
+	}
+}
+
+func TestShippedRuleFileMatchesDefaults(t *testing.T) {
+	rs, err := LoadRuleFile("../../../config/coarse_rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, _ := CompileRules(DefaultRuleConfig())
+	if len(rs.Stats()) != len(def.Stats()) {
+		t.Fatalf("shipped rules enable %d rules, defaults have %d", len(rs.Stats()), len(def.Stats()))
+	}
+}
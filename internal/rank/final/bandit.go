@@ -0,0 +1,137 @@
+package final
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Bandit policies for choosing exploration candidates
+const (
+	PolicyThompson = "thompson"
+	PolicyUCB      = "ucb"
+)
+
+// Bandit scores exploration candidates from their click/buy feedback.
+// Every item is an arm and every exploration exposure a trial. The feedback
+// must attribute clicks and buys to those exposures, at most one of each per
+// exposure (see store.GetExplorationFeedback): a click is one success, and a
+// purchase counts as buyWeight further successful trials.
+type Bandit struct {
+	policy     string
+	ucbC       float64 // UCB exploration constant
+	buyWeight  float64 // Successes credited per purchase
+	priorAlpha float64 // Beta prior successes
+	priorBeta  float64 // Beta prior failures
+}
+
+// NewBandit creates a bandit using the given policy ("thompson" or "ucb")
+func NewBandit(policy string) *Bandit {
+	if policy != PolicyUCB {
+		policy = PolicyThompson
+	}
+	return &Bandit{
+		policy:     policy,
+		ucbC:       math.Sqrt2, // Classic UCB1
+		buyWeight:  3.0,        // A purchase is worth 3 clicks
+		priorAlpha: 1.0,        // Uniform Beta(1,1) prior
+		priorBeta:  1.0,
+	}
+}
+
+// Policy returns the bandit policy name
+func (b *Bandit) Policy() string {
+	return b.policy
+}
+
+// scoredArm is an exploration candidate with its bandit score
+type scoredArm struct {
+	item  store.Item
+	score float64
+}
+
+// Choose returns up to k candidates ordered by bandit score. Thompson
+// draws come from a source seeded with seed, so the same seed, candidates
+// and feedback give the same choice; 0 draws a fresh seed.
+func (b *Bandit) Choose(candidates []store.Item, feedback map[int]store.ItemFeedback, k int, seed int64) []scoredArm {
+	if k <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	totalTrials := 0.0
+	for _, item := range candidates {
+		_, trials := b.arm(feedback[item.ItemID])
+		totalTrials += trials
+	}
+
+	arms := make([]scoredArm, 0, len(candidates))
+	for _, item := range candidates {
+		successes, trials := b.arm(feedback[item.ItemID])
+		var score float64
+		if b.policy == PolicyUCB {
+			score = b.ucbScore(successes, trials, totalTrials)
+		} else {
+			score = sampleBeta(rng, b.priorAlpha+successes, b.priorBeta+trials-successes)
+		}
+		arms = append(arms, scoredArm{item: item, score: score})
+	}
+
+	sort.SliceStable(arms, func(i, j int) bool { return arms[i].score > arms[j].score })
+	if len(arms) > k {
+		arms = arms[:k]
+	}
+	return arms
+}
+
+// arm converts attributed feedback into (successes, trials)
+func (b *Bandit) arm(fb store.ItemFeedback) (float64, float64) {
+	purchases := b.buyWeight * float64(fb.Buys)
+	return float64(fb.Clicks) + purchases, float64(fb.Impressions) + purchases
+}
+
+// ucbScore computes the UCB1 upper confidence bound; unplayed arms go first
+func (b *Bandit) ucbScore(successes, trials, totalTrials float64) float64 {
+	if trials == 0 {
+		return math.Inf(1)
+	}
+	mean := successes / trials
+	return mean + b.ucbC*math.Sqrt(math.Log(totalTrials+1)/trials)
+}
+
+// sampleBeta draws from Beta(a, b) via two Gamma draws
+func sampleBeta(rng *rand.Rand, a, b float64) float64 {
+	x := sampleGamma(rng, a)
+	y := sampleGamma(rng, b)
+	if x+y == 0 {
+		return 0
+	}
+	return x / (x + y)
+}
+
+// sampleGamma draws from Gamma(shape, 1) using Marsaglia and Tsang's method
+func sampleGamma(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// Boost shape above 1, then scale back down
+		return sampleGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3.0
+	c := 1.0 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
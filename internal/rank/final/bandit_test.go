@@ -0,0 +1,129 @@
+package final
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestRankWithExplorationFillsSlots(t *testing.T) {
+	r := NewRanker()
+	var items []store.Item
+	for i := 1; i <= 40; i++ {
+		items = append(items, store.Item{ItemID: i, Brand: string(rune('A' + i%20)), Rating: 4, Stock: 1})
+	}
+	candidates := []store.Item{{ItemID: 100, Brand: "X"}, {ItemID: 101, Brand: "Y"}, {ItemID: 3, Brand: "D"}}
+	feedback := map[int]store.ItemFeedback{100: {Impressions: 10, Clicks: 5}}
+
+	ranked, decisions, _ := r.RankWithExploration(items, candidates, feedback)
+	if len(ranked) != 42 {
+		t.Fatalf("expected 42 items, got %d", len(ranked))
+	}
+	// Item 3 is already ranked organically, so only 100 and 101 explore
+	if len(decisions) != 2 {
+		t.Fatalf("expected 2 exploration decisions, got %d", len(decisions))
+	}
+	seen := make(map[int]bool)
+	for _, item := range ranked {
+		if seen[item.ItemID] {
+			t.Fatalf("item %d placed twice", item.ItemID)
+		}
+		seen[item.ItemID] = true
+	}
+	for _, d := range decisions {
+		if pos := (d.Position-1)%20 + 1; pos != 5 && pos != 15 {
+			t.Fatalf("exploration item at non-slot position %d", d.Position)
+		}
+		if d.ItemID == 3 {
+			t.Fatalf("organic item 3 used for exploration")
+		}
+		if ranked[d.Position-1].ItemID != d.ItemID {
+			t.Fatalf("decision position %d does not match ranked list", d.Position)
+		}
+	}
+}
+
+func TestRankRequestSlotsFollowPageSize(t *testing.T) {
+	r := NewRanker() // Slots 5 and 15 on pages of 20
+	var items, candidates []store.Item
+	for i := 1; i <= 30; i++ {
+		items = append(items, store.Item{ItemID: i, Brand: string(rune('A' + i%20)), Rating: 4, Stock: 1})
+		candidates = append(candidates, store.Item{ItemID: 100 + i, Brand: "X"})
+	}
+
+	// Pages of 10 only have room for slot 5
+	res := r.RankRequest(Request{Items: items, Candidates: candidates, PageSize: 10})
+	var positions []int
+	for _, d := range res.Exploration {
+		positions = append(positions, d.Position)
+	}
+	if !reflect.DeepEqual(positions, []int{5, 15, 25}) {
+		t.Errorf("exploration positions with page size 10 = %v, want [5 15 25]", positions)
+	}
+
+	// Pages of 3 have no slot at all
+	if res := r.RankRequest(Request{Items: items, Candidates: candidates, PageSize: 3}); len(res.Exploration) != 0 {
+		t.Errorf("page size 3: %d exploration items, want none", len(res.Exploration))
+	}
+}
+
+func TestUCBPrefersUnplayedArms(t *testing.T) {
+	b := NewBandit(PolicyUCB)
+	candidates := []store.Item{{ItemID: 1}, {ItemID: 2}}
+	feedback := map[int]store.ItemFeedback{1: {Impressions: 100, Clicks: 50}}
+	arms := b.Choose(candidates, feedback, 1, 0)
+	if len(arms) != 1 || arms[0].item.ItemID != 2 {
+		t.Fatalf("expected unplayed arm first, got %+v", arms)
+	}
+}
+
+func TestBanditArmsStayWithinTrials(t *testing.T) {
+	b := NewBandit(PolicyThompson)
+	// A clicked and bought exposure still has no more successes than trials
+	successes, trials := b.arm(store.ItemFeedback{Impressions: 1, Clicks: 1, Buys: 1})
+	if successes != 4 || trials != 4 {
+		t.Errorf("arm = (%v, %v), want (4, 4)", successes, trials)
+	}
+
+	// Two exposures without a click lose to an unexplored arm most of the time
+	candidates := []store.Item{{ItemID: 1}, {ItemID: 2}}
+	feedback := map[int]store.ItemFeedback{1: {Impressions: 2}}
+	wins := 0
+	for seed := int64(1); seed <= 200; seed++ {
+		if b.Choose(candidates, feedback, 1, seed)[0].item.ItemID == 2 {
+			wins++
+		}
+	}
+	if wins < 120 {
+		t.Errorf("unexplored arm chosen %d of 200 times", wins)
+	}
+}
+
+func TestThompsonSeedRepeatsChoice(t *testing.T) {
+	b := NewBandit(PolicyThompson)
+	var candidates []store.Item
+	for i := 1; i <= 50; i++ {
+		candidates = append(candidates, store.Item{ItemID: i})
+	}
+	choice := func(seed int64) []int {
+		var ids []int
+		for _, arm := range b.Choose(candidates, nil, 5, seed) {
+			ids = append(ids, arm.item.ItemID)
+		}
+		return ids
+	}
+	first, again := choice(42), choice(42)
+	if !reflect.DeepEqual(first, again) {
+		t.Fatalf("same seed chose %v, then %v", first, again)
+	}
+}
+
+func TestRankWithExplorationKeepsSingleOrganicItem(t *testing.T) {
+	r := NewRanker()
+	items := []store.Item{{ItemID: 1, Brand: "A", Rating: 4, Stock: 1}}
+	ranked, _, _ := r.RankWithExploration(items, []store.Item{{ItemID: 1}, {ItemID: 2}}, nil)
+	if len(ranked) != 1 || ranked[0].ItemID != 1 {
+		t.Fatalf("expected the organic item to survive, got %+v", ranked)
+	}
+}
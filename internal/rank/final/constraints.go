@@ -0,0 +1,453 @@
+package final
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Constraint kinds
+const (
+	ConstraintAtLeast     = "at_least"     // At least Count matching items in the top TopN
+	ConstraintAtMost      = "at_most"      // At most Count (or Share of TopN) matching items in the top TopN
+	ConstraintAtPositions = "at_positions" // Matching items at exactly these 1-based positions
+)
+
+// Constraint is a business rule on the composition of the ranked list
+type Constraint struct {
+	Name      string
+	Kind      string
+	TopN      int     // Window for at_least / at_most; 0 means the whole list
+	Count     int     // Required or allowed matching items
+	Share     float64 // at_most only: if > 0, the limit is floor(Share * window)
+	Positions []int   // at_positions only
+	Match     func(item store.Item) bool
+}
+
+// AtLeast requires at least count matching items among the top topN
+func AtLeast(name string, count, topN int, match func(store.Item) bool) Constraint {
+	return Constraint{Name: name, Kind: ConstraintAtLeast, TopN: topN, Count: count, Match: match}
+}
+
+// AtMost allows at most count matching items among the top topN
+func AtMost(name string, count, topN int, match func(store.Item) bool) Constraint {
+	return Constraint{Name: name, Kind: ConstraintAtMost, TopN: topN, Count: count, Match: match}
+}
+
+// MaxShare allows at most share (0-1) of the top topN to be matching items
+func MaxShare(name string, share float64, topN int, match func(store.Item) bool) Constraint {
+	return Constraint{Name: name, Kind: ConstraintAtMost, TopN: topN, Share: share, Match: match}
+}
+
+// AtPositions places matching items at the given 1-based positions
+func AtPositions(name string, positions []int, match func(store.Item) bool) Constraint {
+	return Constraint{Name: name, Kind: ConstraintAtPositions, Positions: positions, Match: match}
+}
+
+// PriceBelow matches items cheaper than cents
+func PriceBelow(cents int) func(store.Item) bool {
+	return func(item store.Item) bool { return item.PriceCents < cents }
+}
+
+// Discounted matches items on sale
+func Discounted() func(store.Item) bool {
+	return func(item store.Item) bool { return item.Discount > 0 }
+}
+
+// IsSponsored matches paid placements
+func IsSponsored() func(store.Item) bool {
+	return func(item store.Item) bool { return item.Sponsored }
+}
+
+// ConstraintSpec is the declarative form of a Constraint, as written in
+// the config file
+type ConstraintSpec struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	TopN      int       `json:"top_n,omitempty"`
+	Count     int       `json:"count,omitempty"`
+	Share     float64   `json:"share,omitempty"`
+	Positions []int     `json:"positions,omitempty"`
+	Match     MatchSpec `json:"match"`
+}
+
+// MatchSpec selects the items a constraint counts; exactly one matcher
+// must be set
+type MatchSpec struct {
+	PriceBelow int  `json:"price_below,omitempty"` // Cents
+	Discounted bool `json:"discounted,omitempty"`
+	Sponsored  bool `json:"sponsored,omitempty"`
+}
+
+// compile returns the matcher selected by the spec
+func (m MatchSpec) compile() (func(store.Item) bool, error) {
+	var match func(store.Item) bool
+	set := 0
+	if m.PriceBelow > 0 {
+		match, set = PriceBelow(m.PriceBelow), set+1
+	}
+	if m.Discounted {
+		match, set = Discounted(), set+1
+	}
+	if m.Sponsored {
+		match, set = IsSponsored(), set+1
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("match: want exactly one of price_below, discounted or sponsored")
+	}
+	return match, nil
+}
+
+// CompileConstraints validates constraint specs and builds the constraints
+func CompileConstraints(specs []ConstraintSpec) ([]Constraint, error) {
+	constraints := make([]Constraint, 0, len(specs))
+	names := make(map[string]bool)
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("constraint %d: missing name", i)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("constraint %q: duplicate name", spec.Name)
+		}
+		names[spec.Name] = true
+		if spec.TopN < 0 {
+			return nil, fmt.Errorf("constraint %q: top_n must not be negative", spec.Name)
+		}
+		match, err := spec.Match.compile()
+		if err != nil {
+			return nil, fmt.Errorf("constraint %q: %w", spec.Name, err)
+		}
+
+		switch spec.Kind {
+		case ConstraintAtLeast:
+			if spec.Count < 1 {
+				return nil, fmt.Errorf("constraint %q: at_least needs a count of at least 1", spec.Name)
+			}
+			constraints = append(constraints, AtLeast(spec.Name, spec.Count, spec.TopN, match))
+		case ConstraintAtMost:
+			switch {
+			case spec.Share < 0 || spec.Share > 1:
+				return nil, fmt.Errorf("constraint %q: share must be between 0 and 1", spec.Name)
+			case spec.Share > 0 && spec.Count != 0:
+				return nil, fmt.Errorf("constraint %q: at_most takes a count or a share, not both", spec.Name)
+			case spec.Count < 0:
+				return nil, fmt.Errorf("constraint %q: count must not be negative", spec.Name)
+			case spec.Share > 0:
+				constraints = append(constraints, MaxShare(spec.Name, spec.Share, spec.TopN, match))
+			default:
+				constraints = append(constraints, AtMost(spec.Name, spec.Count, spec.TopN, match))
+			}
+		case ConstraintAtPositions:
+			if len(spec.Positions) == 0 {
+				return nil, fmt.Errorf("constraint %q: at_positions needs positions", spec.Name)
+			}
+			for _, pos := range spec.Positions {
+				if pos < 1 {
+					return nil, fmt.Errorf("constraint %q: position %d must be at least 1", spec.Name, pos)
+				}
+			}
+			constraints = append(constraints, AtPositions(spec.Name, spec.Positions, match))
+		default:
+			return nil, fmt.Errorf("constraint %q: unknown kind %q (want %s, %s or %s)",
+				spec.Name, spec.Kind, ConstraintAtLeast, ConstraintAtMost, ConstraintAtPositions)
+		}
+	}
+	return constraints, nil
+}
+
+// Objective weights the per-item utility the re-ranker maximises. Each term
+// is normalised to [0, 1] within the list being ranked.
+type Objective struct {
+	Relevance float64 `json:"relevance"` // Incoming order from the earlier stages
+	GMV       float64 `json:"gmv"`       // GMV30d relative to the list maximum
+	Freshness float64 `json:"freshness"` // exp decay of days since launch
+}
+
+// DefaultObjective keeps the incoming relevance order
+func DefaultObjective() Objective {
+	return Objective{Relevance: 1.0}
+}
+
+// freshnessHalfLife is the age at which the freshness term halves
+const freshnessHalfLife = 30 * 24 * time.Hour
+
+// Violation reports a constraint the re-ranker could not satisfy
+type Violation struct {
+	Constraint string `json:"constraint"`
+	Reason     string `json:"reason"`
+}
+
+// window returns the effective window of a count constraint for n items
+func (c *Constraint) window(n int) int {
+	if c.TopN <= 0 || c.TopN > n {
+		return n
+	}
+	return c.TopN
+}
+
+// limit returns the allowed matches of an at_most constraint for n items
+func (c *Constraint) limit(n int) int {
+	if c.Share > 0 {
+		return int(math.Floor(c.Share * float64(c.window(n))))
+	}
+	return c.Count
+}
+
+// utilities scores items by the objective; items must be in relevance order
+func (r *Ranker) utilities(items []store.Item) []float64 {
+	n := len(items)
+	maxGMV := 0
+	for _, item := range items {
+		if item.GMV30d > maxGMV {
+			maxGMV = item.GMV30d
+		}
+	}
+	now := time.Now()
+	utility := make([]float64, n)
+	for i, item := range items {
+		u := r.objective.Relevance * (1 - float64(i)/float64(n))
+		if maxGMV > 0 {
+			u += r.objective.GMV * float64(item.GMV30d) / float64(maxGMV)
+		}
+		if !item.LaunchedAt.IsZero() {
+			age := now.Sub(item.LaunchedAt)
+			u += r.objective.Freshness * math.Exp2(-float64(age)/float64(freshnessHalfLife))
+		}
+		utility[i] = u
+	}
+	return utility
+}
+
+// solve re-ranks items to maximise utility subject to the constraints using
+// greedy selection with a repair pass. Items at locked 1-based positions stay
+// in place. It returns the constraints left unsatisfied.
+func (r *Ranker) solve(items []store.Item, locked map[int]bool) ([]store.Item, []Violation) {
+	n := len(items)
+	if n == 0 || (len(r.constraints) == 0 && r.objective == DefaultObjective()) {
+		return items, nil
+	}
+	utility := r.utilities(items)
+
+	slots := make([]int, n) // position-1 -> item index, -1 while empty
+	fixed := make([]bool, n)
+	used := make([]bool, n)
+	for p := range slots {
+		slots[p] = -1
+	}
+	for pos := range locked {
+		if pos >= 1 && pos <= n {
+			slots[pos-1], fixed[pos-1], used[pos-1] = pos-1, true, true
+		}
+	}
+
+	// bestUnused returns the highest-utility unused item accepted by ok
+	bestUnused := func(ok func(i int) bool) int {
+		best := -1
+		for i := range items {
+			if !used[i] && ok(i) && (best < 0 || utility[i] > utility[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// Positional constraints claim their slots first
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		if c.Kind != ConstraintAtPositions {
+			continue
+		}
+		for _, pos := range c.Positions {
+			if pos < 1 || pos > n || slots[pos-1] >= 0 {
+				continue
+			}
+			if i := bestUnused(func(i int) bool { return c.Match(items[i]) }); i >= 0 {
+				slots[pos-1], fixed[pos-1], used[i] = i, true, true
+			}
+		}
+	}
+
+	// counts[ci] is the number of matching items placed inside constraint ci's window
+	counts := make([]int, len(r.constraints))
+	place := func(p, i int) {
+		slots[p], used[i] = i, true
+		r.adjustCounts(items[i], p, n, counts, 1)
+	}
+	for p, i := range slots {
+		if i >= 0 {
+			slots[p] = -1
+			place(p, i)
+		}
+	}
+
+	// open counts empty slots in [p, end)
+	open := func(p, end int) int {
+		k := 0
+		for q := p; q < end; q++ {
+			if slots[q] < 0 {
+				k++
+			}
+		}
+		return k
+	}
+
+	// Greedy fill: tier 0 honours every constraint, tier 1 drops the
+	// at_least requirements, tier 2 takes the best remaining item
+	for p := 0; p < n; p++ {
+		if slots[p] >= 0 {
+			continue
+		}
+		best := -1
+		for tier := 0; tier < 3 && best < 0; tier++ {
+			best = bestUnused(func(i int) bool {
+				for ci := range r.constraints {
+					c := &r.constraints[ci]
+					if p >= c.window(n) {
+						continue
+					}
+					switch c.Kind {
+					case ConstraintAtMost:
+						if tier < 2 && counts[ci] >= c.limit(n) && c.Match(items[i]) {
+							return false
+						}
+					case ConstraintAtLeast:
+						// Must match once the remaining slots are all needed
+						if tier < 1 && c.Count-counts[ci] >= open(p, c.window(n)) && !c.Match(items[i]) {
+							return false
+						}
+					}
+				}
+				return true
+			})
+		}
+		place(p, best)
+	}
+
+	r.repair(items, utility, slots, fixed, counts)
+
+	result := make([]store.Item, n)
+	for p, i := range slots {
+		result[p] = items[i]
+	}
+	return result, r.violations(result)
+}
+
+// repair swaps items across the window of each unmet at_least constraint:
+// the least useful non-matching item inside is exchanged for the most useful
+// matching item outside, as long as no other constraint breaks
+func (r *Ranker) repair(items []store.Item, utility []float64, slots []int, fixed []bool, counts []int) {
+	n := len(items)
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		if c.Kind != ConstraintAtLeast {
+			continue
+		}
+		w := c.window(n)
+		for counts[ci] < c.Count {
+			out, in := -1, -1
+			for p := 0; p < w; p++ {
+				i := slots[p]
+				if fixed[p] || c.Match(items[i]) || !r.canRemove(items[i], p, n, counts) {
+					continue
+				}
+				if out < 0 || utility[i] < utility[slots[out]] {
+					out = p
+				}
+			}
+			if out < 0 {
+				break
+			}
+			for p := w; p < n; p++ {
+				i := slots[p]
+				if fixed[p] || !c.Match(items[i]) || !r.canInsert(items[i], out, n, counts) {
+					continue
+				}
+				if in < 0 || utility[i] > utility[slots[in]] {
+					in = p
+				}
+			}
+			if in < 0 {
+				break
+			}
+			r.adjustCounts(items[slots[out]], out, n, counts, -1)
+			r.adjustCounts(items[slots[in]], in, n, counts, -1)
+			slots[out], slots[in] = slots[in], slots[out]
+			r.adjustCounts(items[slots[out]], out, n, counts, 1)
+			r.adjustCounts(items[slots[in]], in, n, counts, 1)
+		}
+	}
+}
+
+// canRemove reports whether taking item out of position p keeps every
+// at_least constraint whose window covers p satisfied
+func (r *Ranker) canRemove(item store.Item, p, n int, counts []int) bool {
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		if c.Kind == ConstraintAtLeast && p < c.window(n) && c.Match(item) && counts[ci] <= c.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// canInsert reports whether putting item at position p keeps every at_most
+// constraint whose window covers p within its limit
+func (r *Ranker) canInsert(item store.Item, p, n int, counts []int) bool {
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		if c.Kind == ConstraintAtMost && p < c.window(n) && c.Match(item) && counts[ci] >= c.limit(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// adjustCounts adds delta to the counts of constraints whose window covers p
+func (r *Ranker) adjustCounts(item store.Item, p, n int, counts []int, delta int) {
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		if c.Kind != ConstraintAtPositions && p < c.window(n) && c.Match(item) {
+			counts[ci] += delta
+		}
+	}
+}
+
+// violations evaluates every constraint against a ranked list
+func (r *Ranker) violations(items []store.Item) []Violation {
+	n := len(items)
+	var out []Violation
+	for ci := range r.constraints {
+		c := &r.constraints[ci]
+		switch c.Kind {
+		case ConstraintAtPositions:
+			var missing []int
+			for _, pos := range c.Positions {
+				if pos >= 1 && pos <= n && !c.Match(items[pos-1]) {
+					missing = append(missing, pos)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Ints(missing)
+				out = append(out, Violation{c.Name, fmt.Sprintf("no matching item for positions %v", missing)})
+			}
+		case ConstraintAtLeast, ConstraintAtMost:
+			w := c.window(n)
+			matched := 0
+			for _, item := range items[:w] {
+				if c.Match(item) {
+					matched++
+				}
+			}
+			if c.Kind == ConstraintAtLeast && matched < c.Count {
+				out = append(out, Violation{c.Name, fmt.Sprintf("%d of %d required items in top %d", matched, c.Count, w)})
+			}
+			if c.Kind == ConstraintAtMost && matched > c.limit(n) {
+				out = append(out, Violation{c.Name, fmt.Sprintf("%d matching items in top %d, limit %d", matched, w, c.limit(n))})
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package final
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// constraintItems returns n expensive, undiscounted items in relevance order
+func constraintItems(n int) []store.Item {
+	items := make([]store.Item, n)
+	for i := range items {
+		items[i] = store.Item{ItemID: i + 1, PriceCents: 100000}
+	}
+	return items
+}
+
+func TestSolveSatisfiesConstraints(t *testing.T) {
+	items := constraintItems(30)
+	items[2].Discount = 0.2 // Discounted items crowd the top
+	items[3].Discount = 0.2
+	items[4].Discount = 0.2
+	items[5].Discount = 0.2
+	items[20].PriceCents = 30000 // Affordable items sit deep in the list
+	items[25].PriceCents = 40000
+	items[27].Sponsored = true
+	items[28].Sponsored = true
+
+	r := NewRanker()
+	r.SetConstraints([]Constraint{
+		AtLeast("affordable", 2, 10, PriceBelow(50000)),
+		MaxShare("discounted", 0.3, 10, Discounted()),
+		AtPositions("sponsored", []int{3, 8}, IsSponsored()),
+	})
+	ranked, violations := r.solve(items, nil)
+	if len(violations) != 0 {
+		t.Fatalf("expected all constraints satisfied, got %+v", violations)
+	}
+	if len(ranked) != len(items) {
+		t.Fatalf("expected %d items, got %d", len(items), len(ranked))
+	}
+
+	affordable, discounted := 0, 0
+	for _, item := range ranked[:10] {
+		if item.PriceCents < 50000 {
+			affordable++
+		}
+		if item.Discount > 0 {
+			discounted++
+		}
+	}
+	if affordable < 2 || discounted > 3 {
+		t.Fatalf("top 10 has %d affordable and %d discounted items", affordable, discounted)
+	}
+	if !ranked[2].Sponsored || !ranked[7].Sponsored {
+		t.Fatalf("sponsored items not at positions 3 and 8")
+	}
+	if ranked[0].ItemID != 1 || ranked[1].ItemID != 2 {
+		t.Fatalf("unconstrained head should keep relevance order, got %d, %d", ranked[0].ItemID, ranked[1].ItemID)
+	}
+}
+
+func TestSolveReportsUnsatisfiable(t *testing.T) {
+	items := constraintItems(12)
+	items[11].PriceCents = 10000
+
+	r := NewRanker()
+	r.SetConstraints([]Constraint{
+		AtLeast("affordable", 2, 10, PriceBelow(50000)),
+		AtPositions("sponsored", []int{3}, IsSponsored()),
+	})
+	ranked, violations := r.solve(items, map[int]bool{1: true})
+	if ranked[0].ItemID != 1 {
+		t.Fatalf("locked position 1 moved")
+	}
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %+v", violations)
+	}
+	if violations[0].Constraint != "affordable" || violations[1].Constraint != "sponsored" {
+		t.Fatalf("unexpected violations %+v", violations)
+	}
+}
+
+func TestSolveObjectiveWeights(t *testing.T) {
+	items := constraintItems(3)
+	items[2].GMV30d = 1000000
+
+	r := NewRanker()
+	r.SetObjective(Objective{Relevance: 1, GMV: 2})
+	ranked, _ := r.solve(items, nil)
+	if ranked[0].ItemID != 3 {
+		t.Fatalf("expected GMV-weighted item first, got %d", ranked[0].ItemID)
+	}
+}
+
+func TestCompileConstraints(t *testing.T) {
+	constraints, err := CompileConstraints([]ConstraintSpec{
+		{Name: "affordable", Kind: ConstraintAtLeast, TopN: 10, Count: 2, Match: MatchSpec{PriceBelow: 50000}},
+		{Name: "discounted", Kind: ConstraintAtMost, TopN: 10, Share: 0.3, Match: MatchSpec{Discounted: true}},
+		{Name: "sponsored", Kind: ConstraintAtPositions, Positions: []int{3}, Match: MatchSpec{Sponsored: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(constraints) != 3 || constraints[1].limit(10) != 3 || !constraints[0].Match(store.Item{PriceCents: 100}) {
+		t.Fatalf("unexpected constraints %+v", constraints)
+	}
+
+	invalid := map[string]ConstraintSpec{
+		"unknown kind":  {Name: "x", Kind: "around", Match: MatchSpec{Discounted: true}},
+		"no matcher":    {Name: "x", Kind: ConstraintAtLeast, Count: 1},
+		"two matchers":  {Name: "x", Kind: ConstraintAtLeast, Count: 1, Match: MatchSpec{Discounted: true, Sponsored: true}},
+		"zero count":    {Name: "x", Kind: ConstraintAtLeast, Match: MatchSpec{Discounted: true}},
+		"share above 1": {Name: "x", Kind: ConstraintAtMost, Share: 1.5, Match: MatchSpec{Discounted: true}},
+		"no positions":  {Name: "x", Kind: ConstraintAtPositions, Match: MatchSpec{Sponsored: true}},
+		"missing name":  {Kind: ConstraintAtLeast, Count: 1, Match: MatchSpec{Discounted: true}},
+	}
+	for name, spec := range invalid {
+		if _, err := CompileConstraints([]ConstraintSpec{spec}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
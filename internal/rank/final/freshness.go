@@ -0,0 +1,249 @@
+package final
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Freshness decay curves
+const (
+	CurveExponential = "exponential" // Boost halves every HalfLife
+	CurveLinear      = "linear"      // Boost falls linearly to zero at Horizon
+	CurveStep        = "step"        // Full boost until Horizon, then none
+)
+
+// FreshnessConfig controls the boost for recently launched items and the
+// exposure guaranteed to them while they lack feedback
+type FreshnessConfig struct {
+	Curve    string
+	HalfLife time.Duration // exponential curve
+	Horizon  time.Duration // linear and step curves
+	MaxBoost float64       // Score multiplier for an item launched today
+
+	NewWithin      time.Duration // Items launched within this are "new"
+	MinImpressions int           // New items below this many impressions get guaranteed exposure
+	ExposureSlots  []int         // 1-based positions on the first page reserved for them
+}
+
+// DefaultFreshnessConfig returns the default freshness settings
+func DefaultFreshnessConfig() FreshnessConfig {
+	return FreshnessConfig{
+		Curve:          CurveExponential,
+		HalfLife:       14 * 24 * time.Hour,
+		Horizon:        30 * 24 * time.Hour,
+		MaxBoost:       1.2, // Up to 20% boost on launch day
+		NewWithin:      14 * 24 * time.Hour,
+		MinImpressions: 50,
+		ExposureSlots:  []int{10, 20},
+	}
+}
+
+// decay returns the freshness weight in [0, 1] of an item of the given age
+func (c *FreshnessConfig) decay(age time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	switch c.Curve {
+	case CurveLinear:
+		if c.Horizon <= 0 {
+			return 0
+		}
+		return math.Max(0, 1-float64(age)/float64(c.Horizon))
+	case CurveStep:
+		if age < c.Horizon {
+			return 1
+		}
+		return 0
+	}
+	if c.HalfLife <= 0 {
+		return 0
+	}
+	return math.Exp2(-float64(age) / float64(c.HalfLife))
+}
+
+// freshnessBoost returns the score multiplier for an item's launch date
+func (r *Ranker) freshnessBoost(launchedAt, now time.Time) float64 {
+	if launchedAt.IsZero() {
+		return 1
+	}
+	return 1 + (r.freshness.MaxBoost-1)*r.freshness.decay(now.Sub(launchedAt))
+}
+
+// hasBehavior reports whether an item has any behavioral signal of its own
+func hasBehavior(item store.Item) bool {
+	return item.Click7d > 0 || item.Buy7d > 0 || item.GMV30d > 0
+}
+
+// behaviorPrior holds average behavioral signals of a peer group
+type behaviorPrior struct {
+	click7d, buy7d, gmv30d float64
+	n                      int
+}
+
+func (p *behaviorPrior) add(item store.Item) {
+	p.click7d += float64(item.Click7d)
+	p.buy7d += float64(item.Buy7d)
+	p.gmv30d += float64(item.GMV30d)
+	p.n++
+}
+
+// coldStartPriors averages behavior over the candidates that have some, by
+// brand and price band, by brand, by price band and overall
+type coldStartPriors struct {
+	brandBand map[brandBand]*behaviorPrior
+	brand     map[string]*behaviorPrior
+	band      map[int]*behaviorPrior
+	global    behaviorPrior
+	bandOf    func(cents int) int
+}
+
+// brandBand keys the priors of one brand's items in one price band
+type brandBand struct {
+	brand string
+	band  int
+}
+
+// coldStartPriors builds the peer-group averages of a candidate list
+func (r *Ranker) coldStartPriors(items []store.Item) *coldStartPriors {
+	p := &coldStartPriors{
+		brandBand: make(map[brandBand]*behaviorPrior),
+		brand:     make(map[string]*behaviorPrior),
+		band:      make(map[int]*behaviorPrior),
+		bandOf:    r.diversity.priceBand,
+	}
+	for _, item := range items {
+		if !hasBehavior(item) {
+			continue
+		}
+		band := p.bandOf(item.PriceCents)
+		addPrior(p.brandBand, brandBand{item.Brand, band}, item)
+		addPrior(p.brand, item.Brand, item)
+		addPrior(p.band, band, item)
+		p.global.add(item)
+	}
+	return p
+}
+
+func addPrior[K comparable](m map[K]*behaviorPrior, key K, item store.Item) {
+	prior, ok := m[key]
+	if !ok {
+		prior = &behaviorPrior{}
+		m[key] = prior
+	}
+	prior.add(item)
+}
+
+// fill returns the item with its behavioral signals replaced by the closest
+// peer-group average when it has none of its own. It is used for scoring
+// only; the returned item is never served.
+func (p *coldStartPriors) fill(item store.Item) store.Item {
+	if hasBehavior(item) {
+		return item
+	}
+	band := p.bandOf(item.PriceCents)
+	prior := p.brandBand[brandBand{item.Brand, band}]
+	if prior == nil {
+		prior = p.brand[item.Brand]
+	}
+	if prior == nil {
+		prior = p.band[band]
+	}
+	if prior == nil {
+		prior = &p.global
+	}
+	if prior.n == 0 {
+		return item
+	}
+	n := float64(prior.n)
+	item.Click7d = int(math.Round(prior.click7d / n))
+	item.Buy7d = int(math.Round(prior.buy7d / n))
+	item.GMV30d = int(math.Round(prior.gmv30d / n))
+	return item
+}
+
+// guaranteeExposure moves new items that still lack impressions into the
+// exposure slots of the first page of pageSize items, most relevant first,
+// so they collect enough feedback to be ranked on their own merits. Items at
+// locked 1-based positions stay in place and locked slots are skipped.
+func (r *Ranker) guaranteeExposure(items []store.Item, feedback map[int]store.ItemFeedback, locked map[int]bool, pageSize int, now time.Time) []store.Item {
+	cfg := &r.freshness
+	if len(cfg.ExposureSlots) == 0 || cfg.NewWithin <= 0 || len(items) == 0 {
+		return items
+	}
+
+	// Work on the unlocked items; freeIndex maps a position to its index among them
+	var organic []store.Item
+	freeIndex := make(map[int]int)
+	firstPage := 0
+	for p, item := range items {
+		if locked[p+1] {
+			continue
+		}
+		freeIndex[p+1] = len(organic)
+		organic = append(organic, item)
+		if p < pageSize {
+			firstPage++
+		}
+	}
+	var slots []int // 0-based indexes into organic
+	for _, pos := range cfg.ExposureSlots {
+		if idx, ok := freeIndex[pos]; ok && pos <= pageSize {
+			slots = append(slots, idx)
+		}
+	}
+	sort.Ints(slots)
+
+	needsExposure := func(item store.Item) bool {
+		return !item.LaunchedAt.IsZero() && now.Sub(item.LaunchedAt) <= cfg.NewWithin &&
+			feedback[item.ItemID].Impressions < cfg.MinImpressions
+	}
+
+	// New items already on the first page use up slots
+	quota := len(slots)
+	for _, item := range organic[:firstPage] {
+		if needsExposure(item) {
+			quota--
+		}
+	}
+	var promoted []store.Item
+	rest := make([]store.Item, 0, len(organic))
+	rest = append(rest, organic[:firstPage]...)
+	for _, item := range organic[firstPage:] {
+		if quota > 0 && needsExposure(item) {
+			promoted = append(promoted, item)
+			quota--
+			continue
+		}
+		rest = append(rest, item)
+	}
+	if len(promoted) == 0 {
+		return items
+	}
+
+	reordered := make([]store.Item, 0, len(organic))
+	for _, idx := range slots {
+		for len(reordered) < idx && len(rest) > 0 {
+			reordered = append(reordered, rest[0])
+			rest = rest[1:]
+		}
+		if len(promoted) > 0 && len(reordered) == idx {
+			reordered = append(reordered, promoted[0])
+			promoted = promoted[1:]
+		}
+	}
+	reordered = append(reordered, promoted...)
+	reordered = append(reordered, rest...)
+
+	result := make([]store.Item, len(items))
+	for p := range items {
+		if locked[p+1] {
+			result[p] = items[p]
+		} else {
+			result[p] = reordered[freeIndex[p+1]]
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package final
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+const day = 24 * time.Hour
+
+func TestFreshnessCurves(t *testing.T) {
+	cfg := DefaultFreshnessConfig()
+	if got := cfg.decay(cfg.HalfLife); got < 0.49 || got > 0.51 {
+		t.Fatalf("exponential decay at half-life = %.3f", got)
+	}
+	cfg.Curve = CurveLinear
+	if got := cfg.decay(cfg.Horizon / 2); got < 0.49 || got > 0.51 {
+		t.Fatalf("linear decay at half horizon = %.3f", got)
+	}
+	cfg.Curve = CurveStep
+	if cfg.decay(cfg.Horizon-day) != 1 || cfg.decay(cfg.Horizon) != 0 {
+		t.Fatalf("step decay should switch at the horizon")
+	}
+
+	r := NewRanker()
+	now := time.Now()
+	if boost := r.freshnessBoost(now, now); boost != r.freshness.MaxBoost {
+		t.Fatalf("launch-day boost = %.3f", boost)
+	}
+	if boost := r.freshnessBoost(time.Time{}, now); boost != 1 {
+		t.Fatalf("unknown launch date should not be boosted, got %.3f", boost)
+	}
+}
+
+func TestColdStartPriorBorrowsFromPeers(t *testing.T) {
+	r := NewRanker()
+	items := []store.Item{
+		{ItemID: 1, Brand: "Gucci", PriceCents: 200000, Click7d: 100, GMV30d: 5000000},
+		{ItemID: 2, Brand: "Gucci", PriceCents: 210000, Click7d: 60, GMV30d: 3000000},
+		{ItemID: 3, Brand: "Gucci", PriceCents: 900000, Click7d: 10},
+		{ItemID: 4, Brand: "Prada", PriceCents: 50000, Click7d: 5},
+	}
+	priors := r.coldStartPriors(items)
+
+	// Same brand and price band
+	filled := priors.fill(store.Item{ItemID: 5, Brand: "Gucci", PriceCents: 205000})
+	if filled.Click7d != 80 || filled.GMV30d != 4000000 {
+		t.Fatalf("expected brand+band average, got %+v", filled)
+	}
+	// Unknown brand falls back to the price band
+	filled = priors.fill(store.Item{ItemID: 6, Brand: "Dior", PriceCents: 52000})
+	if filled.Click7d != 5 {
+		t.Fatalf("expected band average, got %+v", filled)
+	}
+	// Items with their own behavior are untouched
+	if filled := priors.fill(items[2]); filled.Click7d != 10 {
+		t.Fatalf("item with behavior changed: %+v", filled)
+	}
+}
+
+func TestGuaranteeExposureSkipsLockedSlots(t *testing.T) {
+	r := NewRanker()
+	now := time.Now()
+	var items []store.Item
+	for i := 1; i <= 30; i++ {
+		items = append(items, store.Item{ItemID: i, LaunchedAt: now.Add(-365 * day)})
+	}
+	items[24].LaunchedAt = now.Add(-2 * day) // New, no impressions, on page 2
+	items[26].LaunchedAt = now.Add(-3 * day)
+	items[27].LaunchedAt = now.Add(-3 * day)
+	feedback := map[int]store.ItemFeedback{28: {Impressions: 500}} // Already well exposed
+
+	locked := map[int]bool{10: true}
+	result := r.guaranteeExposure(items, feedback, locked, r.pageSize, now)
+	if result[9].ItemID != 10 {
+		t.Fatalf("locked position 10 moved")
+	}
+	if result[19].ItemID != 25 && result[19].ItemID != 27 {
+		t.Fatalf("expected a new item at slot 20, got %d", result[19].ItemID)
+	}
+	onFirstPage := 0
+	for _, item := range result[:20] {
+		if item.ItemID == 25 || item.ItemID == 27 {
+			onFirstPage++
+		}
+		if item.ItemID == 28 {
+			t.Fatalf("item with enough impressions was promoted")
+		}
+	}
+	if onFirstPage != 1 {
+		t.Fatalf("expected one promoted new item (one slot locked), got %d", onFirstPage)
+	}
+	if len(result) != len(items) {
+		t.Fatalf("items lost: %d of %d", len(result), len(items))
+	}
+}
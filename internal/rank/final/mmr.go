@@ -0,0 +1,115 @@
+package final
+
+import (
+	"math"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// DiversityConfig tunes maximal marginal relevance (MMR) re-ranking.
+// Similarity is a weighted mean of the components available for a pair:
+// embedding cosine, same price band and same brand.
+type DiversityConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Lambda          float64 `json:"lambda"` // 1 = pure relevance, 0 = pure novelty
+	Window          int     `json:"window"` // Only the top Window items are reordered
+	EmbeddingWeight float64 `json:"embedding_weight"`
+	PriceBandWeight float64 `json:"price_band_weight"`
+	BrandWeight     float64 `json:"brand_weight"`
+	PriceBandRatio  float64 `json:"price_band_ratio"` // Price bands grow geometrically by this factor
+}
+
+// DefaultDiversityConfig returns the default MMR settings. Brand is already
+// handled by the greedy stage, so only embeddings count by default.
+func DefaultDiversityConfig() DiversityConfig {
+	return DiversityConfig{
+		Enabled:         true,
+		Lambda:          0.7,
+		Window:          60, // Three pages
+		EmbeddingWeight: 1.0,
+		PriceBandRatio:  2.0, // 250-500, 500-1000, 1000-2000 USD ...
+	}
+}
+
+// priceBand buckets a price on a log scale
+func (c *DiversityConfig) priceBand(cents int) int {
+	if cents <= 0 || c.PriceBandRatio <= 1 {
+		return 0
+	}
+	return int(math.Floor(math.Log(float64(cents)) / math.Log(c.PriceBandRatio)))
+}
+
+// similarity returns how alike two items are in [0, 1] (embeddings may
+// contribute negative cosine, which is clamped)
+func (r *Ranker) similarity(a, b *store.Item, ea, eb []float32) float64 {
+	cfg := &r.diversity
+	var sum, weight float64
+	if cfg.EmbeddingWeight > 0 && len(ea) > 0 && len(ea) == len(eb) {
+		sum += cfg.EmbeddingWeight * math.Max(store.CosineSimilarity(ea, eb), 0)
+		weight += cfg.EmbeddingWeight
+	}
+	if cfg.PriceBandWeight > 0 {
+		if cfg.priceBand(a.PriceCents) == cfg.priceBand(b.PriceCents) {
+			sum += cfg.PriceBandWeight
+		}
+		weight += cfg.PriceBandWeight
+	}
+	if cfg.BrandWeight > 0 {
+		if a.Brand == b.Brand {
+			sum += cfg.BrandWeight
+		}
+		weight += cfg.BrandWeight
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
+}
+
+// mmrRanking reorders the top Window items by maximal marginal relevance:
+// each step picks argmax lambda*relevance - (1-lambda)*max similarity to the
+// items already picked. Relevance comes from the incoming order.
+func (r *Ranker) mmrRanking(items []store.Item) []store.Item {
+	cfg := &r.diversity
+	n := len(items)
+	if !cfg.Enabled || n <= 2 || cfg.Lambda >= 1 {
+		return items
+	}
+	w := cfg.Window
+	if w <= 0 || w > n {
+		w = n
+	}
+
+	embeddings := make([][]float32, w)
+	if r.embeddingOf != nil && cfg.EmbeddingWeight > 0 {
+		for i := 0; i < w; i++ {
+			embeddings[i] = r.embeddingOf(items[i].ItemID)
+		}
+	}
+
+	// maxSim[i] is the highest similarity of candidate i to any picked item
+	maxSim := make([]float64, w)
+	picked := make([]bool, w)
+	result := make([]store.Item, 0, n)
+	for len(result) < w {
+		best, bestScore := -1, math.Inf(-1)
+		for i := 0; i < w; i++ {
+			if picked[i] {
+				continue
+			}
+			relevance := 1 - float64(i)/float64(w)
+			score := cfg.Lambda*relevance - (1-cfg.Lambda)*maxSim[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		result = append(result, items[best])
+		for i := 0; i < w; i++ {
+			if !picked[i] {
+				maxSim[i] = math.Max(maxSim[i], r.similarity(&items[i], &items[best], embeddings[i], embeddings[best]))
+			}
+		}
+	}
+	return append(result, items[w:]...)
+}
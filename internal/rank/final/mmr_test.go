@@ -0,0 +1,56 @@
+package final
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestMMRSpreadsNearIdenticalItems(t *testing.T) {
+	// Ten near-identical black totes from ten brands, then five distinct items
+	var items []store.Item
+	embeddings := make(map[int][]float32)
+	for i := 1; i <= 10; i++ {
+		items = append(items, store.Item{ItemID: i, Brand: string(rune('A' + i))})
+		embeddings[i] = []float32{1, 0.01 * float32(i), 0, 0, 0, 0, 0}
+	}
+	for i := 11; i <= 15; i++ {
+		items = append(items, store.Item{ItemID: i, Brand: string(rune('A' + i))})
+		emb := make([]float32, 7)
+		emb[i-9] = 1 // Orthogonal to the totes and to each other
+		embeddings[i] = emb
+	}
+	items = append(items, store.Item{ItemID: 99, Brand: "Z"}) // Outside the window
+
+	r := NewRanker()
+	cfg := DefaultDiversityConfig()
+	cfg.Lambda = 0.5
+	cfg.Window = 15
+	r.SetDiversityConfig(cfg)
+	r.SetEmbeddingLookup(func(id int) []float32 { return embeddings[id] })
+
+	ranked := r.mmrRanking(items)
+	if ranked[0].ItemID != 1 {
+		t.Fatalf("most relevant item should stay first, got %d", ranked[0].ItemID)
+	}
+	totes := 0
+	for _, item := range ranked[:5] {
+		if item.ItemID <= 10 {
+			totes++
+		}
+	}
+	if totes > 2 {
+		t.Fatalf("expected distinct items in the top 5, got %d near-identical totes", totes)
+	}
+	if ranked[15].ItemID != 99 {
+		t.Fatalf("items beyond the window must keep their position")
+	}
+
+	// Without embeddings MMR keeps the incoming order
+	r.SetEmbeddingLookup(nil)
+	for i, item := range r.mmrRanking(items) {
+		if item.ItemID != items[i].ItemID {
+			t.Fatalf("order changed without similarity signal at %d", i)
+		}
+	}
+}
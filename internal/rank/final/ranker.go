@@ -2,6 +2,8 @@ package final
 
 import (
 	"math"
+	"sort"
+	"time"
 
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
@@ -9,32 +11,280 @@ import (
 // Ranker implements final ranking with business constraints
 type Ranker struct {
 	// Business policy parameters
-	maxSameBrand    int     // Max items from same brand in top results
-	diversityWeight float64 // Weight for diversity vs relevance
-	newItemBoost    float64 // Boost for newly launched items
+	maxSameBrand    int             // Max items from same brand in top results
+	diversityWeight float64         // Weight for diversity vs relevance
+	freshness       FreshnessConfig // Launch-date boost and new-item exposure
+
+	// Similarity-aware diversity
+	diversity   DiversityConfig
+	embeddingOf func(itemID int) []float32 // Optional, for MMR similarity
+
+	// Constraint re-ranking
+	constraints []Constraint // Composition rules on the ranked list
+	objective   Objective    // Utility maximised subject to the constraints
+
+	// Exploration policy parameters
+	pageSize         int     // Page size the exploration slots refer to
+	explorationSlots []int   // 1-based positions on each page reserved for exploration
+	bandit           *Bandit // Chooses which candidates fill the slots
 }
 
 // NewRanker creates a new final ranker
 func NewRanker() *Ranker {
 	return &Ranker{
-		maxSameBrand:    3,    // Max 3 items from same brand in top 20
-		diversityWeight: 0.15, // 15% weight for diversity
-		newItemBoost:    1.1,  // 10% boost for new items
+		maxSameBrand:     3,                         // Max 3 items from same brand in top 20
+		diversityWeight:  0.15,                      // 15% weight for diversity
+		freshness:        DefaultFreshnessConfig(),  // Up to 20% boost, halving every 14 days
+		diversity:        DefaultDiversityConfig(),  // MMR over the top 60 with lambda 0.7
+		objective:        DefaultObjective(),        // Keep the diversity order unless constraints need otherwise
+		pageSize:         20,                        // Matches the API page size
+		explorationSlots: []int{5, 15},              // 2 of 20 positions per page
+		bandit:           NewBandit(PolicyThompson), // Thompson sampling over clicks/buys
 	}
 }
 
+// SetBrandDiversity sets the per-brand cap in the greedy stage and the score
+// penalty per repeated brand.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetBrandDiversity(maxSameBrand int, weight float64) {
+	r.maxSameBrand = maxSameBrand
+	r.diversityWeight = weight
+}
+
+// SetExploration sets the page size, the 1-based exploration positions on
+// each page and the bandit policy filling them.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetExploration(pageSize int, slots []int, policy string) {
+	r.pageSize = pageSize
+	r.explorationSlots = slots
+	r.bandit = NewBandit(policy)
+}
+
+// SetFreshnessConfig replaces the freshness settings.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetFreshnessConfig(cfg FreshnessConfig) {
+	r.freshness = cfg
+}
+
+// SetDiversityConfig replaces the MMR settings.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetDiversityConfig(cfg DiversityConfig) {
+	r.diversity = cfg
+}
+
+// SetEmbeddingLookup provides item embeddings for MMR similarity.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetEmbeddingLookup(lookup func(itemID int) []float32) {
+	r.embeddingOf = lookup
+}
+
+// SetConstraints replaces the constraints enforced by the re-ranker.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetConstraints(constraints []Constraint) {
+	r.constraints = constraints
+}
+
+// SetObjective replaces the utility weights of the re-ranker.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetObjective(objective Objective) {
+	r.objective = objective
+}
+
 // Rank applies final business-aware ranking
 func (r *Ranker) Rank(items []store.Item) []store.Item {
+	ranked, _ := r.RankWithReport(items)
+	return ranked
+}
+
+// RankWithReport applies final ranking and reports the constraints that
+// could not be satisfied
+func (r *Ranker) RankWithReport(items []store.Item) ([]store.Item, []Violation) {
 	if len(items) == 0 {
-		return items
+		return items, nil
 	}
 
-	// Apply diversity-aware greedy selection
-	return r.greedyDiversityRanking(items)
+	// Apply diversity-aware greedy selection, then the business constraints
+	return r.solve(r.diversify(items, nil), nil)
+}
+
+// Request bundles the inputs of a final ranking pass
+type Request struct {
+	Items      []store.Item               // Ranked candidates from the earlier stages
+	Candidates []store.Item               // Exploration candidates
+	Feedback   map[int]store.ItemFeedback // Should cover Candidates and the new items in Items
+	// BanditFeedback drives the choice of exploration candidates: their
+	// exploration exposures and the clicks and buys attributed to them
+	BanditFeedback map[int]store.ItemFeedback
+	Sponsored      []Placement              // Paid placements, highest priority first
+	Pinned         []Pin                    // Merchandised items at fixed positions
+	Boost          func(store.Item) float64 // Optional score multiplier, e.g. query rule boost/bury
+	// Seed makes the bandit's choice repeatable, so every page of a result
+	// set agrees on it; 0 chooses afresh
+	Seed int64
+	// PageSize is the page the exploration and exposure slots refer to;
+	// 0 uses the page size set with SetExploration
+	PageSize int
+}
+
+// Result is the outcome of a final ranking pass
+type Result struct {
+	Items       []store.Item
+	Exploration []store.ExplorationDecision // Exploration slots filled by the bandit
+	Sponsored   []SponsoredSlot             // Paid placements served, by position
+	Violations  []Violation                 // Constraints that could not be satisfied
+}
+
+// RankWithExploration applies final ranking, then fills the exploration slots
+// on every page with candidates chosen by the bandit. The feedback serves
+// both the bandit and new-item exposure. It returns the decisions so they
+// can be logged and fed back into the bandit posteriors, and the
+// constraints that could not be satisfied.
+func (r *Ranker) RankWithExploration(items, candidates []store.Item, feedback map[int]store.ItemFeedback) ([]store.Item, []store.ExplorationDecision, []Violation) {
+	res := r.RankRequest(Request{Items: items, Candidates: candidates, Feedback: feedback, BanditFeedback: feedback})
+	return res.Items, res.Exploration, res.Violations
+}
+
+// RankRequest applies final ranking, fills the exploration slots on every
+// page with candidates chosen by the bandit and places the pinned and
+// sponsored items. Those positions are then held in place while new-item
+// exposure and the constraints are enforced.
+func (r *Ranker) RankRequest(req Request) Result {
+	now := time.Now()
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = r.pageSize
+	}
+	// Slots past the end of the page are never served
+	var slots []int
+	for _, pos := range r.explorationSlots {
+		if pos <= pageSize {
+			slots = append(slots, pos)
+		}
+	}
+
+	// Pinned and sponsored items appear only in their own slot
+	pinnedAt := placePinned(req.Pinned)
+	placedIDs := make(map[int]bool, len(req.Sponsored)+len(pinnedAt))
+	for _, item := range pinnedAt {
+		placedIDs[item.ItemID] = true
+	}
+	var sponsored []Placement
+	for _, p := range req.Sponsored {
+		if !placedIDs[p.Item.ItemID] {
+			sponsored = append(sponsored, p)
+		}
+	}
+	for _, p := range sponsored {
+		placedIDs[p.Item.ItemID] = true
+	}
+	organic := make([]store.Item, 0, len(req.Items))
+	for _, item := range req.Items {
+		if !placedIDs[item.ItemID] {
+			organic = append(organic, item)
+		}
+	}
+	organic = r.diversify(organic, req.Boost)
+
+	var picks []scoredArm
+	if len(slots) > 0 && len(req.Candidates) > 0 && len(organic) > 0 {
+		// Items already ranked organically get exposure anyway
+		inRanked := make(map[int]bool, len(organic))
+		for _, item := range organic {
+			inRanked[item.ItemID] = true
+		}
+		fresh := make([]store.Item, 0, len(req.Candidates))
+		for _, item := range req.Candidates {
+			if !inRanked[item.ItemID] && !placedIDs[item.ItemID] {
+				fresh = append(fresh, item)
+			}
+		}
+		pages := (len(organic) + pageSize - 1) / pageSize
+		picks = r.bandit.Choose(fresh, req.BanditFeedback, pages*len(slots), req.Seed)
+	}
+
+	// Exploration takes the first len(picks) unpinned slot positions;
+	// sponsored placements fit around pins and exploration
+	slot := make(map[int]bool, len(slots))
+	for _, pos := range slots {
+		slot[pos] = true
+	}
+	reserved := make(map[int]bool, len(picks)+len(pinnedAt))
+	for pos := range pinnedAt {
+		reserved[pos] = true
+	}
+	explorePos := make(map[int]bool, len(picks))
+	for pos := 1; len(explorePos) < len(picks); pos++ {
+		if slot[(pos-1)%pageSize+1] && !reserved[pos] {
+			explorePos[pos] = true
+			reserved[pos] = true
+		}
+	}
+	sponsoredAt := placeSponsored(sponsored, reserved)
+
+	var res Result
+	result := make([]store.Item, 0, len(organic)+len(picks)+len(sponsoredAt)+len(pinnedAt))
+	next := 0
+	for len(organic) > 0 {
+		pos := len(result) + 1
+		if item, ok := pinnedAt[pos]; ok {
+			result = append(result, item)
+			continue
+		}
+		if p, ok := sponsoredAt[pos]; ok {
+			item := p.Item
+			item.Sponsored = true
+			result = append(result, item)
+			res.Sponsored = append(res.Sponsored, SponsoredSlot{ItemID: item.ItemID, CampaignID: p.CampaignID, Position: pos})
+			continue
+		}
+		if next < len(picks) && explorePos[pos] {
+			result = append(result, picks[next].item)
+			res.Exploration = append(res.Exploration, store.ExplorationDecision{
+				ItemID:   picks[next].item.ItemID,
+				Position: pos,
+				Policy:   r.bandit.Policy(),
+				Score:    picks[next].score,
+			})
+			next++
+			continue
+		}
+		result = append(result, organic[0])
+		organic = organic[1:]
+	}
+
+	// Pins past the end of a short list close it up
+	var tail []int
+	for pos := range pinnedAt {
+		if pos > len(result) {
+			tail = append(tail, pos)
+		}
+	}
+	sort.Ints(tail)
+	for _, pos := range tail {
+		result = append(result, pinnedAt[pos])
+	}
+
+	locked := make(map[int]bool, len(res.Exploration)+len(res.Sponsored)+len(pinnedAt))
+	for p, item := range result {
+		if placedIDs[item.ItemID] { // Pinned or sponsored
+			locked[p+1] = true
+		}
+	}
+	for _, d := range res.Exploration {
+		locked[d.Position] = true
+	}
+	res.Items, res.Violations = r.solve(r.guaranteeExposure(result, req.Feedback, locked, pageSize, now), locked)
+	return res
+}
+
+// diversify applies brand-aware greedy selection, then MMR on the top window.
+// boost, if set, multiplies each item's greedy score.
+func (r *Ranker) diversify(items []store.Item, boost func(store.Item) float64) []store.Item {
+	return r.mmrRanking(r.greedyDiversityRanking(items, boost))
 }
 
 // greedyDiversityRanking implements a greedy algorithm for diversity-aware ranking
-func (r *Ranker) greedyDiversityRanking(items []store.Item) []store.Item {
+func (r *Ranker) greedyDiversityRanking(items []store.Item, boost func(store.Item) float64) []store.Item {
 	if len(items) <= 1 {
 		return items
 	}
@@ -44,10 +294,12 @@ func (r *Ranker) greedyDiversityRanking(items []store.Item) []store.Item {
 	copy(remaining, items)
 
 	brandCount := make(map[string]int)
+	priors := r.coldStartPriors(items)
+	now := time.Now()
 
 	// Greedy selection with brand diversity constraint
 	for len(remaining) > 0 {
-		bestIdx := r.selectBestItem(remaining, brandCount)
+		bestIdx := r.selectBestItem(remaining, brandCount, priors, boost, now)
 
 		if bestIdx >= 0 {
 			selected := remaining[bestIdx]
@@ -67,7 +319,7 @@ func (r *Ranker) greedyDiversityRanking(items []store.Item) []store.Item {
 }
 
 // selectBestItem selects the best item considering diversity constraints
-func (r *Ranker) selectBestItem(items []store.Item, brandCount map[string]int) int {
+func (r *Ranker) selectBestItem(items []store.Item, brandCount map[string]int, priors *coldStartPriors, boost func(store.Item) float64, now time.Time) int {
 	bestIdx := -1
 	bestScore := -1.0
 
@@ -77,7 +329,10 @@ func (r *Ranker) selectBestItem(items []store.Item, brandCount map[string]int) i
 			continue // Skip if brand limit exceeded
 		}
 
-		score := r.calculateFinalScore(item, brandCount)
+		score := r.calculateFinalScore(priors.fill(item), brandCount, now)
+		if boost != nil {
+			score *= boost(item)
+		}
 
 		if score > bestScore {
 			bestScore = score
@@ -88,20 +343,17 @@ func (r *Ranker) selectBestItem(items []store.Item, brandCount map[string]int) i
 	return bestIdx
 }
 
-// calculateFinalScore calculates the final ranking score with business adjustments
-func (r *Ranker) calculateFinalScore(item store.Item, brandCount map[string]int) float64 {
+// calculateFinalScore calculates the final ranking score with business adjustments.
+// Items without behavioral data should be filled from cold-start priors first.
+func (r *Ranker) calculateFinalScore(item store.Item, brandCount map[string]int, now time.Time) float64 {
 	// Base score from LTR stage (simulated here)
 	baseScore := r.simulateLTRScore(item)
 
 	// Apply business adjustments
 	finalScore := baseScore
 
-	// New item boost (items launched in last 30 days)
-	// In production, you'd calculate days since launch
-	// For now, use a simple heuristic based on click count
-	if item.Click7d > 0 && item.Click7d < 50 { // Assume new items have low clicks
-		finalScore *= r.newItemBoost
-	}
+	// Freshness boost decaying with days since launch
+	finalScore *= r.freshnessBoost(item.LaunchedAt, now)
 
 	// Brand diversity penalty
 	currentBrandCount := brandCount[item.Brand]
@@ -133,14 +385,3 @@ func (r *Ranker) simulateLTRScore(item store.Item) float64 {
 
 	return score
 }
-
-// TODO: Implement LP-based re-ranking for more sophisticated optimization
-// func (r *Ranker) lpReranking(items []store.Item) []store.Item {
-//     // Linear programming based re-ranking for complex business constraints
-//     // This could optimize for multiple objectives simultaneously:
-//     // - Maximize relevance
-//     // - Ensure brand diversity
-//     // - Optimize for GMV
-//     // - Satisfy business rules
-//     return items
-// }
@@ -0,0 +1,59 @@
+package final
+
+import "github.com/Boomshakalak/VibeRS/internal/store"
+
+// Placement is a sponsored item asking for one of a set of positions
+type Placement struct {
+	Item       store.Item
+	CampaignID int
+	Positions  []int // Acceptable 1-based positions, preferred first
+}
+
+// SponsoredSlot records a sponsored item served at a position
+type SponsoredSlot struct {
+	ItemID     int `json:"item_id"`
+	CampaignID int `json:"campaign_id"`
+	Position   int `json:"position"` // 1-based position in the ranked list
+}
+
+// placeSponsored assigns each placement, in order, the first of its
+// positions not reserved for exploration or taken by an earlier placement
+func placeSponsored(placements []Placement, reserved map[int]bool) map[int]Placement {
+	taken := make(map[int]Placement, len(placements))
+	placed := make(map[int]bool, len(placements))
+	for _, p := range placements {
+		if placed[p.Item.ItemID] {
+			continue
+		}
+		for _, pos := range p.Positions {
+			if _, ok := taken[pos]; pos < 1 || ok || reserved[pos] {
+				continue
+			}
+			taken[pos] = p
+			placed[p.Item.ItemID] = true
+			break
+		}
+	}
+	return taken
+}
+
+// Pin is an item merchandised into a fixed 1-based position
+type Pin struct {
+	Item     store.Item
+	Position int
+}
+
+// placePinned maps positions to pinned items. The first pin of a position
+// or an item wins.
+func placePinned(pins []Pin) map[int]store.Item {
+	at := make(map[int]store.Item, len(pins))
+	placed := make(map[int]bool, len(pins))
+	for _, p := range pins {
+		if _, ok := at[p.Position]; p.Position < 1 || ok || placed[p.Item.ItemID] {
+			continue
+		}
+		at[p.Position] = p.Item
+		placed[p.Item.ItemID] = true
+	}
+	return at
+}
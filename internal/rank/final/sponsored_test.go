@@ -0,0 +1,57 @@
+package final
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestRankRequestPlacesPinsAndSponsored(t *testing.T) {
+	r := NewRanker()
+	var items []store.Item
+	for i := 1; i <= 30; i++ {
+		items = append(items, store.Item{ItemID: i, Brand: string(rune('A' + i%20)), Rating: 4, Stock: 1})
+	}
+	res := r.RankRequest(Request{
+		Items:      items,
+		Candidates: []store.Item{{ItemID: 100, Brand: "X"}},
+		Sponsored: []Placement{
+			{Item: store.Item{ItemID: 200, Brand: "S"}, CampaignID: 1, Positions: []int{5, 6}},
+			{Item: store.Item{ItemID: 7}, CampaignID: 2, Positions: []int{2}}, // Also pinned
+		},
+		Pinned: []Pin{{Item: items[6], Position: 2}, {Item: store.Item{ItemID: 300}, Position: 50}},
+	})
+
+	want := map[int]int{2: 7, 5: 100, 6: 200}
+	for pos, id := range want {
+		if got := res.Items[pos-1].ItemID; got != id {
+			t.Errorf("position %d: item %d, want %d", pos, got, id)
+		}
+	}
+	if last := res.Items[len(res.Items)-1]; last.ItemID != 300 {
+		t.Errorf("pin past the end: last item %d, want 300", last.ItemID)
+	}
+	if len(res.Sponsored) != 1 || res.Sponsored[0] != (SponsoredSlot{ItemID: 200, CampaignID: 1, Position: 6}) {
+		t.Errorf("sponsored = %+v", res.Sponsored)
+	}
+	if len(res.Items) != 33 { // 29 organic, 2 pins, 1 sponsored, 1 exploration
+		t.Errorf("got %d items, want 33", len(res.Items))
+	}
+}
+
+func TestRankRequestBoost(t *testing.T) {
+	r := NewRanker()
+	items := []store.Item{
+		{ItemID: 1, Brand: "A", Rating: 5, Stock: 10},
+		{ItemID: 2, Brand: "B", Rating: 3, Stock: 10},
+	}
+	res := r.RankRequest(Request{Items: items, Boost: func(item store.Item) float64 {
+		if item.Brand == "B" {
+			return 3
+		}
+		return 1
+	}})
+	if res.Items[0].ItemID != 2 {
+		t.Errorf("boosted item 2 not ranked first: %+v", res.Items)
+	}
+}
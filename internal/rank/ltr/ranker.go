@@ -1,6 +1,13 @@
 package ltr
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank"
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
 
@@ -9,6 +16,30 @@ type Ranker struct {
 	// In production, this would load an ONNX model
 	// modelPath string
 	// runtime   *onnxruntime.Session
+
+	keepTop      int     // Candidates passed on to final ranking (0 = all)
+	weights      Weights // Linear model placeholder
+	modelVersion string  // Version of the loaded model file, "" for built-in weights
+}
+
+// Weights are the coefficients of the placeholder linear model
+type Weights struct {
+	Rating         float64 `json:"rating"`
+	Price          float64 `json:"price"`
+	Stock          float64 `json:"stock"`
+	ClickRate      float64 `json:"click_rate"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// DefaultWeights returns the placeholder model coefficients
+func DefaultWeights() Weights {
+	return Weights{
+		Rating:         0.25,
+		Price:          0.15,
+		Stock:          0.10,
+		ClickRate:      0.20,
+		ConversionRate: 0.30,
+	}
 }
 
 // NewRanker creates a new LTR ranker
@@ -16,36 +47,71 @@ func NewRanker() *Ranker {
 	return &Ranker{
 		// TODO: Load ONNX model
 		// modelPath: "./model-training/model.onnx",
+		keepTop: 100, // Final ranking sees at most the top 100
+		weights: DefaultWeights(),
 	}
 }
 
-// Rank applies machine learning based ranking
-func (r *Ranker) Rank(items []store.Item) []store.Item {
-	// For now, use a simple heuristic-based scoring
-	// In production, this would use the trained ONNX model
+// SetWeights replaces the model coefficients.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetWeights(w Weights) {
+	r.weights = w
+}
 
-	scored := make([]ScoredItem, len(items))
-	for i, item := range items {
-		score := r.predictBuyProbability(item)
-		scored[i] = ScoredItem{Item: item, Score: score}
-	}
+// Model is the on-disk form of the placeholder model
+//
+//	{"version": "2024-06-01", "weights": {"rating": 0.3, "conversion_rate": 0.4}}
+type Model struct {
+	Version string  `json:"version"`
+	Weights Weights `json:"weights"`
+}
 
-	// Sort by predicted buy probability (descending)
-	for i := 0; i < len(scored); i++ {
-		for j := i + 1; j < len(scored); j++ {
-			if scored[i].Score < scored[j].Score {
-				scored[i], scored[j] = scored[j], scored[i]
-			}
+// LoadModel reads and validates a model file
+func LoadModel(path string) (Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Model{}, err
+	}
+	var m Model
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return Model{}, fmt.Errorf("%s: %w", path, err)
+	}
+	w := m.Weights
+	for _, v := range []float64{w.Rating, w.Price, w.Stock, w.ClickRate, w.ConversionRate} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return Model{}, fmt.Errorf("%s: weights must be finite", path)
 		}
 	}
+	return m, nil
+}
 
-	// Extract sorted items
-	result := make([]store.Item, len(scored))
-	for i, scored := range scored {
-		result[i] = scored.Item
-	}
+// SetModel activates a loaded model.
+// Call it before the ranker starts handling requests.
+func (r *Ranker) SetModel(m Model) {
+	r.weights = m.Weights
+	r.modelVersion = m.Version
+}
+
+// ModelVersion returns the version of the active model file, or "" when
+// the configured weights are used
+func (r *Ranker) ModelVersion() string {
+	return r.modelVersion
+}
+
+// SetBudget sets how many top candidates survive LTR ranking (0 = all)
+func (r *Ranker) SetBudget(keepTop int) {
+	r.keepTop = keepTop
+}
+
+// Rank applies machine learning based ranking
+func (r *Ranker) Rank(items []store.Item) []store.Item {
+	// For now, use a simple heuristic-based scoring
+	// In production, this would use the trained ONNX model
 
-	return result
+	// Score once, keep the top keepTop by predicted buy probability
+	return rank.TopK(items, r.keepTop, r.predictBuyProbability)
 }
 
 // ScoredItem represents an item with its predicted score
@@ -62,11 +128,11 @@ func (r *Ranker) predictBuyProbability(item store.Item) float64 {
 
 	// Simple linear model placeholder (replace with ONNX inference)
 	score := 0.0
-	score += features["rating"] * 0.25
-	score += features["normalized_price"] * 0.15
-	score += features["stock_level"] * 0.10
-	score += features["click_rate"] * 0.20
-	score += features["conversion_rate"] * 0.30
+	score += features["rating"] * r.weights.Rating
+	score += features["normalized_price"] * r.weights.Price
+	score += features["stock_level"] * r.weights.Stock
+	score += features["click_rate"] * r.weights.ClickRate
+	score += features["conversion_rate"] * r.weights.ConversionRate
 
 	// Apply sigmoid to get probability
 	return 1.0 / (1.0 + (-score))
@@ -0,0 +1,40 @@
+package ltr
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/rank/ranktest"
+)
+
+func BenchmarkRank1k(b *testing.B)  { ranktest.Benchmark(b, 1000, NewRanker().Rank) }
+func BenchmarkRank10k(b *testing.B) { ranktest.Benchmark(b, 10000, NewRanker().Rank) }
+
+func TestRankRespectsBudget(t *testing.T) {
+	items := ranktest.Items(1000)
+	r := NewRanker()
+	r.SetBudget(50)
+	ranked := r.Rank(items)
+	if len(ranked) != 50 {
+		t.Fatalf("expected 50 items, got %d", len(ranked))
+	}
+
+	// The kept items are the model's top 50, best first
+	kept := make(map[int]bool, len(ranked))
+	for i, item := range ranked {
+		kept[item.ItemID] = true
+		if i > 0 && r.predictBuyProbability(item) > r.predictBuyProbability(ranked[i-1]) {
+			t.Fatalf("position %d scores above position %d", i+1, i)
+		}
+	}
+	cutoff := r.predictBuyProbability(ranked[len(ranked)-1])
+	for _, item := range items {
+		if !kept[item.ItemID] && r.predictBuyProbability(item) > cutoff {
+			t.Fatalf("item %d outscores the last kept item but was dropped", item.ItemID)
+		}
+	}
+
+	r.SetBudget(0)
+	if all := r.Rank(items); len(all) != 1000 {
+		t.Fatalf("expected all 1000 items without a budget, got %d", len(all))
+	}
+}
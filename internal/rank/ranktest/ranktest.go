@@ -0,0 +1,45 @@
+// Package ranktest provides the candidate fixtures shared by the tests and
+// benchmarks of the ranking stages.
+package ranktest
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Items generates n random candidates that pass the default coarse hard
+// rules. The same n always gives the same items.
+func Items(n int) []store.Item {
+	rng := rand.New(rand.NewSource(42))
+	items := make([]store.Item, n)
+	for i := range items {
+		items[i] = store.Item{
+			ItemID:     i + 1,
+			Brand:      fmt.Sprintf("brand-%d", rng.Intn(50)),
+			PriceCents: 20000 + rng.Intn(500000),
+			Discount:   rng.Float64() * 0.4,
+			Rating:     3 + rng.Float64()*2,
+			Stock:      1 + rng.Intn(50),
+			Click7d:    rng.Intn(500),
+			Buy7d:      rng.Intn(50),
+			GMV30d:     rng.Intn(10000000),
+		}
+	}
+	return items
+}
+
+// Benchmark runs rank over n generated candidates, handing it a fresh copy
+// on every iteration
+func Benchmark(b *testing.B, n int, rank func([]store.Item) []store.Item) {
+	items := Items(n)
+	input := make([]store.Item, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(input, items)
+		rank(input)
+	}
+}
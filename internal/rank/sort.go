@@ -0,0 +1,81 @@
+package rank
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// SortOrder is a user-selected result order
+type SortOrder string
+
+const (
+	SortRelevance   SortOrder = "relevance"    // Full ranking pipeline (default)
+	SortPriceAsc    SortOrder = "price_asc"    // Cheapest first
+	SortPriceDesc   SortOrder = "price_desc"   // Most expensive first
+	SortRating      SortOrder = "rating"       // Best rated first
+	SortNewest      SortOrder = "newest"       // Latest launched_at first
+	SortBestSelling SortOrder = "best_selling" // Most buys in the last 7 days first
+	SortDiscount    SortOrder = "discount"     // Largest discount first
+)
+
+// SortOrders lists the accepted orders, default first
+var SortOrders = []SortOrder{SortRelevance, SortPriceAsc, SortPriceDesc, SortRating, SortNewest, SortBestSelling, SortDiscount}
+
+// ParseSortOrder validates a sort parameter. Empty means relevance.
+func ParseSortOrder(s string) (SortOrder, error) {
+	if s == "" {
+		return SortRelevance, nil
+	}
+	for _, order := range SortOrders {
+		if SortOrder(s) == order {
+			return order, nil
+		}
+	}
+	names := make([]string, len(SortOrders))
+	for i, order := range SortOrders {
+		names[i] = string(order)
+	}
+	return "", fmt.Errorf("unknown sort %q (want one of %s)", s, strings.Join(names, ", "))
+}
+
+// SortItems returns the items in the given order. Ties fall back to the
+// item ID so every page of a sorted result set is stable across requests,
+// whatever order the candidates were recalled in. Relevance keeps the
+// input order.
+func SortItems(items []store.Item, order SortOrder) []store.Item {
+	sorted := make([]store.Item, len(items))
+	copy(sorted, items)
+	if order == SortRelevance {
+		return sorted
+	}
+
+	// by < 0 puts a first
+	var by func(a, b *store.Item) int
+	switch order {
+	case SortPriceAsc:
+		by = func(a, b *store.Item) int { return cmp.Compare(a.PriceCents, b.PriceCents) }
+	case SortPriceDesc:
+		by = func(a, b *store.Item) int { return cmp.Compare(b.PriceCents, a.PriceCents) }
+	case SortRating:
+		by = func(a, b *store.Item) int { return cmp.Compare(b.Rating, a.Rating) }
+	case SortNewest:
+		by = func(a, b *store.Item) int { return b.LaunchedAt.Compare(a.LaunchedAt) }
+	case SortBestSelling:
+		by = func(a, b *store.Item) int { return cmp.Compare(b.Buy7d, a.Buy7d) }
+	case SortDiscount:
+		by = func(a, b *store.Item) int { return cmp.Compare(b.Discount, a.Discount) }
+	default:
+		return sorted
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := by(&sorted[i], &sorted[j]); c != 0 {
+			return c < 0
+		}
+		return sorted[i].ItemID < sorted[j].ItemID
+	})
+	return sorted
+}
@@ -0,0 +1,59 @@
+package rank
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestSortItems(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	items := []store.Item{
+		{ItemID: 4, PriceCents: 300, Rating: 4.5, LaunchedAt: day(1), Buy7d: 2, Discount: 0.1},
+		{ItemID: 2, PriceCents: 100, Rating: 4.5, LaunchedAt: day(9), Buy7d: 7, Discount: 0},
+		{ItemID: 3, PriceCents: 300, Rating: 3.0, LaunchedAt: day(9), Buy7d: 2, Discount: 0.3},
+		{ItemID: 1, PriceCents: 200, Rating: 5.0, LaunchedAt: day(5), Buy7d: 0, Discount: 0.1},
+	}
+	cases := map[SortOrder][]int{
+		SortRelevance:   {4, 2, 3, 1},
+		SortPriceAsc:    {2, 1, 3, 4}, // Equal prices by item ID
+		SortPriceDesc:   {3, 4, 1, 2},
+		SortRating:      {1, 2, 4, 3},
+		SortNewest:      {2, 3, 1, 4},
+		SortBestSelling: {2, 3, 4, 1},
+		SortDiscount:    {3, 1, 4, 2},
+	}
+	for order, want := range cases {
+		got := SortItems(items, order)
+		for i, item := range got {
+			if item.ItemID != want[i] {
+				t.Errorf("%s: got %v, want %v", order, ids(got), want)
+				break
+			}
+		}
+	}
+	if items[0].ItemID != 4 {
+		t.Error("SortItems reordered its input")
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	if order, err := ParseSortOrder(""); order != SortRelevance || err != nil {
+		t.Errorf("empty sort = %q, %v", order, err)
+	}
+	if order, err := ParseSortOrder("newest"); order != SortNewest || err != nil {
+		t.Errorf("newest = %q, %v", order, err)
+	}
+	if _, err := ParseSortOrder("cheapest"); err == nil {
+		t.Error("unknown sort accepted")
+	}
+}
+
+func ids(items []store.Item) []int {
+	out := make([]int, len(items))
+	for i, item := range items {
+		out[i] = item.ItemID
+	}
+	return out
+}
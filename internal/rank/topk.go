@@ -0,0 +1,82 @@
+// Package rank holds helpers shared by the coarse, ltr and final stages.
+package rank
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// entry is an item index with its precomputed score
+type entry struct {
+	idx   int
+	score float64
+}
+
+// better orders by score descending, then input position for stable ties
+func better(a, b entry) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.idx < b.idx
+}
+
+// minHeap keeps the worst retained entry at the root
+type minHeap []entry
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return better(h[j], h[i]) }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(entry)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
+
+// TopK returns the k highest-scoring items, best first, scoring each item
+// exactly once. Ties keep input order. k <= 0 means keep everything.
+// Runs in O(n log k) time.
+func TopK(items []store.Item, k int, score func(store.Item) float64) []store.Item {
+	ordered, _ := TopKScored(items, k, score)
+	return ordered
+}
+
+// TopKScored is TopK that also returns the score of each kept item
+func TopKScored(items []store.Item, k int, score func(store.Item) float64) ([]store.Item, []float64) {
+	if k <= 0 || k > len(items) {
+		k = len(items)
+	}
+
+	var kept []entry
+	if k == len(items) {
+		kept = make([]entry, len(items))
+		for i, item := range items {
+			kept[i] = entry{idx: i, score: score(item)}
+		}
+	} else {
+		h := make(minHeap, 0, k)
+		for i, item := range items {
+			e := entry{idx: i, score: score(item)}
+			if len(h) < k {
+				heap.Push(&h, e)
+			} else if better(e, h[0]) {
+				h[0] = e
+				heap.Fix(&h, 0)
+			}
+		}
+		kept = h
+	}
+	sort.Slice(kept, func(i, j int) bool { return better(kept[i], kept[j]) })
+
+	result := make([]store.Item, len(kept))
+	scores := make([]float64, len(kept))
+	for i, e := range kept {
+		result[i] = items[e.idx]
+		scores[i] = e.score
+	}
+	return result, scores
+}
@@ -0,0 +1,45 @@
+package rank
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestTopKMatchesFullSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	items := make([]store.Item, 1000)
+	for i := range items {
+		items[i] = store.Item{ItemID: i, Rating: float64(rng.Intn(50)) / 10} // many ties
+	}
+	score := func(it store.Item) float64 { return it.Rating }
+
+	calls := 0
+	counted := func(it store.Item) float64 { calls++; return score(it) }
+
+	want := make([]store.Item, len(items))
+	copy(want, items)
+	sort.SliceStable(want, func(i, j int) bool { return score(want[i]) > score(want[j]) })
+
+	for _, k := range []int{0, 1, 10, 500, 1000, 5000} {
+		calls = 0
+		got := TopK(items, k, counted)
+		if calls != len(items) {
+			t.Fatalf("k=%d: score called %d times, want %d", k, calls, len(items))
+		}
+		n := k
+		if n <= 0 || n > len(items) {
+			n = len(items)
+		}
+		if len(got) != n {
+			t.Fatalf("k=%d: got %d items", k, len(got))
+		}
+		for i := range got {
+			if got[i].ItemID != want[i].ItemID {
+				t.Fatalf("k=%d: position %d is item %d, want %d", k, i, got[i].ItemID, want[i].ItemID)
+			}
+		}
+	}
+}
@@ -1,146 +1,322 @@
 package recall
 
 import (
-	"math"
+	"errors"
 	"sort"
 
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
 
+// Embedding spaces with a dedicated similar-items recall
+const (
+	SpaceImage = "image"
+	SpaceStyle = "style"
+)
+
+// ErrUnknownSpace is returned for an embedding space that is not indexed
+var ErrUnknownSpace = errors.New("unknown embedding space")
+
+// ErrNoEmbedding is returned when the seed item has no embedding in a space
+var ErrNoEmbedding = errors.New("item has no embedding")
+
 // ANNRecaller handles approximate nearest neighbor recall strategies
 type ANNRecaller struct {
-	store *store.Service
-	items []store.Item
-	dim   int
+	store    *store.Service
+	index    *vectorIndex            // Default space (items.embedding)
+	spaces   map[string]*vectorIndex // Named spaces (item_embeddings)
+	profiles *ProfileBuilder
+	cf       *CFRecaller
+	hybrid   HybridConfig
 }
 
-func cosineSimilarity(a, b []float32) float64 {
-	if len(a) != len(b) {
-		return 0
-	}
-	var dot, na, nb float64
-	for i := range a {
-		dot += float64(a[i] * b[i])
-		na += float64(a[i] * a[i])
-		nb += float64(b[i] * b[i])
-	}
-	if na == 0 || nb == 0 {
-		return 0
+// NewANNRecaller creates a new ANN recall handler
+func NewANNRecaller(storeService *store.Service) *ANNRecaller {
+	return &ANNRecaller{
+		store:    storeService,
+		index:    newVectorIndex(nil),
+		profiles: NewProfileBuilder(storeService),
+		cf:       NewCFRecaller(storeService),
+		hybrid:   DefaultHybridConfig(),
 	}
-	return dot / (math.Sqrt(na) * math.Sqrt(nb))
 }
 
-// NewANNRecaller creates a new ANN recall handler
-func NewANNRecaller(storeService *store.Service) *ANNRecaller {
-	return &ANNRecaller{store: storeService}
+// withStore returns a copy of the recaller sharing its indexes but querying st
+func (ar *ANNRecaller) withStore(st *store.Service) *ANNRecaller {
+	bound := *ar
+	bound.store = st
+	bound.profiles = ar.profiles.withStore(st)
+	bound.cf = ar.cf.withStore(st)
+	return &bound
 }
 
-// Build loads all embeddings from the store into memory
+// SetHybridConfig replaces the lexical/semantic blend settings.
+// Call it before the recaller starts handling requests.
+func (ar *ANNRecaller) SetHybridConfig(cfg HybridConfig) {
+	ar.hybrid = cfg
+}
+
+// Build loads all embeddings from the store into memory, one index per space
 func (ar *ANNRecaller) Build() error {
 	data, err := ar.store.GetAllItemEmbeddings()
 	if err != nil {
 		return err
 	}
-	if len(data) == 0 {
-		ar.items = nil
-		return nil
+	names, err := ar.store.GetEmbeddingSpaces()
+	if err != nil {
+		return err
+	}
+	spaces := make(map[string]*vectorIndex, len(names))
+	for _, name := range names {
+		spaceData, err := ar.store.GetSpaceEmbeddings(name)
+		if err != nil {
+			return err
+		}
+		spaces[name] = newVectorIndex(spaceData)
 	}
-	ar.dim = len(data[0].Embedding)
-	ar.items = data
+
+	ar.index = newVectorIndex(data)
+	ar.spaces = spaces
 	return nil
 }
 
+// Dim returns the dimension of the default embedding space
+func (ar *ANNRecaller) Dim() int {
+	return ar.index.dim
+}
+
+// Size returns the number of items in the default embedding space
+func (ar *ANNRecaller) Size() int {
+	return ar.index.size()
+}
+
+// Spaces returns the names of all indexed embedding spaces
+func (ar *ANNRecaller) Spaces() []string {
+	names := []string{store.DefaultEmbeddingSpace}
+	for name := range ar.spaces {
+		if name != store.DefaultEmbeddingSpace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// space returns the index of a named embedding space
+func (ar *ANNRecaller) space(name string) (*vectorIndex, error) {
+	if name == "" || name == store.DefaultEmbeddingSpace {
+		return ar.index, nil
+	}
+	idx, ok := ar.spaces[name]
+	if !ok {
+		return nil, ErrUnknownSpace
+	}
+	return idx, nil
+}
+
+// Embedding returns the default-space embedding of an item, or nil
+func (ar *ANNRecaller) Embedding(itemID int) []float32 {
+	return ar.index.embeddingOf(itemID)
+}
+
+// embeddingOf returns the default-space embedding of an item, or nil
+func (ar *ANNRecaller) embeddingOf(itemID int) []float32 {
+	return ar.index.embeddingOf(itemID)
+}
+
+// nearest returns the ids of the limit items most similar to query in the
+// default space, skipping any id in exclude. A filtered store restricts the
+// search to the items passing its filter.
+func (ar *ANNRecaller) nearest(query []float32, limit int, exclude map[int]bool) []int {
+	return ids(ar.index.nearest(query, limit, exclude, ar.allowed()))
+}
+
+// allowed returns the items passing the store's filter, nil when the store
+// is unfiltered. Searching among them rather than filtering the neighbours
+// afterwards keeps selective filters from starving vector recall.
+func (ar *ANNRecaller) allowed() map[int]bool {
+	if ar.store.Filter().Empty() {
+		return nil
+	}
+	ids, err := ar.store.GetFilteredItemIDs()
+	if err != nil {
+		return nil // Neighbours are still filtered when fetched
+	}
+	return ids
+}
+
 // VectorSimilarityRecall performs vector similarity search
 // SQL: ORDER BY Cosine(embedding, ?) DESC
 func (ar *ANNRecaller) VectorSimilarityRecall(queryEmbedding []float32, limit int) ([]store.Item, error) {
-	if len(queryEmbedding) != ar.dim || len(ar.items) == 0 {
+	ids := ar.nearest(queryEmbedding, limit, nil)
+	if len(ids) == 0 {
 		return []store.Item{}, nil
 	}
-	type pair struct {
-		id    int
-		score float64
+	return ar.store.GetItemsByIDs(ids)
+}
+
+// Brand filters for SimilarItems
+const (
+	BrandAny       = ""
+	BrandSame      = "same"
+	BrandDifferent = "different"
+)
+
+// SimilarOptions narrows a similar-items search
+type SimilarOptions struct {
+	Space       string  // Embedding space; empty means the default space
+	Brand       string  // BrandAny, BrandSame or BrandDifferent
+	PriceBand   float64 // If > 0, keep prices within ±PriceBand of the seed (0.3 = ±30%)
+	InStockOnly bool
+}
+
+// SimilarItems finds the nearest neighbours of an item's own embedding,
+// excluding the item itself, then applies the attribute filters. Candidates
+// are over-fetched and the window widened until enough items pass.
+func (ar *ANNRecaller) SimilarItems(itemID int, opts SimilarOptions, limit int) ([]store.Item, error) {
+	idx, err := ar.space(opts.Space)
+	if err != nil {
+		return nil, err
 	}
-	scores := make([]pair, 0, len(ar.items))
-	for _, it := range ar.items {
-		if len(it.Embedding) != ar.dim {
-			continue
+	seedEmb := idx.embeddingOf(itemID)
+	if seedEmb == nil {
+		return nil, ErrNoEmbedding
+	}
+
+	filtered := opts.Brand != BrandAny || opts.PriceBand > 0 || opts.InStockOnly
+	var seed store.Item
+	if filtered {
+		seeds, err := ar.store.GetItemsByIDs([]int{itemID})
+		if err != nil {
+			return nil, err
 		}
-		score := cosineSimilarity(it.Embedding, queryEmbedding)
-		scores = append(scores, pair{id: it.ItemID, score: score})
+		if len(seeds) == 0 {
+			return nil, ErrNoEmbedding
+		}
+		seed = seeds[0]
 	}
-	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
-	if len(scores) > limit {
-		scores = scores[:limit]
+
+	exclude := map[int]bool{itemID: true}
+	window := limit
+	if filtered {
+		window = limit * 4
 	}
-	ids := make([]int, len(scores))
-	for i, p := range scores {
-		ids[i] = p.id
+	for {
+		candidates, err := ar.store.GetItemsByIDs(ids(idx.nearest(seedEmb, window, exclude, nil)))
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]store.Item, 0, limit)
+		for _, item := range candidates {
+			if filtered && !passesSimilarFilters(seed, item, opts) {
+				continue
+			}
+			result = append(result, item)
+			if len(result) == limit {
+				return result, nil
+			}
+		}
+		if window >= idx.size() {
+			return result, nil
+		}
+		window *= 4
 	}
-	return ar.store.GetItemsByIDs(ids)
 }
 
-// SemanticSearchRecall performs semantic search using embeddings
-func (ar *ANNRecaller) SemanticSearchRecall(queryText string, limit int) ([]store.Item, error) {
-	// TODO: This would:
-	// 1. Convert queryText to embedding using a model
-	// 2. Search for similar item embeddings
-	// 3. Return most similar items
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+// passesSimilarFilters checks a candidate against the seed item
+func passesSimilarFilters(seed, item store.Item, opts SimilarOptions) bool {
+	if opts.Brand == BrandSame && item.Brand != seed.Brand {
+		return false
+	}
+	if opts.Brand == BrandDifferent && item.Brand == seed.Brand {
+		return false
+	}
+	if opts.PriceBand > 0 {
+		lo := float64(seed.PriceCents) * (1 - opts.PriceBand)
+		hi := float64(seed.PriceCents) * (1 + opts.PriceBand)
+		if float64(item.PriceCents) < lo || float64(item.PriceCents) > hi {
+			return false
+		}
+	}
+	if opts.InStockOnly && item.Stock <= 0 {
+		return false
+	}
+	return true
 }
 
 // VisualSimilarityRecall finds visually similar items
+// Nearest neighbours in the "image" embedding space
 func (ar *ANNRecaller) VisualSimilarityRecall(itemID int, limit int) ([]store.Item, error) {
-	// TODO: This would find items with similar visual features
-	// Based on image embeddings or visual descriptors
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+	return ar.SimilarItems(itemID, SimilarOptions{Space: SpaceImage, InStockOnly: true}, limit)
 }
 
 // StyleSimilarityRecall finds items with similar style
+// Nearest neighbours in the "style" embedding space
 func (ar *ANNRecaller) StyleSimilarityRecall(itemID int, limit int) ([]store.Item, error) {
-	// TODO: This would find items with similar style characteristics
-	// Could use style embeddings, color palettes, design elements
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+	return ar.SimilarItems(itemID, SimilarOptions{Space: SpaceStyle, InStockOnly: true}, limit)
 }
 
 // UserProfileRecall finds items similar to user's preferences
+// The profile is a time-decayed, action-weighted mean of history embeddings
 func (ar *ANNRecaller) UserProfileRecall(userID string, limit int) ([]store.Item, error) {
-	// TODO: This would:
-	// 1. Build user preference embedding from history
-	// 2. Find items similar to user's taste profile
-	// 3. Return personalized recommendations
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+	profile, err := ar.profiles.Build(userID, ar.embeddingOf)
+	if err != nil || profile == nil {
+		return []store.Item{}, err
+	}
+
+	// Don't recommend what the user has just interacted with
+	exclude := make(map[int]bool, len(profile.ItemIDs))
+	for _, id := range profile.ItemIDs {
+		exclude[id] = true
+	}
+	ids := ar.nearest(profile.Vector, limit, exclude)
+	if len(ids) == 0 {
+		return []store.Item{}, nil
+	}
+	return ar.store.GetItemsByIDs(ids)
 }
 
-// CollaborativeFilteringRecall finds items liked by similar users
+// CollaborativeFilteringRecall finds items co-engaged with the user's
+// recent interactions, using the offline item_similarity table
 func (ar *ANNRecaller) CollaborativeFilteringRecall(userID string, limit int) ([]store.Item, error) {
-	// TODO: This would:
-	// 1. Find users with similar purchase/interaction patterns
-	// 2. Recommend items those users liked
-	// 3. Use user-item interaction embeddings
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+	return ar.cf.RecentInteractionsRecall(userID, limit)
 }
 
 // ContentBasedRecall finds items similar to user's interaction history
+// Neighbours of each recent history item are interleaved, most recent first
 func (ar *ANNRecaller) ContentBasedRecall(userID string, limit int) ([]store.Item, error) {
-	// TODO: This would:
-	// 1. Analyze items user has interacted with
-	// 2. Find items with similar content features
-	// 3. Use item content embeddings for similarity
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
-}
-
-// HybridRecall combines multiple ANN strategies
-func (ar *ANNRecaller) HybridRecall(queryText string, userID string, limit int) ([]store.Item, error) {
-	// TODO: This would combine:
-	// - Semantic search based on query
-	// - User preference matching
-	// - Collaborative filtering signals
-	// For now, return empty results as placeholder
-	return []store.Item{}, nil
+	profile, err := ar.profiles.Build(userID, ar.embeddingOf)
+	if err != nil || profile == nil {
+		return []store.Item{}, err
+	}
+
+	seeds := profile.ItemIDs
+	if len(seeds) > 5 {
+		seeds = seeds[:5] // Only the most recent interests
+	}
+	exclude := make(map[int]bool, len(profile.ItemIDs))
+	for _, id := range profile.ItemIDs {
+		exclude[id] = true
+	}
+
+	perSeed := (limit + len(seeds) - 1) / len(seeds)
+	neighbours := make([][]int, len(seeds))
+	allowed := ar.allowed()
+	for i, seed := range seeds {
+		neighbours[i] = ids(ar.index.nearest(ar.embeddingOf(seed), perSeed, exclude, allowed))
+	}
+
+	var ids []int
+	for rank := 0; rank < perSeed && len(ids) < limit; rank++ {
+		for _, list := range neighbours {
+			if rank < len(list) && !exclude[list[rank]] && len(ids) < limit {
+				exclude[list[rank]] = true
+				ids = append(ids, list[rank])
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return []store.Item{}, nil
+	}
+	return ar.store.GetItemsByIDs(ids)
 }
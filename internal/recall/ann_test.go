@@ -1,6 +1,7 @@
 package recall
 
 import (
+	"math"
 	"os"
 	"testing"
 
@@ -53,3 +54,112 @@ func TestANNBuildAndRecall(t *testing.T) {
 		t.Fatalf("expected 1 item, got %d", len(items))
 	}
 }
+
+func TestUserProfileRecall(t *testing.T) {
+	db := newTestDB(t, "test_profile.db")
+	vecs := map[int][]float32{
+		1: {1, 0, 0},
+		2: {0.9, 0.1, 0},
+		3: {0, 1, 0},
+		4: {0, 0.9, 0.1},
+	}
+	for id, v := range vecs {
+		if _, err := db.Exec(`INSERT INTO items (item_id, title, brand, price_cents, discount, rating, stock, click_7d, buy_7d, gmv_30d, embedding) VALUES (?, 't', 'b', 100, 0, 5, 1, 0, 0, 0, ?)`, id, encodeEmbedding(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A recent purchase of item 3 outweighs an old view of item 1
+	if _, err := db.Exec(`INSERT INTO user_actions (user_id, item_id, action_type, timestamp) VALUES
+		('u1', 1, 'view', datetime('now', '-60 days')),
+		('u1', 3, 'buy', datetime('now', '-1 days'))`); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewANNRecaller(store.NewService(db))
+	if err := rec.Build(); err != nil {
+		t.Fatal(err)
+	}
+	items, err := rec.UserProfileRecall("u1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ItemID != 4 {
+		t.Fatalf("expected item 4 closest to profile, got %+v", items)
+	}
+
+	items, err = rec.UserProfileRecall("nobody", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no items without history, got %d", len(items))
+	}
+}
+
+// encodeEmbedding serializes a vector the way items.embedding stores it
+func encodeEmbedding(v []float32) []byte {
+	emb := make([]byte, 0, 4*len(v))
+	for _, f := range v {
+		bits := math.Float32bits(f)
+		emb = append(emb, byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24))
+	}
+	return emb
+}
+
+func TestSimilarItemsFiltersAndSpaces(t *testing.T) {
+	db := newTestDB(t, "test_similar.db")
+	rows := []struct {
+		id    int
+		brand string
+		price int
+		stock int
+		vec   []float32
+	}{
+		{1, "A", 1000, 1, []float32{1, 0}},
+		{2, "A", 1100, 1, []float32{0.99, 0.01}},
+		{3, "B", 1050, 1, []float32{0.98, 0.02}},
+		{4, "B", 5000, 1, []float32{0.97, 0.03}},
+		{5, "B", 1000, 0, []float32{0.96, 0.04}},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec(`INSERT INTO items (item_id, title, brand, price_cents, discount, rating, stock, click_7d, buy_7d, gmv_30d, embedding) VALUES (?, 't', ?, ?, 0, 5, ?, 0, 0, 0, ?)`,
+			r.id, r.brand, r.price, r.stock, encodeEmbedding(r.vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := store.NewService(db)
+	// In the image space item 5 is the closest to item 1
+	if err := s.SaveItemEmbedding(1, SpaceImage, []float32{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveItemEmbedding(5, SpaceImage, []float32{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveItemEmbedding(2, SpaceImage, []float32{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewANNRecaller(s)
+	if err := rec.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := rec.SimilarItems(1, SimilarOptions{}, 1)
+	if err != nil || len(items) != 1 || items[0].ItemID != 2 {
+		t.Fatalf("default space: expected item 2, got %+v (%v)", items, err)
+	}
+	items, err = rec.SimilarItems(1, SimilarOptions{Brand: BrandDifferent, PriceBand: 0.2, InStockOnly: true}, 5)
+	if err != nil || len(items) != 1 || items[0].ItemID != 3 {
+		t.Fatalf("filtered: expected only item 3, got %+v (%v)", items, err)
+	}
+	items, err = rec.SimilarItems(1, SimilarOptions{Space: SpaceImage}, 1)
+	if err != nil || len(items) != 1 || items[0].ItemID != 5 {
+		t.Fatalf("image space: expected item 5, got %+v (%v)", items, err)
+	}
+	if _, err := rec.SimilarItems(1, SimilarOptions{Space: "missing"}, 1); err != ErrUnknownSpace {
+		t.Fatalf("expected ErrUnknownSpace, got %v", err)
+	}
+	if _, err := rec.SimilarItems(3, SimilarOptions{Space: SpaceImage}, 1); err != ErrNoEmbedding {
+		t.Fatalf("expected ErrNoEmbedding, got %v", err)
+	}
+}
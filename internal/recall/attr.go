@@ -53,33 +53,34 @@ func (ar *AttrRecaller) SmartAttrRecall(query string, limit int) ([]store.Item,
 	return []store.Item{}, nil
 }
 
+// brandAliases maps lowercase brand mentions to canonical brand names
+var brandAliases = map[string]string{
+	"gucci":          "Gucci",
+	"louis vuitton":  "Louis Vuitton",
+	"chanel":         "Chanel",
+	"hermes":         "Hermès",
+	"prada":          "Prada",
+	"saint laurent":  "Saint Laurent",
+	"bottega veneta": "Bottega Veneta",
+	"fendi":          "Fendi",
+	"dior":           "Dior",
+	"balenciaga":     "Balenciaga",
+	"celine":         "Celine",
+	"givenchy":       "Givenchy",
+	"valentino":      "Valentino",
+	"loewe":          "Loewe",
+	"jacquemus":      "Jacquemus",
+	"staud":          "Staud",
+	"mansur gavriel": "Mansur Gavriel",
+	"cult gaia":      "Cult Gaia",
+	"polene":         "Polene",
+	"wandler":        "Wandler",
+}
+
 // extractBrandFromQuery attempts to extract brand name from query
 func (ar *AttrRecaller) extractBrandFromQuery(query string) string {
-	brands := map[string]string{
-		"gucci":          "Gucci",
-		"louis vuitton":  "Louis Vuitton",
-		"chanel":         "Chanel",
-		"hermes":         "Hermès",
-		"prada":          "Prada",
-		"saint laurent":  "Saint Laurent",
-		"bottega veneta": "Bottega Veneta",
-		"fendi":          "Fendi",
-		"dior":           "Dior",
-		"balenciaga":     "Balenciaga",
-		"celine":         "Celine",
-		"givenchy":       "Givenchy",
-		"valentino":      "Valentino",
-		"loewe":          "Loewe",
-		"jacquemus":      "Jacquemus",
-		"staud":          "Staud",
-		"mansur gavriel": "Mansur Gavriel",
-		"cult gaia":      "Cult Gaia",
-		"polene":         "Polene",
-		"wandler":        "Wandler",
-	}
-
 	queryLower := strings.ToLower(query)
-	for key, brand := range brands {
+	for key, brand := range brandAliases {
 		if strings.Contains(queryLower, key) {
 			return brand
 		}
@@ -87,18 +88,17 @@ func (ar *AttrRecaller) extractBrandFromQuery(query string) string {
 	return ""
 }
 
+// QueryFilters returns the attribute and price filters recognised in a
+// query, such as {"brand": "Chanel", "max_price_cents": "10000"}
+func (ar *AttrRecaller) QueryFilters(query string) map[string]string {
+	filters := ParseQuery(query).Filters.Fields()
+	if brand := ar.extractBrandFromQuery(query); brand != "" {
+		filters["brand"] = brand
+	}
+	return filters
+}
+
 // mightContainBrand checks if query might contain brand information
 func (ar *AttrRecaller) mightContainBrand(query string) bool {
-	brands := []string{"gucci", "louis vuitton", "chanel", "hermes", "prada",
-		"saint laurent", "bottega veneta", "fendi", "dior", "balenciaga",
-		"celine", "givenchy", "valentino", "loewe", "jacquemus", "staud",
-		"mansur gavriel", "cult gaia", "polene", "wandler"}
-
-	queryLower := strings.ToLower(query)
-	for _, brand := range brands {
-		if strings.Contains(queryLower, brand) {
-			return true
-		}
-	}
-	return false
+	return ar.extractBrandFromQuery(query) != ""
 }
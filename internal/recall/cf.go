@@ -0,0 +1,90 @@
+package recall
+
+import (
+	"sort"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// CFRecaller serves item-to-item collaborative filtering recall from the
+// offline item_similarity table
+type CFRecaller struct {
+	store       *store.Service
+	recentLimit int // Recent interactions used as seeds
+	perSeed     int // Related items fetched per seed
+}
+
+// NewCFRecaller creates a new collaborative filtering recall handler
+func NewCFRecaller(storeService *store.Service) *CFRecaller {
+	return &CFRecaller{
+		store:       storeService,
+		recentLimit: 20,
+		perSeed:     20,
+	}
+}
+
+// withStore returns a copy of the recaller querying st
+func (cr *CFRecaller) withStore(st *store.Service) *CFRecaller {
+	bound := *cr
+	bound.store = st
+	return &bound
+}
+
+// RelatedRecall returns in-stock items frequently engaged with alongside itemID
+// SQL: item_similarity WHERE item_id=? ORDER BY score DESC
+func (cr *CFRecaller) RelatedRecall(itemID int, limit int) ([]store.Item, error) {
+	sims, err := cr.store.GetRelatedItemIDs(itemID, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(sims))
+	for i, sim := range sims {
+		ids[i] = sim.RelatedID
+	}
+	return cr.store.GetItemsByIDs(ids)
+}
+
+// RecentInteractionsRecall aggregates the related items of the user's most
+// recent interactions, excluding the interacted items themselves
+func (cr *CFRecaller) RecentInteractionsRecall(userID string, limit int) ([]store.Item, error) {
+	if userID == "" {
+		return []store.Item{}, nil
+	}
+	actions, err := cr.store.GetUserActions(userID, cr.recentLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := make(map[int]bool)
+	for _, a := range actions {
+		seeds[a.ItemID] = true
+	}
+
+	scores := make(map[int]float64)
+	for seed := range seeds {
+		sims, err := cr.store.GetRelatedItemIDs(seed, cr.perSeed)
+		if err != nil {
+			return nil, err
+		}
+		for _, sim := range sims {
+			if !seeds[sim.RelatedID] {
+				scores[sim.RelatedID] += sim.Score
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return cr.store.GetItemsByIDs(ids)
+}
@@ -0,0 +1,59 @@
+package recall
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestCFRecallSkipsSeedsAndOutOfStock(t *testing.T) {
+	db := newTestDB(t, "test_cf.db")
+	for id := 1; id <= 6; id++ {
+		stock := 1
+		if id == 5 {
+			stock = 0
+		}
+		if _, err := db.Exec(`INSERT INTO items (item_id, title, brand, price_cents, discount, rating, stock, click_7d, buy_7d, gmv_30d) VALUES (?, 'bag', 'b', 100, 0, 4, ?, 0, 0, 0)`,
+			id, stock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`INSERT INTO item_similarity (item_id, related_id, score, co_count) VALUES
+		(1, 2, 0.9, 9), (1, 5, 0.8, 8), (1, 3, 0.4, 4), (2, 4, 0.7, 7), (2, 1, 0.9, 9), (6, 1, 0.9, 9)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.NewService(db)
+	for _, id := range []int{1, 2} {
+		if err := st.RecordAction("u1", id, store.ActionClick, "bag"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cf := NewCFRecaller(st)
+
+	related, err := cf.RelatedRecall(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemIDs(related); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("related to 1 = %v, want [2 3]", got)
+	}
+
+	// Seeds 1 and 2 are excluded; 4 (0.7) ranks above 3 (0.4)
+	recent, err := cf.RecentInteractionsRecall("u1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemIDs(recent); !reflect.DeepEqual(got, []int{4, 3}) {
+		t.Errorf("recent interactions recall = %v, want [4 3]", got)
+	}
+}
+
+func itemIDs(items []store.Item) []int {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.ItemID
+	}
+	return ids
+}
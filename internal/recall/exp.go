@@ -1,65 +1,217 @@
 package recall
 
 import (
+	"math"
+	"math/rand"
+	"sort"
+
 	"github.com/Boomshakalak/VibeRS/internal/store"
 )
 
 // ExpRecaller handles exploration recall strategies
 type ExpRecaller struct {
 	store *store.Service
+	rng   *rand.Rand // Drives shuffles and sampling when set; see withSeed
+
+	// Exploration policy parameters
+	longTailPoolFactor int     // Candidate pool size as a multiple of limit
+	budgetQuantile     float64 // Price quantile treated as the budget band ceiling
+	radarMinRating     float64 // Min rating for under-the-radar items
+	radarMaxClicks     int     // Max 7d clicks for under-the-radar items
 }
 
 // NewExpRecaller creates a new exploration recall handler
 func NewExpRecaller(storeService *store.Service) *ExpRecaller {
-	return &ExpRecaller{store: storeService}
+	return &ExpRecaller{
+		store:              storeService,
+		longTailPoolFactor: 4,    // Sample 4x candidates before reweighting
+		budgetQuantile:     0.25, // Bottom quartile of prices
+		radarMinRating:     4.5,  // Clearly well-reviewed
+		radarMaxClicks:     100,  // But rarely clicked
+	}
+}
+
+// withStore returns a copy of the recaller querying st
+func (er *ExpRecaller) withStore(st *store.Service) *ExpRecaller {
+	bound := *er
+	bound.store = st
+	return &bound
+}
+
+// withSeed returns a copy of the recaller whose shuffles and samples are
+// drawn from a source seeded with seed; its store should be seeded too.
+// The copy must not be shared between goroutines.
+func (er *ExpRecaller) withSeed(seed int64) *ExpRecaller {
+	seeded := *er
+	seeded.rng = rand.New(rand.NewSource(seed))
+	return &seeded
+}
+
+// shuffle shuffles n elements with the recaller's source
+func (er *ExpRecaller) shuffle(n int, swap func(i, j int)) {
+	if er.rng != nil {
+		er.rng.Shuffle(n, swap)
+		return
+	}
+	rand.Shuffle(n, swap)
+}
+
+// float64 returns a random number in [0, 1) from the recaller's source
+func (er *ExpRecaller) float64() float64 {
+	if er.rng != nil {
+		return er.rng.Float64()
+	}
+	return rand.Float64()
 }
 
 // RandomRecall returns random items for exploration
-// SQL: ORDER BY RANDOM() LIMIT ?
+// SQL: item_id >= ? ORDER BY item_id LIMIT ? (random rowid ranges)
 func (er *ExpRecaller) RandomRecall(limit int) ([]store.Item, error) {
 	return er.store.GetRandomItems(limit)
 }
 
 // DiversityRecall returns diverse items to increase exploration
+// Brand-stratified: an equal share of random items is drawn from every brand,
+// or from limit random brands when the catalog has more
 func (er *ExpRecaller) DiversityRecall(limit int) ([]store.Item, error) {
-	// This could implement brand diversity, price diversity, etc.
-	// For now, using random selection which provides natural diversity
-	return er.store.GetRandomItems(limit)
+	brands, err := er.store.GetInStockBrands()
+	if err != nil {
+		return nil, err
+	}
+	if len(brands) == 0 {
+		return er.store.GetRandomItems(limit)
+	}
+
+	er.shuffle(len(brands), func(i, j int) { brands[i], brands[j] = brands[j], brands[i] })
+	if len(brands) > limit {
+		brands = brands[:limit]
+	}
+	perBrand := (limit + len(brands) - 1) / len(brands)
+
+	items, err := er.store.GetRandomItemsByBrands(brands, perBrand)
+	if err != nil {
+		return nil, err
+	}
+	byBrand := make(map[string][]store.Item, len(brands))
+	for _, item := range items {
+		byBrand[item.Brand] = append(byBrand[item.Brand], item)
+	}
+
+	// Brands earlier in the shuffle get their full share when limit does
+	// not divide evenly
+	result := make([]store.Item, 0, limit)
+	for _, brand := range brands {
+		share := byBrand[brand]
+		if rem := limit - len(result); len(share) > rem {
+			share = share[:rem]
+		}
+		result = append(result, share...)
+	}
+
+	return result, nil
 }
 
 // LongTailRecall returns less popular items for discovery
+// Inverse-popularity sampling: weight = 1 / (1 + clicks + 5*buys)
 func (er *ExpRecaller) LongTailRecall(limit int) ([]store.Item, error) {
-	// This would return items with lower popularity scores
-	// Could be inverse of hot items - items with lower clicks/GMV
-	// For now, using random which includes long-tail items
-	return er.store.GetRandomItems(limit)
+	pool, err := er.store.GetRandomItems(limit * er.longTailPoolFactor)
+	if err != nil {
+		return nil, err
+	}
+	return weightedSample(pool, limit, er.float64, func(item store.Item) float64 {
+		return 1.0 / (1.0 + float64(item.Click7d) + 5.0*float64(item.Buy7d))
+	}), nil
 }
 
 // SerendipityRecall returns unexpected but potentially interesting items
+// Mixes the other exploration strategies so no single bias dominates
 func (er *ExpRecaller) SerendipityRecall(limit int) ([]store.Item, error) {
-	// This could use collaborative filtering or content-based surprises
-	// For now, using random selection
-	return er.store.GetRandomItems(limit)
+	strategies := []func(int) ([]store.Item, error){
+		er.LongTailRecall,
+		er.UnderTheRadarRecall,
+		er.NewItemsRecall,
+		er.DiversityRecall,
+	}
+	share := (limit + len(strategies) - 1) / len(strategies)
+
+	seen := make(map[int]bool)
+	var result []store.Item
+	for _, strategy := range strategies {
+		items, err := strategy(share)
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			if !seen[item.ItemID] {
+				seen[item.ItemID] = true
+				result = append(result, item)
+			}
+		}
+	}
+
+	er.shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
 }
 
 // NewItemsRecall returns newly added items for discovery
+// SQL: ORDER BY launched_at DESC
 func (er *ExpRecaller) NewItemsRecall(limit int) ([]store.Item, error) {
-	// This would sort by recently added items (launched_at DESC)
-	// For now, using random selection
-	return er.store.GetRandomItems(limit)
+	return er.store.GetNewestItems(limit)
 }
 
 // BudgetFriendlyRecall returns lower-priced items for exploration
+// The band ceiling is the budgetQuantile price of a random catalog sample
 func (er *ExpRecaller) BudgetFriendlyRecall(limit int) ([]store.Item, error) {
-	// This would filter by lower price ranges
-	// For now, using random selection
-	return er.store.GetRandomItems(limit)
+	sample, err := er.store.GetRandomItems(200)
+	if err != nil {
+		return nil, err
+	}
+	if len(sample) == 0 {
+		return []store.Item{}, nil
+	}
+
+	prices := make([]int, len(sample))
+	for i, item := range sample {
+		prices[i] = item.PriceCents
+	}
+	sort.Ints(prices)
+	ceiling := prices[int(float64(len(prices)-1)*er.budgetQuantile)]
+
+	return er.store.GetRandomItemsUnderPrice(ceiling, limit)
 }
 
 // UnderTheRadarRecall returns items that might be overlooked
+// High rating with low clicks: quality but not well-discovered
 func (er *ExpRecaller) UnderTheRadarRecall(limit int) ([]store.Item, error) {
-	// This could find items with good ratings but low clicks
-	// Items that are quality but not well-discovered
-	// For now, using random selection
-	return er.store.GetRandomItems(limit)
+	return er.store.GetUnderexposedItems(er.radarMinRating, er.radarMaxClicks, limit)
+}
+
+// weightedSample draws up to k items without replacement, proportionally to
+// weight, using Efraimidis-Spirakis keys (u^(1/w)) with u drawn from uniform
+func weightedSample(items []store.Item, k int, uniform func() float64, weight func(store.Item) float64) []store.Item {
+	type keyed struct {
+		item store.Item
+		key  float64
+	}
+	keys := make([]keyed, 0, len(items))
+	for _, item := range items {
+		w := weight(item)
+		if w <= 0 {
+			continue
+		}
+		keys = append(keys, keyed{item: item, key: math.Pow(uniform(), 1.0/w)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key > keys[j].key })
+	if len(keys) > k {
+		keys = keys[:k]
+	}
+
+	result := make([]store.Item, len(keys))
+	for i, kv := range keys {
+		result[i] = kv.item
+	}
+	return result
 }
@@ -0,0 +1,138 @@
+package recall
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// newTestDB creates a throwaway database with the items table
+func newTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	os.Remove(path)
+	db, err := store.InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(path)
+	})
+	schema := `CREATE TABLE items (
+               item_id INTEGER PRIMARY KEY,
+               title TEXT,
+               brand TEXT,
+               price_cents INTEGER,
+               discount REAL,
+               rating REAL,
+               stock INTEGER,
+               launched_at DATETIME,
+               click_7d INTEGER,
+               buy_7d INTEGER,
+               gmv_30d INTEGER,
+               embedding BLOB
+       );`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestExpRecallStrategies(t *testing.T) {
+	db := newTestDB(t, "test_exp.db")
+	brands := []string{"A", "B", "C", "D"}
+	for i := 1; i <= 40; i++ {
+		_, err := db.Exec(`INSERT INTO items (item_id, title, brand, price_cents, discount, rating, stock, launched_at, click_7d, buy_7d, gmv_30d)
+			VALUES (?, ?, ?, ?, 0, ?, 1, ?, ?, 0, 0)`,
+			i, fmt.Sprintf("item %d", i), brands[i%len(brands)], i*1000, 3.0+float64(i%3),
+			fmt.Sprintf("2024-01-%02d 00:00:00", 1+i%28), i*10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := NewExpRecaller(store.NewService(db))
+
+	items, err := rec.RandomRecall(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 10 {
+		t.Fatalf("random: expected 10 items, got %d", len(items))
+	}
+
+	items, err = rec.DiversityRecall(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perBrand := make(map[string]int)
+	for _, it := range items {
+		perBrand[it.Brand]++
+	}
+	for _, b := range brands {
+		if perBrand[b] != 2 {
+			t.Fatalf("diversity: expected 2 items of brand %s, got %d", b, perBrand[b])
+		}
+	}
+
+	// More brands than slots: one item from each of limit brands
+	items, err = rec.DiversityRecall(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perBrand = make(map[string]int)
+	for _, it := range items {
+		perBrand[it.Brand]++
+	}
+	if len(items) != 3 || len(perBrand) != 3 {
+		t.Fatalf("diversity: expected 3 items of distinct brands, got %v", perBrand)
+	}
+
+	// A brand filter narrows the cached brand list
+	st := store.NewService(db)
+	if _, err := st.GetInStockBrands(); err != nil {
+		t.Fatal(err)
+	}
+	items, err = NewExpRecaller(st.WithFilter(store.ItemFilter{Brands: []string{"b"}})).DiversityRecall(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("filtered diversity: expected 4 items, got %d", len(items))
+	}
+	for _, it := range items {
+		if it.Brand != "B" {
+			t.Fatalf("filtered diversity: item of brand %s", it.Brand)
+		}
+	}
+
+	items, err = rec.NewItemsRecall(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(items); i++ {
+		if items[i].LaunchedAt.After(items[i-1].LaunchedAt) {
+			t.Fatalf("new items: not ordered by launched_at")
+		}
+	}
+
+	items, err = rec.BudgetFriendlyRecall(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) == 0 || len(items) > 20 {
+		t.Fatalf("budget: expected a low price band, got %d items", len(items))
+	}
+
+	items, err = rec.UnderTheRadarRecall(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range items {
+		if it.Rating < 4.5 || it.Click7d > 100 {
+			t.Fatalf("under the radar: unexpected item %+v", it)
+		}
+	}
+}
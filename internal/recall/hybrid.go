@@ -0,0 +1,264 @@
+package recall
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// QueryType buckets queries by how much they benefit from lexical matching
+type QueryType string
+
+const (
+	QueryBrand       QueryType = "brand"       // Only a brand name: "chanel"
+	QueryShort       QueryType = "short"       // One or two keywords: "saddle bag"
+	QueryDescriptive QueryType = "descriptive" // Natural language: "roomy black tote for work"
+	QueryDefault     QueryType = "default"
+)
+
+// HybridConfig tunes the lexical/semantic blend
+type HybridConfig struct {
+	Alpha            map[QueryType]float64 // Lexical weight per query type; 1-alpha goes to semantic
+	MinRelativeScore float64               // Drop candidates scoring below this fraction of the best
+	FeedbackDepth    int                   // Top lexical hits averaged into the query vector
+	ProfileWeight    float64               // Share of the user's taste profile in the query vector
+}
+
+// DefaultHybridConfig returns the default blend settings
+func DefaultHybridConfig() HybridConfig {
+	return HybridConfig{
+		Alpha: map[QueryType]float64{
+			QueryBrand:       0.9, // Brand queries lean lexical
+			QueryShort:       0.7,
+			QueryDefault:     0.5,
+			QueryDescriptive: 0.3, // Descriptive queries lean semantic
+		},
+		MinRelativeScore: 0.5,
+		FeedbackDepth:    10,
+		ProfileWeight:    0.2,
+	}
+}
+
+// stopwords are dropped before lexical matching and query classification
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "for": true, "with": true,
+	"of": true, "in": true, "on": true, "to": true, "or": true, "my": true,
+}
+
+// queryKeywords lowercases and tokenizes a query, dropping stopwords
+func queryKeywords(query string) []string {
+	var keywords []string
+	for _, token := range strings.Fields(strings.ToLower(query)) {
+		if !stopwords[token] {
+			keywords = append(keywords, token)
+		}
+	}
+	return keywords
+}
+
+// ClassifyQuery decides the query type from its characteristics
+func ClassifyQuery(query string) QueryType {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if _, ok := brandAliases[normalized]; ok {
+		return QueryBrand
+	}
+
+	keywords := queryKeywords(query)
+	switch {
+	case len(keywords) == 0:
+		return QueryDefault
+	case len(keywords) <= 2 && len(keywords) == len(strings.Fields(normalized)):
+		return QueryShort
+	case len(keywords) >= 4 || len(keywords) < len(strings.Fields(normalized)):
+		// Long queries or ones with function words read as descriptions
+		return QueryDescriptive
+	}
+	return QueryDefault
+}
+
+// hybridCandidate accumulates the two component scores of an item
+type hybridCandidate struct {
+	item     *store.Item
+	lexical  float64
+	semantic float64
+	blended  float64
+}
+
+// HybridRecall runs lexical and vector recall together and blends their
+// normalised scores: alpha*lexical + (1-alpha)*semantic, with alpha chosen by
+// ClassifyQuery. Without a query encoder the query vector is built from the
+// embeddings of the best lexical hits (pseudo-relevance feedback), mixed with
+// the user's taste profile when userID has history.
+func (ar *ANNRecaller) HybridRecall(queryText string, userID string, limit int) ([]store.Item, error) {
+	keywords := queryKeywords(queryText)
+	if len(keywords) == 0 {
+		return []store.Item{}, nil
+	}
+	alpha, ok := ar.hybrid.Alpha[ClassifyQuery(queryText)]
+	if !ok {
+		alpha = ar.hybrid.Alpha[QueryDefault]
+	}
+
+	// Lexical: items matching at least half of the keywords
+	minMatched := (len(keywords) + 1) / 2
+	matches, err := ar.store.GetItemsByKeywordMatch(keywords, minMatched, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[int]*hybridCandidate, len(matches))
+	for i := range matches {
+		candidates[matches[i].Item.ItemID] = &hybridCandidate{
+			item:    &matches[i].Item,
+			lexical: float64(matches[i].Matched) / float64(len(keywords)),
+		}
+	}
+
+	// Semantic: nearest neighbours of the query vector, min-max normalised
+	queryVec := ar.hybridQueryVector(matches, userID)
+	neighbours := ar.index.nearest(queryVec, limit, nil, ar.allowed())
+	if len(neighbours) > 0 {
+		hi, lo := neighbours[0].score, neighbours[len(neighbours)-1].score
+		for _, n := range neighbours {
+			norm := 1.0
+			if hi > lo {
+				norm = (n.score - lo) / (hi - lo)
+			}
+			c, ok := candidates[n.id]
+			if !ok {
+				c = &hybridCandidate{}
+				candidates[n.id] = c
+			}
+			c.semantic = norm
+		}
+	}
+
+	// Blend, threshold relative to the best candidate and order
+	ranked := make([]int, 0, len(candidates))
+	best := 0.0
+	for id, c := range candidates {
+		c.blended = alpha*c.lexical + (1-alpha)*c.semantic
+		best = math.Max(best, c.blended)
+		ranked = append(ranked, id)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		ci, cj := candidates[ranked[i]], candidates[ranked[j]]
+		if ci.blended != cj.blended {
+			return ci.blended > cj.blended
+		}
+		return ranked[i] < ranked[j]
+	})
+
+	var keep []int
+	var missing []int
+	for _, id := range ranked {
+		if candidates[id].blended < best*ar.hybrid.MinRelativeScore || len(keep) == limit {
+			break
+		}
+		keep = append(keep, id)
+		if candidates[id].item == nil {
+			missing = append(missing, id)
+		}
+	}
+
+	// Semantic-only candidates still need their attributes
+	if len(missing) > 0 {
+		fetched, err := ar.store.GetItemsByIDs(missing)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fetched {
+			candidates[fetched[i].ItemID].item = &fetched[i]
+		}
+	}
+
+	result := make([]store.Item, 0, len(keep))
+	for _, id := range keep {
+		if c := candidates[id]; c.item != nil {
+			result = append(result, *c.item)
+		}
+	}
+	return result, nil
+}
+
+// SemanticSearchRecall performs semantic search using embeddings
+// The query vector comes from pseudo-relevance feedback on lexical hits
+func (ar *ANNRecaller) SemanticSearchRecall(queryText string, limit int) ([]store.Item, error) {
+	keywords := queryKeywords(queryText)
+	if len(keywords) == 0 {
+		return []store.Item{}, nil
+	}
+	matches, err := ar.store.GetItemsByKeywordMatch(keywords, (len(keywords)+1)/2, ar.hybrid.FeedbackDepth)
+	if err != nil {
+		return nil, err
+	}
+	neighbours := ar.index.nearest(ar.hybridQueryVector(matches, ""), limit, nil, ar.allowed())
+	if len(neighbours) == 0 {
+		return []store.Item{}, nil
+	}
+	return ar.store.GetItemsByIDs(ids(neighbours))
+}
+
+// hybridQueryVector averages the embeddings of the top lexical hits and
+// mixes in the user's profile. It returns nil if neither is available.
+func (ar *ANNRecaller) hybridQueryVector(matches []store.KeywordMatch, userID string) []float32 {
+	dim := ar.index.dim
+	if dim == 0 {
+		return nil
+	}
+
+	var feedback []float64
+	count := 0
+	for _, m := range matches {
+		if count >= ar.hybrid.FeedbackDepth {
+			break
+		}
+		emb := ar.embeddingOf(m.Item.ItemID)
+		if len(emb) != dim {
+			continue
+		}
+		var norm float64
+		for _, v := range emb {
+			norm += float64(v) * float64(v)
+		}
+		if norm == 0 {
+			continue
+		}
+		norm = math.Sqrt(norm)
+		if feedback == nil {
+			feedback = make([]float64, dim)
+		}
+		// Unit-normalise like the profile builder so the two mix evenly
+		for i, v := range emb {
+			feedback[i] += float64(v) / norm
+		}
+		count++
+	}
+
+	var profileVec []float32
+	if userID != "" {
+		if profile, err := ar.profiles.Build(userID, ar.embeddingOf); err == nil && profile != nil && len(profile.Vector) == dim {
+			profileVec = profile.Vector
+		}
+	}
+
+	if feedback == nil && profileVec == nil {
+		return nil
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		var v float64
+		if feedback != nil {
+			v = feedback[i] / float64(count)
+			if profileVec != nil {
+				v = (1-ar.hybrid.ProfileWeight)*v + ar.hybrid.ProfileWeight*float64(profileVec[i])
+			}
+		} else {
+			v = float64(profileVec[i])
+		}
+		vec[i] = float32(v)
+	}
+	return vec
+}
@@ -0,0 +1,79 @@
+package recall
+
+import (
+	"testing"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+func TestClassifyQuery(t *testing.T) {
+	cases := map[string]QueryType{
+		"Chanel":                       QueryBrand,
+		"bottega  veneta":              QueryBrand,
+		"saddle bag":                   QueryShort,
+		"black leather tote":           QueryDefault,
+		"roomy black tote for work":    QueryDescriptive,
+		"small quilted crossbody bag ": QueryDescriptive,
+		"":                             QueryDefault,
+	}
+	for q, want := range cases {
+		if got := ClassifyQuery(q); got != want {
+			t.Errorf("ClassifyQuery(%q) = %s, want %s", q, got, want)
+		}
+	}
+}
+
+func TestHybridRecallBlendsLexicalAndSemantic(t *testing.T) {
+	db := newTestDB(t, "test_hybrid.db")
+	rows := []struct {
+		id    int
+		title string
+		vec   []float32
+	}{
+		{1, "black leather tote", []float32{1, 0}},
+		{2, "red canvas clutch", []float32{0.95, 0.05}}, // no keyword overlap, close in embedding
+		{3, "black nylon backpack", []float32{0, 1}},
+		{4, "green silk scarf", []float32{-1, 0}},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec(`INSERT INTO items (item_id, title, brand, price_cents, discount, rating, stock, click_7d, buy_7d, gmv_30d, embedding) VALUES (?, ?, 'b', 100, 0, 5, 1, 0, 0, 0, ?)`,
+			r.id, r.title, encodeEmbedding(r.vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := NewANNRecaller(store.NewService(db))
+	if err := rec.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Descriptive query leans semantic: the close clutch is recalled even
+	// though it shares no keyword, the scarf is not
+	items, err := rec.HybridRecall("a black leather tote for the office", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[int]bool)
+	for _, it := range items {
+		got[it.ItemID] = true
+	}
+	if len(items) == 0 || items[0].ItemID != 1 {
+		t.Fatalf("expected the full lexical match first, got %+v", items)
+	}
+	if !got[2] || got[4] {
+		t.Fatalf("expected semantic neighbour 2 and not 4, got %v", got)
+	}
+
+	// A purely lexical blend drops the keyword-less neighbour
+	cfg := DefaultHybridConfig()
+	cfg.Alpha[QueryDescriptive] = 1
+	rec.SetHybridConfig(cfg)
+	items, err = rec.HybridRecall("a black leather tote for the office", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range items {
+		if it.ItemID == 2 {
+			t.Fatalf("alpha 1 still recalled semantic-only item 2: %+v", items)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package recall
+
+import (
+	"sort"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// scoredID is an item id with its similarity to a query vector
+type scoredID struct {
+	id    int
+	score float64
+}
+
+// vectorIndex is an in-memory brute-force index over one embedding space
+type vectorIndex struct {
+	items []store.Item
+	byID  map[int]int // item_id -> index into items
+	dim   int
+}
+
+// newVectorIndex indexes items whose embedding has the dimension of the first
+func newVectorIndex(data []store.Item) *vectorIndex {
+	idx := &vectorIndex{byID: make(map[int]int, len(data))}
+	if len(data) == 0 {
+		return idx
+	}
+	idx.dim = len(data[0].Embedding)
+	idx.items = data
+	for i, it := range data {
+		idx.byID[it.ItemID] = i
+	}
+	return idx
+}
+
+// size returns the number of indexed items
+func (vi *vectorIndex) size() int {
+	if vi == nil {
+		return 0
+	}
+	return len(vi.items)
+}
+
+// embeddingOf returns the indexed embedding of an item, or nil
+func (vi *vectorIndex) embeddingOf(itemID int) []float32 {
+	if vi == nil {
+		return nil
+	}
+	i, ok := vi.byID[itemID]
+	if !ok {
+		return nil
+	}
+	return vi.items[i].Embedding
+}
+
+// nearest returns the limit items most similar to query, best first,
+// skipping any id in exclude and, when allowed is not nil, any id not in it
+func (vi *vectorIndex) nearest(query []float32, limit int, exclude, allowed map[int]bool) []scoredID {
+	if vi == nil || len(query) != vi.dim || len(vi.items) == 0 {
+		return nil
+	}
+	scores := make([]scoredID, 0, len(vi.items))
+	for _, it := range vi.items {
+		if len(it.Embedding) != vi.dim || exclude[it.ItemID] || allowed != nil && !allowed[it.ItemID] {
+			continue
+		}
+		scores = append(scores, scoredID{id: it.ItemID, score: store.CosineSimilarity(it.Embedding, query)})
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores
+}
+
+// ids extracts the item ids of scored results
+func ids(scored []scoredID) []int {
+	out := make([]int, len(scored))
+	for i, s := range scored {
+		out[i] = s.id
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package recall
+
+import (
+	"math"
+	"time"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// UserProfile is a taste vector built from a user's interaction history
+type UserProfile struct {
+	Vector  []float32
+	ItemIDs []int // Items the profile was built from, most recent first
+}
+
+// ProfileBuilder turns user_actions history into a UserProfile
+type ProfileBuilder struct {
+	store         *store.Service
+	historyLimit  int                // Most recent actions considered
+	halfLife      time.Duration      // Time for an action's weight to halve
+	actionWeights map[string]float64 // Strength of each action type
+	now           func() time.Time
+}
+
+// NewProfileBuilder creates a profile builder with default weights
+func NewProfileBuilder(storeService *store.Service) *ProfileBuilder {
+	return &ProfileBuilder{
+		store:        storeService,
+		historyLimit: 200,                 // Last 200 actions
+		halfLife:     14 * 24 * time.Hour, // Two-week half-life
+		actionWeights: map[string]float64{
+			store.ActionView:      0.5,
+			store.ActionClick:     1.0,
+			store.ActionAddToCart: 2.0,
+			store.ActionBuy:       3.0,
+		},
+		now: time.Now,
+	}
+}
+
+// withStore returns a copy of the builder querying st
+func (pb *ProfileBuilder) withStore(st *store.Service) *ProfileBuilder {
+	bound := *pb
+	bound.store = st
+	return &bound
+}
+
+// Build averages the embeddings of the user's historical items, weighted by
+// action type and exponential time decay. It returns nil when the user has
+// no history with known embeddings.
+func (pb *ProfileBuilder) Build(userID string, embeddingOf func(itemID int) []float32) (*UserProfile, error) {
+	if userID == "" {
+		return nil, nil
+	}
+	actions, err := pb.store.GetUserActions(userID, pb.historyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var vector []float64
+	var totalWeight float64
+	seen := make(map[int]bool)
+	profile := &UserProfile{}
+	now := pb.now()
+
+	for _, action := range actions {
+		emb := embeddingOf(action.ItemID)
+		if len(emb) == 0 {
+			continue
+		}
+		if vector == nil {
+			vector = make([]float64, len(emb))
+		}
+		if len(emb) != len(vector) {
+			continue
+		}
+
+		weight := pb.actionWeights[action.ActionType]
+		if weight == 0 {
+			continue
+		}
+		if !action.Timestamp.IsZero() {
+			age := now.Sub(action.Timestamp)
+			if age > 0 {
+				weight *= math.Exp2(-float64(age) / float64(pb.halfLife))
+			}
+		}
+
+		// Normalise each embedding so long vectors don't dominate the average
+		var norm float64
+		for _, v := range emb {
+			norm += float64(v) * float64(v)
+		}
+		if norm == 0 {
+			continue
+		}
+		norm = math.Sqrt(norm)
+		for i, v := range emb {
+			vector[i] += weight * float64(v) / norm
+		}
+		totalWeight += weight
+
+		if !seen[action.ItemID] {
+			seen[action.ItemID] = true
+			profile.ItemIDs = append(profile.ItemIDs, action.ItemID)
+		}
+	}
+
+	if totalWeight == 0 {
+		return nil, nil
+	}
+	profile.Vector = make([]float32, len(vector))
+	for i, v := range vector {
+		profile.Vector[i] = float32(v / totalWeight)
+	}
+	return profile, nil
+}
@@ -0,0 +1,251 @@
+package recall
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Filters are hard constraints on recalled items. Zero values are unset.
+type Filters struct {
+	Brands        []string `json:"brands,omitempty"` // Any of these brands, case-insensitive
+	MinPriceCents int      `json:"min_price_cents,omitempty"`
+	MaxPriceCents int      `json:"max_price_cents,omitempty"`
+	MinRating     float64  `json:"min_rating,omitempty"`
+	InStock       bool     `json:"in_stock,omitempty"`
+	Discounted    bool     `json:"discounted,omitempty"`
+}
+
+// filterNames lists the filters from least to most important; relaxation
+// removes them in this order
+var filterNames = []string{"discounted", "in_stock", "rating", "price", "brand"}
+
+// Empty reports whether no filter is set
+func (f Filters) Empty() bool {
+	return f.ItemFilter().Empty()
+}
+
+// without returns the filters with the named one removed
+func (f Filters) without(name string) Filters {
+	switch name {
+	case "brand":
+		f.Brands = nil
+	case "price":
+		f.MinPriceCents, f.MaxPriceCents = 0, 0
+	case "rating":
+		f.MinRating = 0
+	case "in_stock":
+		f.InStock = false
+	case "discounted":
+		f.Discounted = false
+	}
+	return f
+}
+
+// has reports whether the named filter is set
+func (f Filters) has(name string) bool {
+	switch name {
+	case "brand":
+		return len(f.Brands) > 0
+	case "price":
+		return f.MinPriceCents > 0 || f.MaxPriceCents > 0
+	case "rating":
+		return f.MinRating > 0
+	case "in_stock":
+		return f.InStock
+	case "discounted":
+		return f.Discounted
+	}
+	return false
+}
+
+// Validate checks that the filters can match anything
+func (f Filters) Validate() error {
+	for _, brand := range f.Brands {
+		if strings.TrimSpace(brand) == "" {
+			return errors.New("filters.brands: empty brand")
+		}
+	}
+	switch {
+	case f.MinPriceCents < 0 || f.MaxPriceCents < 0:
+		return errors.New("filters: prices must not be negative")
+	case f.MaxPriceCents > 0 && f.MinPriceCents > f.MaxPriceCents:
+		return errors.New("filters: min_price_cents exceeds max_price_cents")
+	case f.MinRating < 0 || f.MinRating > 5:
+		return errors.New("filters.min_rating: must be between 0 and 5")
+	}
+	return nil
+}
+
+// Merge combines explicit filters with filters parsed from the query.
+// Explicit filters take precedence: a parsed filter is only used when the
+// explicit ones leave it unset, so "under $100" in the query never
+// overrides a price range chosen in the UI.
+func (f Filters) Merge(parsed Filters) Filters {
+	merged := f
+	for _, name := range filterNames {
+		if !f.has(name) && parsed.has(name) {
+			merged = merged.with(name, parsed)
+		}
+	}
+	return merged
+}
+
+// with returns the filters with the named one copied from src
+func (f Filters) with(name string, src Filters) Filters {
+	switch name {
+	case "brand":
+		f.Brands = src.Brands
+	case "price":
+		f.MinPriceCents, f.MaxPriceCents = src.MinPriceCents, src.MaxPriceCents
+	case "rating":
+		f.MinRating = src.MinRating
+	case "in_stock":
+		f.InStock = src.InStock
+	case "discounted":
+		f.Discounted = src.Discounted
+	}
+	return f
+}
+
+// Match reports whether an item satisfies every filter
+func (f Filters) Match(item store.Item) bool {
+	if len(f.Brands) > 0 {
+		found := false
+		for _, brand := range f.Brands {
+			if strings.EqualFold(brand, item.Brand) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MinPriceCents > 0 && item.PriceCents < f.MinPriceCents {
+		return false
+	}
+	if f.MaxPriceCents > 0 && item.PriceCents > f.MaxPriceCents {
+		return false
+	}
+	if f.MinRating > 0 && item.Rating < f.MinRating {
+		return false
+	}
+	if f.InStock && item.Stock <= 0 {
+		return false
+	}
+	if f.Discounted && item.Discount <= 0 {
+		return false
+	}
+	return true
+}
+
+// Apply returns the items satisfying every filter
+func (f Filters) Apply(items []store.Item) []store.Item {
+	if f.Empty() {
+		return items
+	}
+	kept := make([]store.Item, 0, len(items))
+	for _, item := range items {
+		if f.Match(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// Fields returns the set filters as strings keyed by JSON name, for logging
+func (f Filters) Fields() map[string]string {
+	fields := make(map[string]string)
+	if len(f.Brands) > 0 {
+		fields["brands"] = strings.Join(f.Brands, ",")
+	}
+	if f.MinPriceCents > 0 {
+		fields["min_price_cents"] = strconv.Itoa(f.MinPriceCents)
+	}
+	if f.MaxPriceCents > 0 {
+		fields["max_price_cents"] = strconv.Itoa(f.MaxPriceCents)
+	}
+	if f.MinRating > 0 {
+		fields["min_rating"] = strconv.FormatFloat(f.MinRating, 'f', -1, 64)
+	}
+	if f.InStock {
+		fields["in_stock"] = "true"
+	}
+	if f.Discounted {
+		fields["discounted"] = "true"
+	}
+	return fields
+}
+
+// ItemFilter converts the filters for store queries
+func (f Filters) ItemFilter() store.ItemFilter {
+	return store.ItemFilter{
+		Brands:        f.Brands,
+		MinPriceCents: f.MinPriceCents,
+		MaxPriceCents: f.MaxPriceCents,
+		MinRating:     f.MinRating,
+		InStock:       f.InStock,
+		Discounted:    f.Discounted,
+	}
+}
+
+// ParsedQuery is a query split into its search text and the filters it states
+type ParsedQuery struct {
+	Text    string  // Query with filter phrases removed
+	Filters Filters // Filters stated in the query
+}
+
+// price matches an amount in dollars: "$100", "1.5k", "300 usd"
+const price = `\$?(\d+(?:\.\d+)?)(k?)(?:\s*(?:usd|dollars?))?`
+
+var (
+	priceBetween = regexp.MustCompile(`(?:^|\s)between\s+` + price + `\s+(?:and|to|-)\s+` + price + `(?:\s|$)`)
+	priceRange   = regexp.MustCompile(`(?:^|\s)\$(\d+(?:\.\d+)?)(k?)\s*(?:-|to)\s*` + price + `(?:\s|$)`)
+	priceMax     = regexp.MustCompile(`(?:^|\s)(?:under|below|less than|cheaper than|up to|at most|max)\s+` + price + `(?:\s|$)`)
+	priceMin     = regexp.MustCompile(`(?:^|\s)(?:over|above|more than|at least|min|from)\s+` + price + `(?:\s|$)`)
+)
+
+// ParseQuery extracts price phrases such as "under $100", "over 2k" or
+// "$500-$1000" from a query
+func ParseQuery(query string) ParsedQuery {
+	text := strings.ToLower(query)
+	var f Filters
+
+	if m := priceBetween.FindStringSubmatch(text); m != nil {
+		f.MinPriceCents, f.MaxPriceCents = cents(m[1], m[2]), cents(m[3], m[4])
+		text = priceBetween.ReplaceAllString(text, " ")
+	} else if m := priceRange.FindStringSubmatch(text); m != nil {
+		f.MinPriceCents, f.MaxPriceCents = cents(m[1], m[2]), cents(m[3], m[4])
+		text = priceRange.ReplaceAllString(text, " ")
+	}
+	if m := priceMax.FindStringSubmatch(text); m != nil {
+		f.MaxPriceCents = cents(m[1], m[2])
+		text = priceMax.ReplaceAllString(text, " ")
+	}
+	if m := priceMin.FindStringSubmatch(text); m != nil {
+		f.MinPriceCents = cents(m[1], m[2])
+		text = priceMin.ReplaceAllString(text, " ")
+	}
+	if f.MinPriceCents > f.MaxPriceCents && f.MaxPriceCents > 0 {
+		f.MinPriceCents, f.MaxPriceCents = f.MaxPriceCents, f.MinPriceCents
+	}
+
+	if f.Empty() {
+		return ParsedQuery{Text: strings.TrimSpace(query)}
+	}
+	return ParsedQuery{Text: strings.Join(strings.Fields(text), " "), Filters: f}
+}
+
+// cents converts a parsed dollar amount, with an optional "k" suffix
+func cents(amount, thousands string) int {
+	v, _ := strconv.ParseFloat(amount, 64)
+	if thousands == "k" {
+		v *= 1000
+	}
+	return int(math.Round(v * 100))
+}
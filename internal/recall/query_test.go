@@ -0,0 +1,70 @@
+package recall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		want  ParsedQuery
+	}{
+		{"chanel flap under $100", ParsedQuery{"chanel flap", Filters{MaxPriceCents: 10000}}},
+		{"Tote over 1.5k", ParsedQuery{"tote", Filters{MinPriceCents: 150000}}},
+		{"wallet $500-$1000 black", ParsedQuery{"wallet black", Filters{MinPriceCents: 50000, MaxPriceCents: 100000}}},
+		{"bag between 900 and 300 dollars", ParsedQuery{"bag", Filters{MinPriceCents: 30000, MaxPriceCents: 90000}}},
+		{"Lady Dior 2024", ParsedQuery{Text: "Lady Dior 2024"}},
+		{"underarm bag", ParsedQuery{Text: "underarm bag"}},
+	}
+	for _, c := range cases {
+		if got := ParseQuery(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestFiltersMergeAndValidate(t *testing.T) {
+	explicit := Filters{Brands: []string{"Gucci"}, MinPriceCents: 50000, MaxPriceCents: 200000}
+	parsed := ParseQuery("tote under $100 ").Filters
+	parsed.MinRating = 4.5
+
+	// Explicit price wins over the parsed one; unset filters are filled in
+	want := Filters{Brands: []string{"Gucci"}, MinPriceCents: 50000, MaxPriceCents: 200000, MinRating: 4.5}
+	if got := explicit.Merge(parsed); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge = %+v, want %+v", got, want)
+	}
+
+	for _, f := range []Filters{
+		{MinPriceCents: 300, MaxPriceCents: 200},
+		{MaxPriceCents: -1},
+		{MinRating: 6},
+		{Brands: []string{" "}},
+	} {
+		if f.Validate() == nil {
+			t.Errorf("Validate(%+v) accepted invalid filters", f)
+		}
+	}
+	if err := want.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSpellerCorrect(t *testing.T) {
+	sp := &speller{terms: map[string]int{"chanel": 9, "channel": 1, "wallet": 4, "backpack": 2, "2024": 3}}
+	cases := map[string]string{
+		"chanle":   "chanel", // Transposition
+		"walet":    "wallet",
+		"bakcpakc": "backpack", // Two edits allowed for long words
+		"chanel":   "",         // Known
+		"bag":      "",         // Too short
+		"2025":     "",         // Numbers are not corrected
+		"scarf":    "",         // Nothing close
+	}
+	for word, want := range cases {
+		got, ok := sp.correct(word)
+		if got != want || ok != (want != "") {
+			t.Errorf("correct(%q) = %q, %v, want %q", word, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// Relaxation steps, in the order they are tried. Each step keeps the
+// relaxations before it.
+const (
+	RelaxFilters  = "filters_removed"    // Least important filters dropped one at a time
+	RelaxSpelling = "spelling_corrected" // Unknown keywords corrected to catalog terms
+	RelaxKeywords = "keywords_dropped"   // Rarest keywords dropped one at a time
+	RelaxSemantic = "semantic_only"      // Nearest neighbours of the keywords' best matches
+	RelaxPopular  = "popular"            // Nothing related found; popular items instead
+)
+
+// Relaxation reports how a query without exact matches was relaxed
+type Relaxation struct {
+	Query           string            `json:"query"` // What the results are shown for
+	Steps           []string          `json:"steps"`
+	RemovedFilters  []string          `json:"removed_filters,omitempty"`
+	Corrections     map[string]string `json:"corrections,omitempty"` // Keyword -> correction
+	DroppedKeywords []string          `json:"dropped_keywords,omitempty"`
+	Message         string            `json:"message"`
+}
+
+// Result is the outcome of ParallelRecall
+type Result struct {
+	Items      []store.Item
+	Query      string      // Search text the items match, relaxed if needed
+	Filters    Filters     // Explicit and parsed filters the items pass, after relaxation
+	Relaxation *Relaxation // Set when the query had no exact matches
+	// Truncated is set when a recaller filled its limit, so more items
+	// may match than were recalled. Popular fallbacks are always truncated.
+	Truncated bool
+}
+
+// relax runs the relaxation cascade for a query text whose keywords and
+// filters matched nothing, returning the filters still applied. Explicit
+// request filters are kept throughout. It returns no items, with the
+// popular step recorded, when every step fails.
+func (s *Service) relax(ctx context.Context, req Request, text string, filters Filters, limits Limits) ([]store.Item, Filters, *Relaxation) {
+	keywords := searchTerms(text)
+	rel := &Relaxation{}
+	search := func() []store.Item {
+		if len(keywords) == 0 {
+			return nil
+		}
+		query := strings.Join(keywords, " ")
+		items, _ := s.withFilters(filters).run(ctx, req, "relaxed_text", func(r *Service) ([]store.Item, error) {
+			return r.textRecaller.MultiStrategyTextRecall(query, limits.Text)
+		})
+		return filters.Apply(items)
+	}
+	done := func(step string, items []store.Item) ([]store.Item, Filters, *Relaxation) {
+		rel.Steps = append(rel.Steps, step)
+		rel.Query = strings.Join(keywords, " ")
+		rel.Message = rel.message(text)
+		return items, filters, rel
+	}
+
+	// Drop the least important parsed filter, then the next
+	for _, name := range filterNames {
+		if !filters.has(name) || req.Filters.has(name) {
+			continue
+		}
+		filters = filters.without(name)
+		rel.RemovedFilters = append(rel.RemovedFilters, name)
+		if items := search(); len(items) > 0 {
+			return done(RelaxFilters, items)
+		}
+	}
+	if len(rel.RemovedFilters) > 0 {
+		rel.Steps = append(rel.Steps, RelaxFilters)
+	}
+
+	// Correct keywords missing from the catalog vocabulary
+	if s.speller != nil {
+		for i, keyword := range keywords {
+			if corrected, ok := s.speller.correct(keyword); ok {
+				if rel.Corrections == nil {
+					rel.Corrections = make(map[string]string)
+				}
+				rel.Corrections[keyword] = corrected
+				keywords[i] = corrected
+			}
+		}
+		if len(rel.Corrections) > 0 {
+			if items := search(); len(items) > 0 {
+				return done(RelaxSpelling, items)
+			}
+			rel.Steps = append(rel.Steps, RelaxSpelling)
+		}
+	}
+
+	// Drop keywords one at a time, rarest in the catalog (least likely to
+	// match anything) first, later keywords before earlier ones on ties
+	full := append([]string(nil), keywords...)
+	for len(keywords) > 1 {
+		drop := len(keywords) - 1
+		for i := len(keywords) - 2; i >= 0; i-- {
+			if s.termFrequency(keywords[i]) < s.termFrequency(keywords[drop]) {
+				drop = i
+			}
+		}
+		rel.DroppedKeywords = append(rel.DroppedKeywords, keywords[drop])
+		keywords = append(keywords[:drop:drop], keywords[drop+1:]...)
+		if items := search(); len(items) > 0 {
+			return done(RelaxKeywords, items)
+		}
+	}
+	if len(rel.DroppedKeywords) > 0 {
+		rel.Steps = append(rel.Steps, RelaxKeywords)
+	}
+
+	// Items semantically close to partial matches of all keywords
+	keywords, rel.DroppedKeywords = full, nil
+	if len(keywords) > 0 {
+		query := strings.Join(keywords, " ")
+		items, _ := s.withFilters(filters).run(ctx, req, "semantic", func(r *Service) ([]store.Item, error) {
+			return r.annRecaller.SemanticSearchRecall(query, limits.ANN)
+		})
+		if items = filters.Apply(items); len(items) > 0 {
+			return done(RelaxSemantic, items)
+		}
+	}
+
+	return done(RelaxPopular, nil)
+}
+
+// searchTerms splits a query into keywords without punctuation or stopwords
+func searchTerms(query string) []string {
+	return queryKeywords(strings.Join(textTerms(query), " "))
+}
+
+// termFrequency returns how many items use a term, 0 without a vocabulary
+func (s *Service) termFrequency(term string) int {
+	if s.speller == nil {
+		return 0
+	}
+	return s.speller.frequency(term)
+}
+
+// message describes the relaxation for display, e.g. `Showing results for
+// "chanel flap", price filter removed`
+func (rel *Relaxation) message(original string) string {
+	if rel.Steps[len(rel.Steps)-1] == RelaxPopular {
+		return fmt.Sprintf("No results for %q, showing popular items", original)
+	}
+	var notes []string
+	for _, name := range rel.RemovedFilters {
+		notes = append(notes, name+" filter removed")
+	}
+	keywords := make([]string, 0, len(rel.Corrections))
+	for keyword := range rel.Corrections {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		notes = append(notes, fmt.Sprintf("%q corrected to %q", keyword, rel.Corrections[keyword]))
+	}
+	for _, keyword := range rel.DroppedKeywords {
+		notes = append(notes, fmt.Sprintf("%q ignored", keyword))
+	}
+	if rel.Steps[len(rel.Steps)-1] == RelaxSemantic {
+		notes = append(notes, "showing similar items")
+	}
+	msg := fmt.Sprintf("Showing results for %q", rel.Query)
+	if len(notes) > 0 {
+		msg += ", " + strings.Join(notes, ", ")
+	}
+	return msg
+}
@@ -1,10 +1,12 @@
 package recall
 
 import (
-	"strings"
+	"context"
 	"sync"
+	"time"
 
 	"github.com/Boomshakalak/VibeRS/internal/store"
+	"github.com/Boomshakalak/VibeRS/internal/trace"
 )
 
 // Service handles parallel recall operations using specialized recallers
@@ -15,12 +17,57 @@ type Service struct {
 	hotRecaller  *HotRecaller
 	expRecaller  *ExpRecaller
 	annRecaller  *ANNRecaller
+	cfRecaller   *CFRecaller
+	speller      *speller // Catalog vocabulary for relaxing queries
+
+	filters Filters // Restrict every recaller; see withFilters
+	seed    int64   // Seeds the exploration recaller when set; see withSeed
+
+	// hybrid blends lexical and vector recall instead of letting any text
+	// hit short-circuit the vector strategies
+	hybrid bool
+	limits Limits
+}
+
+// Limits caps the candidates taken from each recall strategy
+type Limits struct {
+	Text          int `json:"text"`            // Text matches per query (and per expansion)
+	Hybrid        int `json:"hybrid"`          // Hybrid matches added to text results
+	Personal      int `json:"personal"`        // Taste-profile items added to text results
+	HotPool       int `json:"hot_pool"`        // Hot items considered for diversity next to text results
+	MaxDiversity  int `json:"max_diversity"`   // Hot items added to text results
+	Hot           int `json:"hot"`             // Hot items when text recall is insufficient
+	EmptyQueryHot int `json:"empty_query_hot"` // Hot items for an empty query
+	Random        int `json:"random"`          // Random items when text recall is insufficient (0 = off; the final ranker explores instead)
+	ANN           int `json:"ann"`             // Vector matches when text recall is insufficient
+	Attr          int `json:"attr"`            // Attribute matches when text recall is insufficient
+	Profile       int `json:"profile"`         // Taste-profile ANN candidates
+	CF            int `json:"cf"`              // Co-engagement candidates from recent interactions
+}
+
+// DefaultLimits returns the default per-strategy recall limits
+func DefaultLimits() Limits {
+	return Limits{
+		Text:          1000,
+		Hybrid:        300,
+		Personal:      20,
+		HotPool:       20,
+		MaxDiversity:  2,
+		Hot:           300,
+		EmptyQueryHot: 100,
+		Random:        0,
+		ANN:           200,
+		Attr:          300,
+		Profile:       200,
+		CF:            100,
+	}
 }
 
 // NewService creates a new recall service with all specialized recallers
 func NewService(storeService *store.Service) *Service {
 	ann := NewANNRecaller(storeService)
 	_ = ann.Build()
+	spell, _ := buildSpeller(storeService)
 	return &Service{
 		store:        storeService,
 		textRecaller: NewTextRecaller(storeService),
@@ -28,9 +75,25 @@ func NewService(storeService *store.Service) *Service {
 		hotRecaller:  NewHotRecaller(storeService),
 		expRecaller:  NewExpRecaller(storeService),
 		annRecaller:  ann,
+		cfRecaller:   NewCFRecaller(storeService),
+		speller:      spell,
+		hybrid:       true,
+		limits:       DefaultLimits(),
 	}
 }
 
+// SetLimits replaces the per-strategy recall limits.
+// Call it before the service starts handling requests.
+func (s *Service) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// SetHybrid switches hybrid lexical/vector blending on or off.
+// Call it before the service starts handling requests.
+func (s *Service) SetHybrid(enabled bool) {
+	s.hybrid = enabled
+}
+
 // RecallResult represents the result from a single recall strategy
 type RecallResult struct {
 	Items  []store.Item
@@ -38,20 +101,149 @@ type RecallResult struct {
 	Score  float64
 }
 
-// ParallelRecall executes multiple recall strategies in parallel
-func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
-	query = strings.TrimSpace(query)
+// Request describes a single recall invocation
+type Request struct {
+	Query  string
+	UserID string // Optional; enables personalized recall when set
+	// Expansions are rewritten forms of Query (e.g. synonyms) whose text
+	// matches are recalled after those of Query
+	Expansions []string
+	Limits     *Limits // Overrides the service limits when set
+	// Filters are explicit hard constraints. They take precedence over
+	// filters parsed from Query and are never relaxed.
+	Filters Filters
+	// Observe, when set, is called after each recaller runs with its
+	// latency and candidate count. It may be called concurrently.
+	Observe func(recaller string, elapsed time.Duration, candidates int)
+}
 
-	// If query is empty, return hot items only
+// run runs one recaller in its own span with a store bound to it,
+// reporting it to the request's observer
+func (s *Service) run(ctx context.Context, req Request, recaller string, recall func(r *Service) ([]store.Item, error)) ([]store.Item, error) {
+	ctx, span := trace.Start(ctx, "recall."+recaller)
+	defer span.End()
+	start := time.Now()
+	items, err := recall(s.bind(ctx))
+	span.SetAttr("candidates", len(items))
+	span.SetError(err)
+	if req.Observe != nil {
+		req.Observe(recaller, time.Since(start), len(items))
+	}
+	return items, err
+}
+
+// bind returns a copy of the service whose recallers query the store with
+// ctx and its filters
+func (s *Service) bind(ctx context.Context) *Service {
+	st := s.store.WithContext(ctx).WithFilter(s.filters.ItemFilter())
+	bound := *s
+	bound.store = st
+	bound.textRecaller = NewTextRecaller(st)
+	bound.attrRecaller = NewAttrRecaller(st)
+	bound.hotRecaller = NewHotRecaller(st)
+	bound.expRecaller = s.expRecaller.withStore(st)
+	if s.seed != 0 {
+		bound.expRecaller = s.expRecaller.withStore(st.WithSeed(s.seed)).withSeed(s.seed)
+	}
+	bound.annRecaller = s.annRecaller.withStore(st)
+	bound.cfRecaller = s.cfRecaller.withStore(st)
+	return &bound
+}
+
+// withFilters returns a copy of the service whose recallers only return
+// items passing f
+func (s *Service) withFilters(f Filters) *Service {
+	filtered := *s
+	filtered.filters = f
+	return &filtered
+}
+
+// withSeed returns a copy of the service whose exploration recaller samples
+// the same items for the same seed (0 means unseeded)
+func (s *Service) withSeed(seed int64) *Service {
+	seeded := *s
+	seeded.seed = seed
+	return &seeded
+}
+
+// ParallelRecall executes multiple recall strategies in parallel. Each
+// recaller is traced as a child of the span in ctx. Price phrases in the
+// query become filters next to the explicit ones, and every recaller only
+// returns items passing them; when the query matches nothing the parsed
+// filters and keywords are relaxed step by step and the result says how.
+func (s *Service) ParallelRecall(ctx context.Context, req Request) (*Result, error) {
+	parsed := ParseQuery(req.Query)
+	query := parsed.Text
+	limits := s.limits
+	if req.Limits != nil {
+		limits = *req.Limits
+	}
+	filters := req.Filters.Merge(parsed.Filters)
+	s = s.withFilters(filters)
+
+	// Personalized candidates for users with history: taste-profile ANN
+	// first, then items co-engaged with their recent interactions
+	var personalItems []store.Item
+	if req.UserID != "" {
+		profileItems, err := s.run(ctx, req, "profile", func(r *Service) ([]store.Item, error) {
+			return r.annRecaller.UserProfileRecall(req.UserID, limits.Profile)
+		})
+		if err != nil {
+			profileItems = nil
+		}
+		cfItems, err := s.run(ctx, req, "cf", func(r *Service) ([]store.Item, error) {
+			return r.cfRecaller.RecentInteractionsRecall(req.UserID, limits.CF)
+		})
+		if err != nil {
+			cfItems = nil
+		}
+		personalItems = mergeUnique(interleave(profileItems, cfItems))
+	}
+
+	// If query is empty, return hot items (led by the user's taste if known)
 	if query == "" {
-		return s.hotRecaller.HotRecall(100)
+		hotItems, err := s.run(ctx, req, "hot", func(r *Service) ([]store.Item, error) {
+			return r.hotRecaller.HotRecall(limits.EmptyQueryHot)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Result{
+			Items:     filters.Apply(mergeUnique(personalItems, hotItems)),
+			Filters:   filters,
+			Truncated: len(hotItems) >= limits.EmptyQueryHot,
+		}, nil
 	}
 
 	// First, try text search
-	textItems, err := s.textRecaller.MultiStrategyTextRecall(query, 1000)
+	textItems, err := s.run(ctx, req, "text", func(r *Service) ([]store.Item, error) {
+		items, err := r.textRecaller.MultiStrategyTextRecall(query, limits.Text)
+		if err != nil {
+			items = []store.Item{}
+		}
+		for _, expansion := range req.Expansions {
+			expanded, err := r.textRecaller.MultiStrategyTextRecall(expansion, limits.Text)
+			if err == nil {
+				items = mergeUnique(items, expanded)
+			}
+		}
+		return items, nil
+	})
 	if err != nil {
 		textItems = []store.Item{}
 	}
+	textItems = filters.Apply(textItems)
+
+	// Relax a query without matches rather than silently substituting
+	// popular items
+	var relaxation *Relaxation
+	if len(textItems) == 0 {
+		textItems, filters, relaxation = s.relax(ctx, req, query, filters, limits)
+		if len(textItems) > 0 {
+			query = relaxation.Query
+		}
+		s = s.withFilters(filters)
+	}
 
 	// If text search found good results, prioritize them
 	if len(textItems) >= 1 {
@@ -65,11 +257,42 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 			seen[item.ItemID] = true
 		}
 
+		// In hybrid mode, add partial-keyword and semantic matches that
+		// score close enough to the best blended candidate
+		if s.hybrid {
+			hybridItems, err := s.run(ctx, req, "hybrid", func(r *Service) ([]store.Item, error) {
+				return r.annRecaller.HybridRecall(query, req.UserID, limits.Hybrid)
+			})
+			if err == nil {
+				for _, item := range hybridItems {
+					if !seen[item.ItemID] {
+						allItems = append(allItems, item)
+						seen[item.ItemID] = true
+					}
+				}
+			}
+		}
+
+		// Add a few items matching the user's taste profile
+		personalCount := 0
+		for _, item := range personalItems {
+			if personalCount >= limits.Personal {
+				break
+			}
+			if !seen[item.ItemID] {
+				allItems = append(allItems, item)
+				seen[item.ItemID] = true
+				personalCount++
+			}
+		}
+
 		// Add a small amount of hot items for diversity (only if not already included)
-		hotItems, err := s.hotRecaller.HotRecall(20)
+		hotItems, err := s.run(ctx, req, "hot", func(r *Service) ([]store.Item, error) {
+			return r.hotRecaller.HotRecall(limits.HotPool)
+		})
 		if err == nil {
 			diversityCount := 0
-			maxDiversity := 2 // Reduce diversity items
+			maxDiversity := limits.MaxDiversity
 			if len(textItems) == 1 {
 				maxDiversity = 0 // No diversity for single exact matches
 			}
@@ -82,12 +305,18 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 			}
 		}
 
-		return allItems, nil
+		return &Result{
+			Items:      filters.Apply(allItems),
+			Query:      query,
+			Filters:    filters,
+			Relaxation: relaxation,
+			Truncated:  len(textItems) >= limits.Text,
+		}, nil
 	}
 
 	// If text search results are insufficient, use parallel strategies
 	var wg sync.WaitGroup
-	results := make(chan RecallResult, 4)
+	results := make(chan RecallResult, 6)
 
 	// Text recall
 	wg.Add(1)
@@ -100,7 +329,9 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		items, err := s.hotRecaller.HotRecall(300)
+		items, err := s.run(ctx, req, "hot", func(r *Service) ([]store.Item, error) {
+			return r.hotRecaller.HotRecall(limits.Hot)
+		})
 		if err != nil {
 			results <- RecallResult{Items: []store.Item{}, Source: "hot", Score: 0.4}
 		} else {
@@ -108,25 +339,34 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 		}
 	}()
 
-	// Exploration recall
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		items, err := s.expRecaller.RandomRecall(200)
-		if err != nil {
-			results <- RecallResult{Items: []store.Item{}, Source: "explore", Score: 0.2}
-		} else {
-			results <- RecallResult{Items: items, Source: "explore", Score: 0.2}
-		}
-	}()
+	// Uncontrolled random injection, off by default
+	if limits.Random > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := s.run(ctx, req, "explore", func(r *Service) ([]store.Item, error) {
+				return r.expRecaller.RandomRecall(limits.Random)
+			})
+			if err != nil {
+				results <- RecallResult{Items: []store.Item{}, Source: "explore", Score: 0.2}
+			} else {
+				results <- RecallResult{Items: items, Source: "explore", Score: 0.2}
+			}
+		}()
+	}
 
 	// ANN vector recall
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		// simple zero vector as placeholder when embedding unavailable
-		// In practice, convert query text to embedding
-		items, err := s.annRecaller.VectorSimilarityRecall(make([]float32, s.annRecaller.dim), 200)
+		items, err := s.run(ctx, req, "ann", func(r *Service) ([]store.Item, error) {
+			if s.hybrid {
+				// Partial keyword matches blended with semantic neighbours
+				return r.annRecaller.HybridRecall(query, req.UserID, limits.ANN)
+			}
+			// simple zero vector as placeholder when embedding unavailable
+			return r.annRecaller.VectorSimilarityRecall(make([]float32, r.annRecaller.Dim()), limits.ANN)
+		})
 		if err != nil {
 			results <- RecallResult{Items: []store.Item{}, Source: "ann", Score: 0.5}
 		} else {
@@ -134,12 +374,23 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 		}
 	}()
 
+	// Personalized recall for users with history
+	if len(personalItems) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- RecallResult{Items: personalItems, Source: "profile", Score: 0.7}
+		}()
+	}
+
 	// Attribute recall only if query might contain brand/filter info
 	if s.attrRecaller.mightContainBrand(query) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			items, err := s.attrRecaller.SmartAttrRecall(query, 300)
+			items, err := s.run(ctx, req, "attr", func(r *Service) ([]store.Item, error) {
+				return r.attrRecaller.SmartAttrRecall(query, limits.Attr)
+			})
 			if err != nil {
 				results <- RecallResult{Items: []store.Item{}, Source: "attr", Score: 0.6}
 			} else {
@@ -167,7 +418,45 @@ func (s *Service) ParallelRecall(query string) ([]store.Item, error) {
 		}
 	}
 
-	return allItems, nil
+	return &Result{Items: filters.Apply(allItems), Query: query, Filters: filters, Relaxation: relaxation, Truncated: true}, nil
+}
+
+// mergeUnique concatenates item lists, keeping the first occurrence of each item
+func mergeUnique(lists ...[]store.Item) []store.Item {
+	seen := make(map[int]bool)
+	var merged []store.Item
+	for _, list := range lists {
+		for _, item := range list {
+			if !seen[item.ItemID] {
+				merged = append(merged, item)
+				seen[item.ItemID] = true
+			}
+		}
+	}
+	return merged
+}
+
+// interleave alternates items from two lists, appending the longer tail
+func interleave(a, b []store.Item) []store.Item {
+	merged := make([]store.Item, 0, len(a)+len(b))
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i < len(a) {
+			merged = append(merged, a[i])
+		}
+		if i < len(b) {
+			merged = append(merged, b[i])
+		}
+	}
+	return merged
+}
+
+// ExplorationRecall returns candidates for the final ranker's exploration
+// slots that pass filters. A non-zero seed returns the same candidates for
+// the same seed while the catalog is unchanged.
+func (s *Service) ExplorationRecall(ctx context.Context, limit int, filters Filters, seed int64) ([]store.Item, error) {
+	return s.withFilters(filters).withSeed(seed).run(ctx, Request{}, "serendipity", func(r *Service) ([]store.Item, error) {
+		return r.expRecaller.SerendipityRecall(limit)
+	})
 }
 
 // GetTextRecaller returns the text recaller for direct access
@@ -194,3 +483,8 @@ func (s *Service) GetExpRecaller() *ExpRecaller {
 func (s *Service) GetANNRecaller() *ANNRecaller {
 	return s.annRecaller
 }
+
+// GetCFRecaller returns the collaborative filtering recaller for direct access
+func (s *Service) GetCFRecaller() *CFRecaller {
+	return s.cfRecaller
+}
@@ -0,0 +1,106 @@
+package recall
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/Boomshakalak/VibeRS/internal/store"
+)
+
+// speller corrects query keywords to terms used in item titles and brands
+type speller struct {
+	terms map[string]int // Term -> number of items using it
+}
+
+// buildSpeller reads the catalog vocabulary
+func buildSpeller(st *store.Service) (*speller, error) {
+	sp := &speller{terms: make(map[string]int)}
+	err := st.ScanItemTexts(func(title, brand string) error {
+		seen := make(map[string]bool)
+		for _, term := range textTerms(title + " " + brand) {
+			if !seen[term] {
+				sp.terms[term]++
+				seen[term] = true
+			}
+		}
+		return nil
+	})
+	return sp, err
+}
+
+// textTerms lowercases text and splits it into words, trimming punctuation
+func textTerms(text string) []string {
+	var terms []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if term := strings.TrimFunc(field, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// frequency returns the number of items using a term
+func (sp *speller) frequency(term string) int {
+	return sp.terms[term]
+}
+
+// correct returns the closest catalog term to an unknown word: within one
+// edit for words of 4 to 7 letters and two edits for longer ones, preferring
+// fewer edits and then more frequent terms. Short words and numbers are not
+// corrected.
+func (sp *speller) correct(word string) (string, bool) {
+	if sp.terms[word] > 0 || len([]rune(word)) < 4 || strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+		return "", false
+	}
+	maxEdits := 1
+	if len([]rune(word)) >= 8 {
+		maxEdits = 2
+	}
+
+	best, bestEdits, bestFreq := "", maxEdits+1, 0
+	for term, freq := range sp.terms {
+		if d := len(term) - len(word); d > maxEdits || -d > maxEdits {
+			continue
+		}
+		edits := editDistance(word, term, maxEdits)
+		if edits > maxEdits {
+			continue
+		}
+		if edits < bestEdits || edits == bestEdits && (freq > bestFreq || freq == bestFreq && term < best) {
+			best, bestEdits, bestFreq = term, edits, freq
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, or max+1 once it exceeds max
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1) // Transposition
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(rb)], max+1)
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Campaign placement types
+const (
+	PlacementFixed    = "fixed"    // Each item pinned to its position
+	PlacementFloating = "floating" // Items take any free listed position
+)
+
+// Campaign is a sponsored promotion of a list of items
+type Campaign struct {
+	ID            int
+	Name          string
+	TargetQueries []string
+	TargetBrands  []string
+	Placement     string
+	Positions     []int // 1-based
+	StartsAt      time.Time
+	EndsAt        time.Time
+	DailyCap      int // 0 = uncapped
+	Priority      int
+	ItemIDs       []int // In display order
+}
+
+// sqlTimeFormat is the layout DATETIME columns are compared in
+const sqlTimeFormat = "2006-01-02 15:04:05"
+
+// splitList parses a comma-separated column
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// GetActiveCampaigns returns campaigns running at now, highest priority first
+func (s *Service) GetActiveCampaigns(now time.Time) ([]Campaign, error) {
+	ts := now.UTC().Format(sqlTimeFormat)
+	rows, err := s.db.Query(`
+		SELECT campaign_id, name, target_queries, target_brands, placement, positions,
+		       starts_at, ends_at, daily_cap, priority
+		FROM campaigns
+		WHERE (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)
+		ORDER BY priority DESC, campaign_id`, ts, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	index := make(map[int]int)
+	for rows.Next() {
+		var c Campaign
+		var queries, brands, positions string
+		var startsAt, endsAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Name, &queries, &brands, &c.Placement, &positions,
+			&startsAt, &endsAt, &c.DailyCap, &c.Priority); err != nil {
+			return nil, err
+		}
+		c.TargetQueries = splitList(strings.ToLower(queries))
+		c.TargetBrands = splitList(brands)
+		for _, p := range splitList(positions) {
+			if pos, err := strconv.Atoi(p); err == nil && pos > 0 {
+				c.Positions = append(c.Positions, pos)
+			}
+		}
+		if startsAt.Valid {
+			c.StartsAt = startsAt.Time
+		}
+		if endsAt.Valid {
+			c.EndsAt = endsAt.Time
+		}
+		index[c.ID] = len(campaigns)
+		campaigns = append(campaigns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return campaigns, nil
+	}
+
+	itemRows, err := s.db.Query(`SELECT campaign_id, item_id FROM campaign_items ORDER BY campaign_id, rank, item_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var campaignID, itemID int
+		if err := itemRows.Scan(&campaignID, &itemID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[campaignID]; ok {
+			campaigns[i].ItemIDs = append(campaigns[i].ItemIDs, itemID)
+		}
+	}
+	return campaigns, itemRows.Err()
+}
+
+// GetCampaignImpressions returns the impressions served per campaign on a
+// UTC day ("2006-01-02")
+func (s *Service) GetCampaignImpressions(day string) (map[int]int, error) {
+	rows, err := s.db.Query(`SELECT campaign_id, impressions FROM campaign_impressions WHERE day = ?`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// AddCampaignImpressions adds served impressions per campaign for a UTC day
+func (s *Service) AddCampaignImpressions(day string, counts map[int]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO campaign_impressions (campaign_id, day, impressions) VALUES (?, ?, ?)
+		ON CONFLICT(campaign_id, day) DO UPDATE SET impressions = impressions + excluded.impressions`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for id, n := range counts {
+		if _, err := stmt.Exec(id, day, n); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
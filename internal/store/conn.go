@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Boomshakalak/VibeRS/internal/trace"
+)
+
+// conn runs statements on the database with a context, recording a client
+// span per statement when the context carries a trace
+type conn struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+// WithContext returns a store whose queries run with ctx, so they are
+// cancelled with it and traced as children of its span
+func (s *Service) WithContext(ctx context.Context) *Service {
+	bound := *s
+	bound.db = conn{db: s.db.db, ctx: ctx}
+	return &bound
+}
+
+// start opens the span of one statement
+func (c conn) start(op, query string) *trace.Span {
+	_, span := trace.StartKind(c.ctx, "sql."+op, trace.KindClient)
+	span.SetAttr("db.system", "sqlite")
+	span.SetAttr("db.statement", strings.Join(strings.Fields(query), " "))
+	return span
+}
+
+// rows ends its statement span when closed, so the span covers iteration
+type rows struct {
+	*sql.Rows
+	span *trace.Span
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.span.SetError(r.Rows.Err())
+	r.span.End()
+	return err
+}
+
+// row ends its statement span once scanned
+type row struct {
+	*sql.Row
+	span *trace.Span
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if err != sql.ErrNoRows {
+		r.span.SetError(err)
+	}
+	r.span.End()
+	return err
+}
+
+// tx ends its span when committed or rolled back. Statements inside a
+// transaction are covered by its span rather than traced one by one.
+type tx struct {
+	*sql.Tx
+	span *trace.Span
+}
+
+func (t *tx) Commit() error {
+	err := t.Tx.Commit()
+	t.span.SetError(err)
+	t.span.End()
+	return err
+}
+
+func (t *tx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.span.SetAttr("db.rolled_back", err == nil)
+	t.span.End()
+	return err
+}
+
+func (c conn) Query(query string, args ...interface{}) (*rows, error) {
+	span := c.start("query", query)
+	r, err := c.db.QueryContext(c.ctx, query, args...)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	return &rows{Rows: r, span: span}, nil
+}
+
+func (c conn) QueryRow(query string, args ...interface{}) *row {
+	span := c.start("query", query)
+	return &row{Row: c.db.QueryRowContext(c.ctx, query, args...), span: span}
+}
+
+func (c conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := c.start("exec", query)
+	defer span.End()
+	res, err := c.db.ExecContext(c.ctx, query, args...)
+	span.SetError(err)
+	return res, err
+}
+
+func (c conn) Begin() (*tx, error) {
+	_, span := trace.StartKind(c.ctx, "sql.transaction", trace.KindClient)
+	span.SetAttr("db.system", "sqlite")
+	t, err := c.db.BeginTx(c.ctx, nil)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	return &tx{Tx: t, span: span}, nil
+}
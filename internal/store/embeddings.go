@@ -0,0 +1,60 @@
+package store
+
+// DefaultEmbeddingSpace names the embedding stored on items.embedding.
+// Other spaces (e.g. "image") live in item_embeddings keyed by space name.
+const DefaultEmbeddingSpace = "default"
+
+// GetEmbeddingSpaces returns the names of the spaces in item_embeddings
+func (s *Service) GetEmbeddingSpaces() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT space FROM item_embeddings ORDER BY space`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spaces []string
+	for rows.Next() {
+		var space string
+		if err := rows.Scan(&space); err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, space)
+	}
+	return spaces, rows.Err()
+}
+
+// GetSpaceEmbeddings returns all item embeddings of a named space
+func (s *Service) GetSpaceEmbeddings(space string) ([]Item, error) {
+	if space == DefaultEmbeddingSpace {
+		return s.GetAllItemEmbeddings()
+	}
+	rows, err := s.db.Query(`SELECT item_id, embedding FROM item_embeddings WHERE space = ?`, space)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var id int
+		var emb []byte
+		if err := rows.Scan(&id, &emb); err != nil {
+			return nil, err
+		}
+		items = append(items, Item{ItemID: id, Embedding: bytesToFloat32Slice(emb)})
+	}
+	return items, rows.Err()
+}
+
+// SaveItemEmbedding stores an item's embedding in a space
+func (s *Service) SaveItemEmbedding(itemID int, space string, embedding []float32) error {
+	if space == DefaultEmbeddingSpace {
+		_, err := s.db.Exec(`UPDATE items SET embedding = ? WHERE item_id = ?`, float32SliceToBytes(embedding), itemID)
+		return err
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO item_embeddings (item_id, space, embedding) VALUES (?, ?, ?)`,
+		itemID, space, float32SliceToBytes(embedding),
+	)
+	return err
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// User action types recorded in user_actions
+const (
+	ActionView      = "view"
+	ActionClick     = "click"
+	ActionAddToCart = "add_to_cart"
+	ActionBuy       = "buy"
+)
+
+// ValidActionType reports whether t is a known user action type
+func ValidActionType(t string) bool {
+	switch t {
+	case ActionView, ActionClick, ActionAddToCart, ActionBuy:
+		return true
+	}
+	return false
+}
+
+// ItemFeedback aggregates the behavioral feedback for one item
+type ItemFeedback struct {
+	Impressions int // views plus logged exploration exposures
+	Clicks      int
+	Buys        int
+}
+
+// ExplorationDecision records an exploration slot filled by the bandit
+type ExplorationDecision struct {
+	ItemID   int     `json:"item_id"`
+	Position int     `json:"position"` // 1-based position in the ranked list
+	Policy   string  `json:"policy"`
+	Score    float64 `json:"score"`
+}
+
+// RecordAction stores a user action such as a click or purchase
+func (s *Service) RecordAction(userID string, itemID int, actionType, query string) error {
+	if !ValidActionType(actionType) {
+		return fmt.Errorf("unknown action type %q", actionType)
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO user_actions (user_id, item_id, action_type, query) VALUES (?, ?, ?, ?)`,
+		userID, itemID, actionType, query,
+	)
+	return err
+}
+
+// GetItemFeedback returns feedback counts for the given items.
+// Items without any feedback are absent from the map.
+func (s *Service) GetItemFeedback(ids []int) (map[int]ItemFeedback, error) {
+	feedback := make(map[int]ItemFeedback)
+	if len(ids) == 0 {
+		return feedback, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	in := strings.Join(placeholders, ",")
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT item_id,
+		       SUM(CASE WHEN action_type = 'view' THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN action_type = 'click' THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN action_type = 'buy' THEN 1 ELSE 0 END)
+		FROM user_actions
+		WHERE item_id IN (%s)
+		GROUP BY item_id`, in)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var fb ItemFeedback
+		if err := rows.Scan(&id, &fb.Impressions, &fb.Clicks, &fb.Buys); err != nil {
+			return nil, err
+		}
+		feedback[id] = fb
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Exploration exposures count as impressions
+	rows, err = s.db.Query(fmt.Sprintf(`
+		SELECT item_id, COUNT(*) FROM exploration_log
+		WHERE item_id IN (%s)
+		GROUP BY item_id`, in), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		fb := feedback[id]
+		fb.Impressions += n
+		feedback[id] = fb
+	}
+
+	return feedback, rows.Err()
+}
+
+// explorationAttribution is how long after an exploration exposure a click
+// or purchase is credited to it
+const explorationAttribution = "+1 day"
+
+// GetExplorationFeedback returns the bandit feedback for the given items as
+// it stood at before (all of it for the zero time). Each logged exploration
+// exposure is an impression; Clicks and Buys count the exposures the exposed
+// user followed up with a click or purchase of the item for the same query
+// within a day, so neither exceeds Impressions. Organic views and actions
+// are left out. Items never explored are absent from the map.
+func (s *Service) GetExplorationFeedback(ids []int, before time.Time) (map[int]ItemFeedback, error) {
+	feedback := make(map[int]ItemFeedback)
+	if len(ids) == 0 {
+		return feedback, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	idArgs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		idArgs[i] = id
+	}
+	// Arguments follow the placeholders: the click and buy cutoffs, the
+	// item IDs, then the exposure cutoff
+	args := idArgs
+	actionsBefore, exposuresBefore := "", ""
+	if !before.IsZero() {
+		cutoff := before.UTC().Format(sqlTimeFormat)
+		args = append(append([]interface{}{cutoff, cutoff}, idArgs...), cutoff)
+		actionsBefore, exposuresBefore = " AND a.timestamp < ?", " AND e.created_at < ?"
+	}
+
+	followedBy := func(action string) string {
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM user_actions a
+			WHERE a.item_id = e.item_id AND a.user_id IS e.user_id AND a.query IS e.query
+			  AND a.action_type = '%s' AND a.timestamp >= e.created_at
+			  AND a.timestamp < datetime(e.created_at, '%s')%s)`, action, explorationAttribution, actionsBefore)
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT e.item_id, COUNT(*), SUM(%s), SUM(%s)
+		FROM exploration_log e
+		WHERE e.item_id IN (%s)%s
+		GROUP BY e.item_id`,
+		followedBy(ActionClick), followedBy(ActionBuy), strings.Join(placeholders, ","), exposuresBefore), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var fb ItemFeedback
+		if err := rows.Scan(&id, &fb.Impressions, &fb.Clicks, &fb.Buys); err != nil {
+			return nil, err
+		}
+		feedback[id] = fb
+	}
+	return feedback, rows.Err()
+}
+
+// LogExploration persists the exploration decisions served to a user for a
+// query
+func (s *Service) LogExploration(query, userID string, decisions []ExplorationDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO exploration_log (query, user_id, item_id, position, policy, score) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range decisions {
+		if _, err := stmt.Exec(query, userID, d.ItemID, d.Position, d.Policy, d.Score); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UserAction is one row of a user's interaction history
+type UserAction struct {
+	ItemID     int
+	ActionType string
+	Timestamp  time.Time
+}
+
+// GetUserActions returns the user's most recent actions, newest first
+func (s *Service) GetUserActions(userID string, limit int) ([]UserAction, error) {
+	rows, err := s.db.Query(`
+		SELECT item_id, action_type, timestamp
+		FROM user_actions
+		WHERE user_id = ? AND item_id IS NOT NULL
+		ORDER BY timestamp DESC, action_id DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []UserAction
+	for rows.Next() {
+		var a UserAction
+		var actionType sql.NullString
+		var ts sql.NullTime
+		if err := rows.Scan(&a.ItemID, &actionType, &ts); err != nil {
+			return nil, err
+		}
+		a.ActionType = actionType.String
+		if ts.Valid {
+			a.Timestamp = ts.Time
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,111 @@
+package store
+
+import "strings"
+
+// ItemFilter restricts the items returned by candidate queries. Zero values
+// are unset.
+type ItemFilter struct {
+	Brands        []string // Any of these brands, case-insensitive
+	MinPriceCents int
+	MaxPriceCents int
+	MinRating     float64
+	InStock       bool
+	Discounted    bool // discount > 0
+}
+
+// Empty reports whether no filter is set
+func (f ItemFilter) Empty() bool {
+	return len(f.Brands) == 0 && f.MinPriceCents == 0 && f.MaxPriceCents == 0 &&
+		f.MinRating == 0 && !f.InStock && !f.Discounted
+}
+
+// matchesBrand reports whether the brand filter, if any, admits brand
+func (f ItemFilter) matchesBrand(brand string) bool {
+	if len(f.Brands) == 0 {
+		return true
+	}
+	for _, b := range f.Brands {
+		if strings.EqualFold(b, brand) {
+			return true
+		}
+	}
+	return false
+}
+
+// where returns the filter as an SQL condition on items with the arguments
+// binding its placeholders, or "" when no filter is set
+func (f ItemFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if len(f.Brands) > 0 {
+		placeholders := make([]string, len(f.Brands))
+		for i, brand := range f.Brands {
+			placeholders[i] = "?"
+			args = append(args, strings.ToLower(brand))
+		}
+		conds = append(conds, "LOWER(brand) IN ("+strings.Join(placeholders, ",")+")")
+	}
+	if f.MinPriceCents > 0 {
+		conds = append(conds, "price_cents >= ?")
+		args = append(args, f.MinPriceCents)
+	}
+	if f.MaxPriceCents > 0 {
+		conds = append(conds, "price_cents <= ?")
+		args = append(args, f.MaxPriceCents)
+	}
+	if f.MinRating > 0 {
+		conds = append(conds, "rating >= ?")
+		args = append(args, f.MinRating)
+	}
+	if f.InStock {
+		conds = append(conds, "stock > 0")
+	}
+	if f.Discounted {
+		conds = append(conds, "discount > 0")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// WithFilter returns a store whose candidate queries only return items
+// passing f: text, keyword, attribute, hot, sampling and ID lookups
+func (s *Service) WithFilter(f ItemFilter) *Service {
+	filtered := *s
+	filtered.filter = f
+	return &filtered
+}
+
+// Filter returns the filter applied by candidate queries
+func (s *Service) Filter() ItemFilter {
+	return s.filter
+}
+
+// andFilter returns the store's filter as an SQL fragment to append to a
+// WHERE clause (" AND (...)"), with its arguments
+func (s *Service) andFilter() (string, []interface{}) {
+	where, args := s.filter.where()
+	if where == "" {
+		return "", nil
+	}
+	return " AND (" + where + ")", args
+}
+
+// GetFilteredItemIDs returns the IDs of every item passing the store's
+// filter, for restricting in-memory searches such as the ANN index
+func (s *Service) GetFilteredItemIDs() (map[int]bool, error) {
+	cond, args := s.andFilter()
+	rows, err := s.db.Query(`SELECT item_id FROM items WHERE 1 = 1`+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
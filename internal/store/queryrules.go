@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// QueryRuleRecord is a stored query rule; the spec is opaque JSON
+type QueryRuleRecord struct {
+	ID        int
+	Spec      []byte
+	UpdatedAt time.Time
+}
+
+// GetQueryRules returns every stored query rule ordered by id
+func (s *Service) GetQueryRules() ([]QueryRuleRecord, error) {
+	rows, err := s.db.Query(`SELECT rule_id, spec, updated_at FROM query_rules ORDER BY rule_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []QueryRuleRecord
+	for rows.Next() {
+		var r QueryRuleRecord
+		if err := rows.Scan(&r.ID, &r.Spec, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// InsertQueryRule stores a new query rule and returns its id
+func (s *Service) InsertQueryRule(spec []byte) (int, error) {
+	res, err := s.db.Exec(`INSERT INTO query_rules (spec, updated_at) VALUES (?, ?)`, string(spec), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// UpdateQueryRule replaces a query rule, returning sql.ErrNoRows if it does not exist
+func (s *Service) UpdateQueryRule(id int, spec []byte) error {
+	res, err := s.db.Exec(`UPDATE query_rules SET spec = ?, updated_at = ? WHERE rule_id = ?`, string(spec), time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// DeleteQueryRule removes a query rule, returning sql.ErrNoRows if it does not exist
+func (s *Service) DeleteQueryRule(id int) error {
+	res, err := s.db.Exec(`DELETE FROM query_rules WHERE rule_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// requireRow reports sql.ErrNoRows when a statement affected nothing
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// itemColumns is the column list expected by scanItems
+const itemColumns = `item_id, title, brand, price_cents, discount,
+		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d`
+
+// samplingProbes is the number of random item_id ranges read per sample.
+// More probes give a better spread at the cost of extra (cheap) queries.
+const samplingProbes = 4
+
+// WithSeed returns a store whose random samples are drawn from a source
+// seeded with seed, so the same seed samples the same items from an
+// unchanged catalog. The returned store must not be shared between
+// goroutines.
+func (s *Service) WithSeed(seed int64) *Service {
+	seeded := *s
+	seeded.rng = rand.New(rand.NewSource(seed))
+	return &seeded
+}
+
+// intn returns a random int in [0, n) from the store's source
+func (s *Service) intn(n int) int {
+	if s.rng != nil {
+		return s.rng.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// shuffle shuffles n elements with the store's source
+func (s *Service) shuffle(n int, swap func(i, j int)) {
+	if s.rng != nil {
+		s.rng.Shuffle(n, swap)
+		return
+	}
+	rand.Shuffle(n, swap)
+}
+
+// itemIDRange returns the smallest and largest item_id in the catalog.
+// MIN/MAX on the rowid are answered from the b-tree without a scan.
+func (s *Service) itemIDRange() (int, int, error) {
+	var lo, hi int
+	err := s.db.QueryRow(`SELECT COALESCE(MIN(item_id), 0), COALESCE(MAX(item_id), 0) FROM items`).Scan(&lo, &hi)
+	return lo, hi, err
+}
+
+// sampleItems returns up to limit in-stock items matching where, read from
+// random item_id ranges instead of ORDER BY RANDOM() so large catalogs are
+// never fully scanned. where may be empty; args bind its placeholders.
+func (s *Service) sampleItems(where string, args []interface{}, limit int) ([]Item, error) {
+	if limit <= 0 {
+		return []Item{}, nil
+	}
+	lo, hi, err := s.itemIDRange()
+	if err != nil {
+		return nil, err
+	}
+	if hi < lo || hi == 0 {
+		return []Item{}, nil
+	}
+
+	cond := "stock > 0"
+	if where != "" {
+		cond += " AND (" + where + ")"
+	}
+	filter, filterArgs := s.andFilter()
+	cond += filter
+	args = append(append([]interface{}(nil), args...), filterArgs...)
+	upper := fmt.Sprintf(`SELECT %s FROM items WHERE item_id >= ? AND %s ORDER BY item_id LIMIT ?`, itemColumns, cond)
+	lower := fmt.Sprintf(`SELECT %s FROM items WHERE item_id < ? AND %s ORDER BY item_id LIMIT ?`, itemColumns, cond)
+
+	chunk := (limit + samplingProbes - 1) / samplingProbes
+	seen := make(map[int]bool)
+	result := make([]Item, 0, limit)
+
+	for probe := 0; probe < samplingProbes*2 && len(result) < limit; probe++ {
+		start := lo + s.intn(hi-lo+1)
+		want := chunk
+		if rem := limit - len(result); rem < want {
+			want = rem
+		}
+
+		items, err := s.queryItems(upper, append(append([]interface{}{start}, args...), want)...)
+		if err != nil {
+			return nil, err
+		}
+		// Wrap around to the head of the table when the tail runs short
+		if len(items) < want {
+			head, err := s.queryItems(lower, append(append([]interface{}{start}, args...), want-len(items))...)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, head...)
+		}
+
+		added := 0
+		for _, item := range items {
+			if !seen[item.ItemID] {
+				seen[item.ItemID] = true
+				result = append(result, item)
+				added++
+			}
+		}
+		// Every matching row has already been read
+		if added == 0 && len(items) < want {
+			break
+		}
+	}
+
+	s.shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result, nil
+}
+
+// queryItems runs a query selecting itemColumns and scans the rows
+func (s *Service) queryItems(query string, args ...interface{}) ([]Item, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanItems(rows)
+}
+
+// brandCacheTTL is how long the in-stock brand list is reused
+const brandCacheTTL = time.Minute
+
+// brandCache holds the in-stock brands so diversity sampling does not scan
+// the catalog on every request
+type brandCache struct {
+	mu       sync.Mutex
+	brands   []string
+	loadedAt time.Time
+}
+
+// GetInStockBrands returns the distinct brands that have stock, from a
+// list refreshed every brandCacheTTL. A brand filter narrows the list;
+// other filters apply only when items are sampled.
+func (s *Service) GetInStockBrands() ([]string, error) {
+	all, err := s.inStockBrands()
+	if err != nil {
+		return nil, err
+	}
+	brands := make([]string, 0, len(all))
+	for _, brand := range all {
+		if s.filter.matchesBrand(brand) {
+			brands = append(brands, brand)
+		}
+	}
+	return brands, nil
+}
+
+// inStockBrands returns the cached unfiltered brand list, reloading it when
+// stale
+func (s *Service) inStockBrands() ([]string, error) {
+	c := s.brands
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.brands != nil && time.Since(c.loadedAt) < brandCacheTTL {
+		return c.brands, nil
+	}
+
+	rows, err := s.db.Query(`SELECT DISTINCT brand FROM items WHERE stock > 0 AND brand IS NOT NULL AND brand != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	brands := []string{}
+	for rows.Next() {
+		var brand string
+		if err := rows.Scan(&brand); err != nil {
+			return nil, err
+		}
+		brands = append(brands, brand)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	c.brands, c.loadedAt = brands, time.Now()
+	return brands, nil
+}
+
+// GetRandomItemsByBrands samples up to perBrand in-stock items of each
+// brand from random item_id ranges, each read through the brand index
+func (s *Service) GetRandomItemsByBrands(brands []string, perBrand int) ([]Item, error) {
+	var result []Item
+	for _, brand := range brands {
+		items, err := s.sampleItems("brand = ?", []interface{}{brand}, perBrand)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+	}
+	return result, nil
+}
+
+// GetRandomItemsUnderPrice samples in-stock items priced at or below maxPrice
+func (s *Service) GetRandomItemsUnderPrice(maxPrice int, limit int) ([]Item, error) {
+	return s.sampleItems("price_cents <= ?", []interface{}{maxPrice}, limit)
+}
+
+// GetUnderexposedItems returns well-rated items that receive few clicks
+func (s *Service) GetUnderexposedItems(minRating float64, maxClicks int, limit int) ([]Item, error) {
+	filter, filterArgs := s.andFilter()
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM items
+		WHERE rating >= ? AND COALESCE(click_7d, 0) <= ? AND stock > 0%s
+		ORDER BY rating DESC, click_7d ASC
+		LIMIT ?
+	`, itemColumns, filter)
+	args := append([]interface{}{minRating, maxClicks}, filterArgs...)
+	return s.queryItems(query, append(args, limit)...)
+}
+
+// GetNewestItems returns in-stock items ordered by launch date
+func (s *Service) GetNewestItems(limit int) ([]Item, error) {
+	filter, filterArgs := s.andFilter()
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM items
+		WHERE stock > 0%s
+		ORDER BY launched_at DESC, item_id DESC
+		LIMIT ?
+	`, itemColumns, filter)
+	return s.queryItems(query, append(filterArgs, limit)...)
+}
@@ -0,0 +1,109 @@
+package store
+
+import "database/sql"
+
+// schemaStatements creates tables added after the initial items schema.
+// They mirror data/ddl.sql so databases created before a table existed
+// pick it up on the next start.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS user_actions (
+		action_id     INTEGER PRIMARY KEY,
+		user_id       TEXT,
+		item_id       INTEGER,
+		action_type   TEXT,
+		query         TEXT,
+		timestamp     DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_actions_item ON user_actions(item_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_actions_user ON user_actions(user_id)`,
+	`CREATE TABLE IF NOT EXISTS exploration_log (
+		log_id        INTEGER PRIMARY KEY,
+		query         TEXT,
+		user_id       TEXT,
+		item_id       INTEGER NOT NULL,
+		position      INTEGER NOT NULL,
+		policy        TEXT NOT NULL,
+		score         REAL,
+		created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_exploration_log_item ON exploration_log(item_id)`,
+	`CREATE TABLE IF NOT EXISTS item_similarity (
+		item_id       INTEGER NOT NULL,
+		related_id    INTEGER NOT NULL,
+		score         REAL NOT NULL,
+		co_count      INTEGER NOT NULL,
+		updated_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (item_id, related_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS item_embeddings (
+		item_id       INTEGER NOT NULL,
+		space         TEXT NOT NULL,
+		embedding     BLOB NOT NULL,
+		PRIMARY KEY (item_id, space)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_item_embeddings_space ON item_embeddings(space)`,
+	`CREATE TABLE IF NOT EXISTS seen_filters (
+		user_id       TEXT PRIMARY KEY,
+		filter        BLOB NOT NULL,
+		updated_at    DATETIME NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_seen_filters_updated ON seen_filters(updated_at)`,
+	`CREATE TABLE IF NOT EXISTS campaigns (
+		campaign_id    INTEGER PRIMARY KEY,
+		name           TEXT NOT NULL,
+		target_queries TEXT NOT NULL DEFAULT '',
+		target_brands  TEXT NOT NULL DEFAULT '',
+		placement      TEXT NOT NULL DEFAULT 'floating',
+		positions      TEXT NOT NULL,
+		starts_at      DATETIME,
+		ends_at        DATETIME,
+		daily_cap      INTEGER NOT NULL DEFAULT 0,
+		priority       INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS campaign_items (
+		campaign_id    INTEGER NOT NULL,
+		item_id        INTEGER NOT NULL,
+		rank           INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (campaign_id, item_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS campaign_impressions (
+		campaign_id    INTEGER NOT NULL,
+		day            TEXT NOT NULL,
+		impressions    INTEGER NOT NULL,
+		PRIMARY KEY (campaign_id, day)
+	)`,
+	`CREATE TABLE IF NOT EXISTS query_rules (
+		rule_id       INTEGER PRIMARY KEY,
+		spec          TEXT NOT NULL,
+		updated_at    DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS search_log (
+		search_id     INTEGER PRIMARY KEY,
+		request_id    TEXT,
+		query         TEXT NOT NULL,
+		norm_query    TEXT NOT NULL,
+		filters       TEXT,
+		user_id       TEXT,
+		session_id    TEXT,
+		page          INTEGER,
+		result_count  INTEGER NOT NULL,
+		top_ids       TEXT,
+		latency_ms    REAL,
+		arm           TEXT,
+		redirect      TEXT,
+		relaxation    TEXT,
+		created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_log_time ON search_log(created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_log_query ON search_log(norm_query)`,
+}
+
+// ensureSchema applies schemaStatements
+func ensureSchema(db *sql.DB) error {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchLogEntry is one logged /search request
+type SearchLogEntry struct {
+	RequestID   string
+	Query       string
+	NormQuery   string
+	Filters     map[string]string // Parsed from the query
+	UserID      string
+	SessionID   string
+	Page        int
+	ResultCount int
+	TopIDs      []int // Served on the page, in order
+	Latency     time.Duration
+	Arm         string // Pipeline version serving the search
+	Redirect    string
+	// Relaxation lists the relaxation steps applied when the query matched
+	// nothing as typed
+	Relaxation []string
+}
+
+// LogSearch appends a search to search_log
+func (s *Service) LogSearch(e SearchLogEntry) error {
+	var filters []byte
+	if len(e.Filters) > 0 {
+		var err error
+		if filters, err = json.Marshal(e.Filters); err != nil {
+			return err
+		}
+	}
+	ids := make([]string, len(e.TopIDs))
+	for i, id := range e.TopIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO search_log (request_id, query, norm_query, filters, user_id, session_id, page,
+		                        result_count, top_ids, latency_ms, arm, redirect, relaxation)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.RequestID, e.Query, e.NormQuery, string(filters), e.UserID, e.SessionID, e.Page,
+		e.ResultCount, strings.Join(ids, ","), float64(e.Latency)/float64(time.Millisecond), e.Arm, e.Redirect,
+		strings.Join(e.Relaxation, ","))
+	return err
+}
+
+// SearchQueryStat aggregates the logged searches of one normalized query
+type SearchQueryStat struct {
+	NormQuery    string
+	Searches     int
+	ZeroResults  int // Searches with no results as typed, redirects excluded
+	Redirects    int
+	AvgResults   float64
+	AvgLatencyMs float64
+	LastSeen     time.Time
+}
+
+// GetSearchQueryStats aggregates searches logged since the given time by
+// normalized query, most searched first. Searches served only after
+// relaxing the query count as zero-result searches.
+func (s *Service) GetSearchQueryStats(since time.Time) ([]SearchQueryStat, error) {
+	rows, err := s.db.Query(`
+		SELECT norm_query, COUNT(*),
+		       SUM(CASE WHEN (result_count = 0 OR COALESCE(relaxation, '') != '') AND COALESCE(redirect, '') = '' THEN 1 ELSE 0 END),
+		       SUM(CASE WHEN COALESCE(redirect, '') != '' THEN 1 ELSE 0 END),
+		       AVG(result_count), COALESCE(AVG(latency_ms), 0), MAX(created_at)
+		FROM search_log
+		WHERE created_at >= ?
+		GROUP BY norm_query
+		ORDER BY COUNT(*) DESC, norm_query`, since.UTC().Format(sqlTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []SearchQueryStat
+	for rows.Next() {
+		var st SearchQueryStat
+		var lastSeen string
+		if err := rows.Scan(&st.NormQuery, &st.Searches, &st.ZeroResults, &st.Redirects,
+			&st.AvgResults, &st.AvgLatencyMs, &lastSeen); err != nil {
+			return nil, err
+		}
+		st.LastSeen, _ = time.Parse(sqlTimeFormat, lastSeen)
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// SearchDayCount is the number of searches for one normalized query on one
+// UTC day
+type SearchDayCount struct {
+	Day         string // YYYY-MM-DD
+	NormQuery   string
+	Searches    int
+	ZeroResults int // As in SearchQueryStat
+}
+
+// GetSearchDayCounts counts searches logged since the given time by day and
+// normalized query, oldest day first
+func (s *Service) GetSearchDayCounts(since time.Time) ([]SearchDayCount, error) {
+	rows, err := s.db.Query(`
+		SELECT date(created_at), norm_query, COUNT(*),
+		       SUM(CASE WHEN (result_count = 0 OR COALESCE(relaxation, '') != '') AND COALESCE(redirect, '') = '' THEN 1 ELSE 0 END)
+		FROM search_log
+		WHERE created_at >= ?
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, since.UTC().Format(sqlTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SearchDayCount
+	for rows.Next() {
+		var c SearchDayCount
+		if err := rows.Scan(&c.Day, &c.NormQuery, &c.Searches, &c.ZeroResults); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// GetQueryClicks counts clicks recorded since the given time by the raw
+// query they were made from. Clicks without a query are left out.
+func (s *Service) GetQueryClicks(since time.Time) (map[string]int, error) {
+	rows, err := s.db.Query(`
+		SELECT query, COUNT(*)
+		FROM user_actions
+		WHERE action_type = ? AND COALESCE(query, '') != '' AND timestamp >= ?
+		GROUP BY query`, ActionClick, since.UTC().Format(sqlTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clicks := make(map[string]int)
+	for rows.Next() {
+		var query string
+		var n int
+		if err := rows.Scan(&query, &n); err != nil {
+			return nil, err
+		}
+		clicks[query] += n
+	}
+	return clicks, rows.Err()
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoadSeenFilter returns the serialized seen-filter of a user, or nil if
+// none has been saved
+func (s *Service) LoadSeenFilter(userID string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT filter FROM seen_filters WHERE user_id = ?`, userID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// SaveSeenFilters upserts serialized seen-filters keyed by user in one transaction
+func (s *Service) SaveSeenFilters(filters map[string][]byte) error {
+	if len(filters) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO seen_filters (user_id, filter, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET filter = excluded.filter, updated_at = excluded.updated_at`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for userID, data := range filters {
+		if _, err := stmt.Exec(userID, data, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteSeenFiltersBefore removes seen-filters not updated since cutoff
+func (s *Service) DeleteSeenFiltersBefore(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM seen_filters WHERE updated_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
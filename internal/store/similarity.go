@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ItemSimilarity is one precomputed item-to-item similarity
+type ItemSimilarity struct {
+	ItemID    int
+	RelatedID int
+	Score     float64
+	CoCount   int // Sessions in which both items occurred
+}
+
+// SessionAction is a user action used by offline session building
+type SessionAction struct {
+	UserID     string
+	ItemID     int
+	ActionType string
+	Timestamp  time.Time
+}
+
+// ScanSessionActions streams engagement actions ordered by user and time,
+// calling fn for each one. Views are skipped as too noisy for co-occurrence.
+func (s *Service) ScanSessionActions(fn func(SessionAction) error) error {
+	rows, err := s.db.Query(`
+		SELECT user_id, item_id, action_type, timestamp
+		FROM user_actions
+		WHERE user_id IS NOT NULL AND user_id != '' AND item_id IS NOT NULL
+		  AND action_type IN ('click', 'add_to_cart', 'buy')
+		ORDER BY user_id, timestamp, action_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a SessionAction
+		var ts sql.NullTime
+		if err := rows.Scan(&a.UserID, &a.ItemID, &a.ActionType, &ts); err != nil {
+			return err
+		}
+		if ts.Valid {
+			a.Timestamp = ts.Time
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ReplaceItemSimilarities atomically swaps the item_similarity table contents
+func (s *Service) ReplaceItemSimilarities(sims []ItemSimilarity) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM item_similarity`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO item_similarity (item_id, related_id, score, co_count) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sim := range sims {
+		if _, err := stmt.Exec(sim.ItemID, sim.RelatedID, sim.Score, sim.CoCount); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRelatedItemIDs returns the top related in-stock items of itemID that
+// pass the store's filter, best first
+func (s *Service) GetRelatedItemIDs(itemID int, limit int) ([]ItemSimilarity, error) {
+	filter, filterArgs := s.andFilter()
+	args := append([]interface{}{itemID}, filterArgs...)
+	rows, err := s.db.Query(`
+		SELECT sim.item_id, sim.related_id, sim.score, sim.co_count
+		FROM item_similarity sim
+		JOIN items ON items.item_id = sim.related_id
+		WHERE sim.item_id = ? AND items.stock > 0`+filter+`
+		ORDER BY sim.score DESC, sim.related_id
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sims []ItemSimilarity
+	for rows.Next() {
+		var sim ItemSimilarity
+		if err := rows.Scan(&sim.ItemID, &sim.RelatedID, &sim.Score, &sim.CoCount); err != nil {
+			return nil, err
+		}
+		sims = append(sims, sim)
+	}
+	return sims, rows.Err()
+}
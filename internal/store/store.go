@@ -6,6 +6,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,16 +29,26 @@ type Item struct {
 	Buy7d      int       `json:"buy_7d"`
 	GMV30d     int       `json:"gmv_30d"`
 	Embedding  []float32 `json:"-"` // Hidden from JSON
+
+	// Near-duplicate listings collapsed into this one by dedup
+	Variants   int   `json:"variants,omitempty"`
+	VariantIDs []int `json:"variant_ids,omitempty"`
+
+	// Paid placement, labeled as such in results
+	Sponsored bool `json:"sponsored,omitempty"`
 }
 
 // Service handles database operations
 type Service struct {
-	db *sql.DB
+	db     conn
+	filter ItemFilter  // Applied by candidate queries; see WithFilter
+	rng    *rand.Rand  // Drives random sampling when set; see WithSeed
+	brands *brandCache // In-stock brands, shared by every derived store
 }
 
 // NewService creates a new store service
 func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: conn{db: db, ctx: context.Background()}, brands: &brandCache{}}
 }
 
 // InitDB initializes the SQLite database with custom functions
@@ -52,6 +64,12 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Create auxiliary tables missing from older databases
+	if err := ensureSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -69,7 +87,7 @@ func registerCosineSimilarity(db *sql.DB) error {
 			return 0.0
 		}
 
-		return cosineSimilarity(vec1, vec2)
+		return CosineSimilarity(vec1, vec2)
 	}
 
 	conn, err := db.Conn(context.Background())
@@ -110,17 +128,18 @@ func float32SliceToBytes(vec []float32) []byte {
 	return buf
 }
 
-// cosineSimilarity calculates cosine similarity between two vectors
-func cosineSimilarity(a, b []float32) float64 {
+// CosineSimilarity calculates the cosine similarity of two embeddings. It
+// is 0 when their lengths differ or either is all zeros.
+func CosineSimilarity(a, b []float32) float64 {
 	if len(a) != len(b) {
 		return 0.0
 	}
 
 	var dotProduct, normA, normB float64
 	for i := 0; i < len(a); i++ {
-		dotProduct += float64(a[i] * b[i])
-		normA += float64(a[i] * a[i])
-		normB += float64(b[i] * b[i])
+		dotProduct += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
 	}
 
 	if normA == 0.0 || normB == 0.0 {
@@ -151,12 +170,14 @@ func (s *Service) GetItemsByTextSearch(query string, limit int) ([]Item, error)
 	}
 
 	whereClause := strings.Join(conditions, " AND ")
+	filter, filterArgs := s.andFilter()
+	args = append(args, filterArgs...)
 
 	sqlQuery := fmt.Sprintf(`
 		SELECT item_id, title, brand, price_cents, discount, 
 		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d
 		FROM items
-		WHERE %s AND stock > 0
+		WHERE %s AND stock > 0%s
 		ORDER BY 
 			-- Exact title matches first
 			CASE WHEN LOWER(title) = LOWER(?) THEN 1 ELSE 2 END,
@@ -166,7 +187,7 @@ func (s *Service) GetItemsByTextSearch(query string, limit int) ([]Item, error)
 			(rating * gmv_30d) DESC,
 			rating DESC
 		LIMIT ?
-	`, whereClause)
+	`, whereClause, filter)
 
 	// Add original query for exact matching in ORDER BY
 	args = append(args, query, query, limit)
@@ -180,21 +201,97 @@ func (s *Service) GetItemsByTextSearch(query string, limit int) ([]Item, error)
 	return s.scanItems(rows)
 }
 
+// ScanItemTexts calls fn with the title and brand of every item
+func (s *Service) ScanItemTexts(fn func(title, brand string) error) error {
+	rows, err := s.db.Query(`SELECT COALESCE(title, ''), COALESCE(brand, '') FROM items`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var title, brand string
+		if err := rows.Scan(&title, &brand); err != nil {
+			return err
+		}
+		if err := fn(title, brand); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// KeywordMatch is an item with the number of query keywords it matched
+type KeywordMatch struct {
+	Item    Item
+	Matched int
+}
+
+// GetItemsByKeywordMatch returns items matching at least minMatched of the
+// keywords in title or brand, ordered by number of keywords matched. Unlike
+// GetItemsByTextSearch it does not require every keyword to match.
+func (s *Service) GetItemsByKeywordMatch(keywords []string, minMatched int, limit int) ([]KeywordMatch, error) {
+	if len(keywords) == 0 {
+		return []KeywordMatch{}, nil
+	}
+
+	var terms []string
+	var args []interface{}
+	for _, keyword := range keywords {
+		terms = append(terms, "(CASE WHEN LOWER(title) LIKE ? OR LOWER(brand) LIKE ? THEN 1 ELSE 0 END)")
+		likePattern := "%" + strings.ToLower(keyword) + "%"
+		args = append(args, likePattern, likePattern)
+	}
+
+	filter, filterArgs := s.andFilter()
+	sqlQuery := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT %s, %s AS matched
+			FROM items
+			WHERE stock > 0%s
+		)
+		WHERE matched >= ?
+		ORDER BY matched DESC, (rating * gmv_30d) DESC, rating DESC
+		LIMIT ?
+	`, itemColumns, strings.Join(terms, " + "), filter)
+	args = append(append(args, filterArgs...), minMatched, limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []KeywordMatch
+	for rows.Next() {
+		var m KeywordMatch
+		item, err := scanItem(rows, &m.Matched)
+		if err != nil {
+			return nil, err
+		}
+		m.Item = item
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
 // GetItemsByFilter performs attribute-based filtering
 func (s *Service) GetItemsByFilter(brand string, maxPrice int, minRating float64, limit int) ([]Item, error) {
-	sqlQuery := `
+	filter, filterArgs := s.andFilter()
+	sqlQuery := fmt.Sprintf(`
 		SELECT item_id, title, brand, price_cents, discount, 
 		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d
 		FROM items
-		WHERE ($1 = '' OR brand = $1)
-		  AND ($2 = 0 OR price_cents <= $2)
-		  AND rating >= $3
-		  AND stock > 0
+		WHERE (? = '' OR brand = ?)
+		  AND (? = 0 OR price_cents <= ?)
+		  AND rating >= ?
+		  AND stock > 0%s
 		ORDER BY rating DESC, gmv_30d DESC
-		LIMIT $4
-	`
+		LIMIT ?
+	`, filter)
 
-	rows, err := s.db.Query(sqlQuery, brand, maxPrice, minRating, limit)
+	args := append([]interface{}{brand, brand, maxPrice, maxPrice, minRating}, filterArgs...)
+	rows, err := s.db.Query(sqlQuery, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -205,16 +302,17 @@ func (s *Service) GetItemsByFilter(brand string, maxPrice int, minRating float64
 
 // GetHotItems returns trending items
 func (s *Service) GetHotItems(limit int) ([]Item, error) {
-	sqlQuery := `
+	filter, filterArgs := s.andFilter()
+	sqlQuery := fmt.Sprintf(`
 		SELECT item_id, title, brand, price_cents, discount, 
 		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d
 		FROM items
-		WHERE stock > 0
+		WHERE stock > 0%s
 		ORDER BY gmv_30d DESC, click_7d DESC
 		LIMIT ?
-	`
+	`, filter)
 
-	rows, err := s.db.Query(sqlQuery, limit)
+	rows, err := s.db.Query(sqlQuery, append(filterArgs, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -224,23 +322,9 @@ func (s *Service) GetHotItems(limit int) ([]Item, error) {
 }
 
 // GetRandomItems returns random items for exploration
+// Sampled from random item_id ranges rather than ORDER BY RANDOM()
 func (s *Service) GetRandomItems(limit int) ([]Item, error) {
-	sqlQuery := `
-		SELECT item_id, title, brand, price_cents, discount, 
-		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d
-		FROM items
-		WHERE stock > 0
-		ORDER BY RANDOM()
-		LIMIT ?
-	`
-
-	rows, err := s.db.Query(sqlQuery, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return s.scanItems(rows)
+	return s.sampleItems("", nil, limit)
 }
 
 // GetItemsByIDs fetches items by a list of IDs preserving input order
@@ -256,19 +340,33 @@ func (s *Service) GetItemsByIDs(ids []int) ([]Item, error) {
 		args[i] = id
 	}
 
+	filter, filterArgs := s.andFilter()
 	sqlQuery := fmt.Sprintf(`
                 SELECT item_id, title, brand, price_cents, discount,
                        rating, stock, launched_at, click_7d, buy_7d, gmv_30d
                 FROM items
-                WHERE item_id IN (%s)`, strings.Join(placeholders, ","))
+                WHERE item_id IN (%s)%s`, strings.Join(placeholders, ","), filter)
 
-	rows, err := s.db.Query(sqlQuery, args...)
+	rows, err := s.db.Query(sqlQuery, append(args, filterArgs...)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	return s.scanItems(rows)
+	items, err := s.scanItems(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQL IN does not keep the order of ids; restore it
+	order := make(map[int]int, len(ids))
+	for i, id := range ids {
+		if _, ok := order[id]; !ok {
+			order[id] = i
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return order[items[i].ItemID] < order[items[j].ItemID] })
+	return items, nil
 }
 
 // GetAllItemEmbeddings returns all item embeddings for ANN index building
@@ -294,21 +392,23 @@ func (s *Service) GetAllItemEmbeddings() ([]Item, error) {
 
 // GetItemsByPrefixSearch performs prefix-based search for autocomplete
 func (s *Service) GetItemsByPrefixSearch(prefix string, limit int) ([]Item, error) {
-	sqlQuery := `
+	filter, filterArgs := s.andFilter()
+	sqlQuery := fmt.Sprintf(`
 		SELECT item_id, title, brand, price_cents, discount, 
 		       rating, stock, launched_at, click_7d, buy_7d, gmv_30d
 		FROM items
 		WHERE (LOWER(title) LIKE LOWER(?) OR LOWER(brand) LIKE LOWER(?)) 
-		  AND stock > 0
+		  AND stock > 0%s
 		ORDER BY 
 			-- Exact prefix matches first
 			CASE WHEN LOWER(title) LIKE LOWER(?) THEN 1 ELSE 2 END,
 			CASE WHEN LOWER(brand) LIKE LOWER(?) THEN 1 ELSE 2 END,
 			rating DESC, gmv_30d DESC
 		LIMIT ?
-	`
+	`, filter)
 
-	rows, err := s.db.Query(sqlQuery, prefix, prefix, prefix, prefix, limit)
+	args := append([]interface{}{prefix, prefix}, filterArgs...)
+	rows, err := s.db.Query(sqlQuery, append(args, prefix, prefix, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -318,39 +418,49 @@ func (s *Service) GetItemsByPrefixSearch(prefix string, limit int) ([]Item, erro
 }
 
 // scanItems scans database rows into Item structs
-func (s *Service) scanItems(rows *sql.Rows) ([]Item, error) {
+func (s *Service) scanItems(rows *rows) ([]Item, error) {
 	var items []Item
 
 	for rows.Next() {
-		var item Item
-		var launchedAt sql.NullTime
-		var click7d, buy7d, gmv30d sql.NullInt64
-
-		err := rows.Scan(
-			&item.ItemID, &item.Title, &item.Brand, &item.PriceCents,
-			&item.Discount, &item.Rating, &item.Stock, &launchedAt,
-			&click7d, &buy7d, &gmv30d,
-		)
+		item, err := scanItem(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		// Handle NULL values
-		if launchedAt.Valid {
-			item.LaunchedAt = launchedAt.Time
-		}
-		if click7d.Valid {
-			item.Click7d = int(click7d.Int64)
-		}
-		if buy7d.Valid {
-			item.Buy7d = int(buy7d.Int64)
-		}
-		if gmv30d.Valid {
-			item.GMV30d = int(gmv30d.Int64)
-		}
-
 		items = append(items, item)
 	}
 
 	return items, rows.Err()
 }
+
+// scanItem scans the current row into an Item; extra receives any columns
+// selected after the standard item columns
+func scanItem(rows *rows, extra ...interface{}) (Item, error) {
+	var item Item
+	var launchedAt sql.NullTime
+	var click7d, buy7d, gmv30d sql.NullInt64
+
+	dest := []interface{}{
+		&item.ItemID, &item.Title, &item.Brand, &item.PriceCents,
+		&item.Discount, &item.Rating, &item.Stock, &launchedAt,
+		&click7d, &buy7d, &gmv30d,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return Item{}, err
+	}
+
+	// Handle NULL values
+	if launchedAt.Valid {
+		item.LaunchedAt = launchedAt.Time
+	}
+	if click7d.Valid {
+		item.Click7d = int(click7d.Int64)
+	}
+	if buy7d.Valid {
+		item.Buy7d = int(buy7d.Int64)
+	}
+	if gmv30d.Valid {
+		item.GMV30d = int(gmv30d.Int64)
+	}
+
+	return item, nil
+}
@@ -0,0 +1,292 @@
+// Package trace records request spans and exports each finished trace as
+// one line of OpenTelemetry (OTLP/JSON) trace data, the format read by the
+// OpenTelemetry collector's file receiver.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span kinds, as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Status codes, as numbered by OTLP
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Span is one timed operation of a trace. A nil *Span is valid and records
+// nothing, so callers need not check whether tracing is enabled.
+type Span struct {
+	traceID, spanID, parentID string
+	rec                       *recorder // nil when the trace is not exported
+
+	mu    sync.Mutex
+	data  spanData
+	ended bool
+}
+
+// spanData is a span in OTLP/JSON form
+type spanData struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        int64       `json:"startTimeUnixNano,string"`
+	End          int64       `json:"endTimeUnixNano,string"`
+	Attributes   []Attribute `json:"attributes,omitempty"`
+	Status       Status      `json:"status"`
+}
+
+func newSpan(traceID, parentID, name string, kind int, rec *recorder) *Span {
+	s := &Span{traceID: traceID, spanID: newID(8), parentID: parentID, rec: rec}
+	s.data = spanData{
+		TraceID:      traceID,
+		SpanID:       s.spanID,
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         kind,
+		Start:        time.Now().UnixNano(),
+	}
+	return s
+}
+
+// Attribute is a span attribute in OTLP's key/value form
+type Attribute struct {
+	Key   string `json:"key"`
+	Value Value  `json:"value"`
+}
+
+// Value is an OTLP AnyValue; exactly one field is set. Integers are
+// strings, as OTLP/JSON encodes int64.
+type Value struct {
+	String *string  `json:"stringValue,omitempty"`
+	Int    *string  `json:"intValue,omitempty"`
+	Double *float64 `json:"doubleValue,omitempty"`
+	Bool   *bool    `json:"boolValue,omitempty"`
+}
+
+// Status is the outcome of a span
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// recorder collects the finished spans of one trace
+type recorder struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	spans  []spanData
+}
+
+// Tracer exports finished traces. A Tracer without a writer still creates
+// root spans, so request IDs work, but records no child spans.
+type Tracer struct {
+	service string
+	mu      sync.Mutex
+	w       io.Writer
+}
+
+// NewTracer creates a tracer exporting to w, which may be nil to disable
+// export. service names the resource in exported traces.
+func NewTracer(w io.Writer, service string) *Tracer {
+	return &Tracer{service: service, w: w}
+}
+
+// Enabled reports whether traces are exported
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.w != nil
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// StartRequest starts the root span of a new trace. traceID is used when it
+// is a valid trace ID (32 lowercase hex digits, not all zero); otherwise a
+// random one is generated.
+func (t *Tracer) StartRequest(ctx context.Context, name, traceID string) (context.Context, *Span) {
+	if !validID(traceID, 16) {
+		traceID = newID(16)
+	}
+	var rec *recorder
+	if t.Enabled() {
+		rec = &recorder{tracer: t}
+	}
+	s := newSpan(traceID, "", name, KindServer, rec)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Start starts a child of the current span of ctx. It returns a nil span
+// when ctx has no recording span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind is Start with an explicit span kind
+func StartKind(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil || parent.rec == nil {
+		return ctx, nil
+	}
+	s := newSpan(parent.traceID, parent.spanID, name, kind, parent.rec)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr sets an attribute; value may be a string, bool, integer or float
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	var v Value
+	switch x := value.(type) {
+	case string:
+		v.String = &x
+	case bool:
+		v.Bool = &x
+	case int:
+		i := strconv.Itoa(x)
+		v.Int = &i
+	case int64:
+		i := strconv.FormatInt(x, 10)
+		v.Int = &i
+	case float64:
+		v.Double = &x
+	default:
+		str := "unsupported attribute type"
+		v.String = &str
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = v
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: v})
+}
+
+// SetError marks the span failed when err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = Status{Code: StatusError, Message: err.Error()}
+}
+
+// TraceID returns the trace ID of the span, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID
+}
+
+// End finishes the span. Ending a root span exports its trace. Only the
+// first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now().UnixNano()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.rec == nil {
+		return
+	}
+	s.rec.mu.Lock()
+	s.rec.spans = append(s.rec.spans, data)
+	spans := s.rec.spans
+	s.rec.mu.Unlock()
+	if s.parentID == "" {
+		s.rec.tracer.export(spans)
+	}
+}
+
+// export writes one OTLP ExportTraceServiceRequest line. Spans still open
+// when the root ends are left out.
+func (t *Tracer) export(spans []spanData) {
+	service := t.service
+	batch := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []Attribute{{Key: "service.name", Value: Value{String: &service}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/Boomshakalak/VibeRS/internal/trace"},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		log.Printf("Trace export error: %v", err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Trace export error: %v", err)
+	}
+}
+
+// NewRequestID returns a random ID that is also a valid trace ID
+func NewRequestID() string {
+	return newID(16)
+}
+
+// newID returns n random bytes in hex
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// validID reports whether id is n bytes of lowercase hex and not all zero
+func validID(id string, n int) bool {
+	if len(id) != 2*n {
+		return false
+	}
+	zero := true
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
@@ -0,0 +1,83 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// exported decodes the spans of one exported trace line
+func exported(t *testing.T, line []byte) []spanData {
+	t.Helper()
+	var batch struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []spanData `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(line, &batch); err != nil {
+		t.Fatalf("invalid export %s: %v", line, err)
+	}
+	return batch.ResourceSpans[0].ScopeSpans[0].Spans
+}
+
+func TestExportOnRootEnd(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(&buf, "test")
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	ctx, root := tracer.StartRequest(context.Background(), "POST /search", traceID)
+	ctx2, recall := Start(ctx, "recall")
+	_, query := StartKind(ctx2, "sql.query", KindClient)
+	query.SetAttr("rows", 3)
+	query.SetError(errors.New("locked"))
+	query.End()
+	recall.End()
+	if buf.Len() != 0 {
+		t.Fatal("trace exported before the root span ended")
+	}
+	root.End()
+	root.End() // No second export
+
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 1 {
+		t.Fatalf("exported %d lines, want 1", n)
+	}
+	spans := exported(t, buf.Bytes())
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	byName := make(map[string]spanData)
+	for _, s := range spans {
+		if s.TraceID != traceID {
+			t.Errorf("%s: trace ID %s, want %s", s.Name, s.TraceID, traceID)
+		}
+		byName[s.Name] = s
+	}
+	if byName["sql.query"].ParentSpanID != byName["recall"].SpanID || byName["recall"].ParentSpanID != byName["POST /search"].SpanID {
+		t.Error("spans not nested query → recall → root")
+	}
+	if s := byName["sql.query"]; s.Status.Code != StatusError || s.Kind != KindClient || *s.Attributes[0].Value.Int != "3" {
+		t.Errorf("sql.query = %+v", s)
+	}
+}
+
+func TestDisabledTracerRecordsNothing(t *testing.T) {
+	ctx, root := NewTracer(nil, "test").StartRequest(context.Background(), "GET /", "not-a-trace-id")
+	if !validID(root.TraceID(), 16) {
+		t.Errorf("generated trace ID %q is invalid", root.TraceID())
+	}
+	_, child := Start(ctx, "stage")
+	if child != nil {
+		t.Error("child span created without export")
+	}
+	child.SetAttr("k", "v") // nil spans are no-ops
+	child.End()
+	root.End()
+
+	if _, span := Start(context.Background(), "orphan"); span != nil {
+		t.Error("span created without a trace")
+	}
+}